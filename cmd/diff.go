@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"pgcopy/internal/copy"
+	"pgcopy/internal/log"
+	"pgcopy/internal/tracing"
+)
+
+// Output formats of the diff command
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+var diffOutput string
+
+// newDiffCmd creates the diff command
+func newDiffCmd() *cobra.Command {
+	diffCmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Compare source and target table columns",
+		Long: `Compare the columns, types and nullability of the configured tables between
+the source and target databases and report missing, extra and incompatible columns.
+
+The command exits with an error when a difference would make the copy fail.`,
+		RunE: runDiff,
+	}
+
+	diffCmd.Flags().StringVar(&sourceDB, "source", "", "PostgreSQL connection string for source database")
+	diffCmd.Flags().StringVar(&targetDB, "target", "", "PostgreSQL connection string for target database")
+	diffCmd.Flags().StringVar(&configFile, "file", "", "YAML configuration file")
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", outputText, "Output format (text or json)")
+
+	diffCmd.MarkFlagRequired("file")
+
+	return diffCmd
+}
+
+func runDiff(cmd *cobra.Command, args []string) (err error) {
+	ctx, span := tracing.Tracer().Start(cmd.Context(), "pgcopy.diff")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if diffOutput != outputText && diffOutput != outputJSON {
+		return fmt.Errorf("invalid output format '%s' (expected %s or %s)", diffOutput, outputText, outputJSON)
+	}
+
+	config, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	engine, err := newEngine(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+
+	diff, err := engine.Diff(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	if diffOutput == outputJSON {
+		err = writeDiffJSON(cmd.OutOrStdout(), diff)
+	} else {
+		err = writeDiffText(cmd.OutOrStdout(), diff)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write diff: %w", err)
+	}
+
+	if diff.HasBlocking() {
+		return fmt.Errorf("schema differences would make the copy fail")
+	}
+
+	log.Info().Int("differences", len(diff.Differences)).Msg("Schema diff completed")
+	return nil
+}
+
+// writeDiffText writes the differences as an aligned table
+func writeDiffText(w io.Writer, diff *copy.SchemaDiff) error {
+	if len(diff.Differences) == 0 {
+		_, err := fmt.Fprintln(w, "No differences found")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCHEMA\tTABLE\tCOLUMN\tKIND\tSOURCE\tTARGET\tBLOCKING\tMESSAGE")
+	for _, d := range diff.Differences {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%t\t%s\n",
+			d.Schema, d.Table, d.Column, d.Kind, d.SourceType, d.TargetType, d.Blocking, d.Message)
+	}
+	return tw.Flush()
+}
+
+// writeDiffJSON writes the differences as indented JSON
+func writeDiffJSON(w io.Writer, diff *copy.SchemaDiff) error {
+	if diff.Differences == nil {
+		diff.Differences = []copy.Difference{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diff)
+}
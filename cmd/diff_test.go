@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pgcopy/internal/copy"
+)
+
+func TestWriteDiffText(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeDiffText(&buf, &copy.SchemaDiff{}))
+	assert.Equal(t, "No differences found\n", buf.String())
+
+	buf.Reset()
+	diff := &copy.SchemaDiff{Differences: []copy.Difference{
+		{Schema: "public", Table: "users", Column: "nickname", Kind: copy.DiffMissingColumn,
+			SourceType: "text", Blocking: true, Message: "column does not exist in target"},
+	}}
+	require.NoError(t, writeDiffText(&buf, diff))
+	assert.Contains(t, buf.String(), "SCHEMA")
+	assert.Contains(t, buf.String(), "nickname")
+	assert.Contains(t, buf.String(), "missing_column")
+}
+
+func TestWriteDiffJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeDiffJSON(&buf, &copy.SchemaDiff{}))
+
+	var decoded map[string][]map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Empty(t, decoded["differences"])
+	assert.NotNil(t, decoded["differences"])
+}
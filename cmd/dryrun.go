@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"pgcopy/internal/copy"
+)
+
+// writePlanText writes a summary table of the plan followed by the statements and
+// destructive actions of every table
+func writePlanText(w io.Writer, plan *copy.Plan) error {
+	if len(plan.Tables) == 0 {
+		_, err := fmt.Fprintln(w, "No tables to copy")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCHEMA\tTABLE\tCOLUMNS\tEST. ROWS\tEST. SIZE\tTRUNCATE\tSTATUS")
+	for _, t := range plan.Tables {
+		truncate := "no"
+		if t.Truncate != "" {
+			truncate = "yes"
+			if len(t.TruncateCascade) > 0 {
+				truncate = fmt.Sprintf("yes, cascades to %d", len(t.TruncateCascade))
+			}
+		}
+		status := "ok"
+		if t.Error != "" {
+			status = "fails"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			t.Schema, t.Table, len(t.Columns), formatEstimate(t.EstimatedRows), formatBytes(t.EstimatedBytes), truncate, status)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\nTotal: %d tables, ~%d rows, ~%s\n", len(plan.Tables), plan.EstimatedRows(), formatBytes(plan.EstimatedBytes()))
+
+	for _, t := range plan.Tables {
+		fmt.Fprintf(w, "\n%s.%s\n", t.Schema, t.Table)
+		writePlanLine(w, "source", t.SourceQuery)
+		writePlanLine(w, "target", t.TargetQuery)
+		writePlanLine(w, "truncate", t.Truncate)
+		writePlanLine(w, "also empties", strings.Join(t.TruncateCascade, ", "))
+		for _, statement := range t.Alter {
+			writePlanLine(w, "alter", statement)
+		}
+		writePlanLine(w, "skipped", strings.Join(t.Skipped, ", "))
+		writePlanLine(w, "sequences", strings.Join(t.Sequences, ", "))
+		for _, warning := range t.Warnings {
+			writePlanLine(w, "warning", warning)
+		}
+		writePlanLine(w, "error", t.Error)
+	}
+	return nil
+}
+
+// writePlanLine writes a labeled line of a table's plan, unless the value is empty
+func writePlanLine(w io.Writer, label, value string) {
+	if value != "" {
+		fmt.Fprintf(w, "  %-13s %s\n", label+":", value)
+	}
+}
+
+// writePlanJSON writes the plan as indented JSON
+func writePlanJSON(w io.Writer, plan *copy.Plan) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(plan)
+}
+
+// formatEstimate formats a row estimate, which is negative when unknown
+func formatEstimate(rows int64) string {
+	if rows < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("~%d", rows)
+}
+
+// formatBytes formats a byte count with a binary unit, which is negative when unknown
+func formatBytes(bytes int64) string {
+	if bytes < 0 {
+		return "-"
+	}
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value, exp := float64(bytes)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTP"[exp])
+}
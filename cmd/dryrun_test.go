@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pgcopy/internal/copy"
+)
+
+func TestWritePlanText(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writePlanText(&buf, &copy.Plan{}))
+	assert.Equal(t, "No tables to copy\n", buf.String())
+
+	buf.Reset()
+	plan := &copy.Plan{Tables: []copy.TablePlan{
+		{
+			Schema: "public", Table: "users", Columns: []string{"id", "email"},
+			SourceQuery:     "COPY (SELECT id, email FROM public.users) TO STDOUT",
+			TargetQuery:     "COPY public.users (id, email) FROM STDIN",
+			EstimatedRows:   1200,
+			EstimatedBytes:  48000,
+			Truncate:        "TRUNCATE TABLE public.users CASCADE",
+			TruncateCascade: []string{"public.orders", "public.order_items"},
+		},
+		{
+			Schema: "public", Table: "missing", EstimatedRows: -1, EstimatedBytes: -1,
+			Error: "schema check failed: public.missing: table does not exist in target",
+		},
+	}}
+	require.NoError(t, writePlanText(&buf, plan))
+
+	out := buf.String()
+	assert.Contains(t, out, "EST. ROWS")
+	assert.Contains(t, out, "yes, cascades to 2")
+	assert.Contains(t, out, "fails")
+	assert.Contains(t, out, "Total: 2 tables, ~1200 rows, ~46.9 KiB")
+	assert.Contains(t, out, "COPY public.users (id, email) FROM STDIN")
+	assert.Contains(t, out, "also empties: public.orders, public.order_items")
+	assert.Contains(t, out, "error:        schema check failed")
+}
+
+func TestWritePlanJSON(t *testing.T) {
+	var buf bytes.Buffer
+	plan := &copy.Plan{Tables: []copy.TablePlan{
+		{Schema: "public", Table: "users", Columns: []string{"id"}, EstimatedRows: 10, EstimatedBytes: 40},
+	}}
+	require.NoError(t, writePlanJSON(&buf, plan))
+
+	var decoded copy.Plan
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, *plan, decoded)
+	assert.NotContains(t, buf.String(), "truncate_cascade")
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		bytes    int64
+		expected string
+	}{
+		{-1, "-"},
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 * 1024 * 1024, "5.0 MiB"},
+		{3 * 1024 * 1024 * 1024 * 1024, "3.0 TiB"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, formatBytes(tt.bytes))
+	}
+}
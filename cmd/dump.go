@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"pgcopy/internal/copy"
+	"pgcopy/internal/storage"
+	"pgcopy/internal/tracing"
+)
+
+var (
+	pipeTable  string
+	pipeFormat string
+	pipeHeader bool
+)
+
+// newDumpCmd creates the dump command
+func newDumpCmd() *cobra.Command {
+	dumpCmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Write a single table from the source database to stdout",
+		Long: `Write one configured table from the source database to stdout, applying the
+same ignore, transform, cast and filter rules as a database copy, so the stream
+can be piped into other tools. The table must be listed in the config file.
+
+Logs are written to stderr.`,
+		Example: `  pgcopy dump --file config.yaml --table public.users | gzip > users.csv.gz
+  pgcopy dump --file config.yaml --table public.users --format jsonl | jq .email`,
+		RunE: runDump,
+	}
+
+	dumpCmd.Flags().StringVar(&sourceDB, "source", "", "PostgreSQL connection string for source database")
+	dumpCmd.Flags().StringVar(&configFile, "file", "", "YAML configuration file")
+	dumpCmd.Flags().StringVar(&pipeTable, "table", "", "Table to dump (schema.table)")
+	dumpCmd.Flags().StringVar(&pipeFormat, "format", copy.FormatCSV, "Output format (csv, tsv, jsonl or parquet)")
+	dumpCmd.Flags().BoolVar(&pipeHeader, "header", true, "Write a header row to CSV and TSV output")
+	dumpCmd.Flags().StringVar(&compression, "compress", storage.CompressionNone, "Compress the output (none, gzip or zstd)")
+	dumpCmd.Flags().IntVar(&compressionLevel, "compress-level", 0, "Compression level, 0 for the algorithm's default")
+
+	dumpCmd.MarkFlagRequired("file")
+	dumpCmd.MarkFlagRequired("table")
+
+	return dumpCmd
+}
+
+func runDump(cmd *cobra.Command, args []string) (err error) {
+	ctx, span := tracing.Tracer().Start(cmd.Context(), "pgcopy.dump")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	config, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Only configured tables can be dumped, so their masking rules always apply
+	table, err := config.FindTable(pipeTable)
+	if err != nil {
+		return err
+	}
+
+	sourceConnStr, err := getSourceConnectionString(config)
+	if err != nil {
+		return fmt.Errorf("failed to determine database connections: %w", err)
+	}
+	sourceOpts, _ := getConnectionOptions(config)
+
+	engine, err := copy.NewSourceEngine(ctx, sourceConnStr, sourceOpts)
+	if err != nil {
+		return fmt.Errorf("failed to create copy engine: %w", err)
+	}
+	defer engine.Close()
+
+	return engine.Dump(ctx, table, cmd.OutOrStdout(), copy.ExportOptions{
+		Format:           pipeFormat,
+		Header:           pipeHeader,
+		Compression:      compression,
+		CompressionLevel: compressionLevel,
+	})
+}
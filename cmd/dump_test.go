@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeCommandsRequireConfiguredTable(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+schemas:
+  - name: public
+    tables:
+      - name: users
+        ignore: [password_hash]
+`), 0o644))
+
+	for _, command := range []string{"dump", "load"} {
+		t.Run(command, func(t *testing.T) {
+			rootCmd := NewRootCmd()
+			rootCmd.SetArgs([]string{command, "--file", configPath, "--table", "public.orders"})
+			rootCmd.SilenceUsage = true
+			rootCmd.SilenceErrors = true
+
+			err := rootCmd.Execute()
+			assert.ErrorContains(t, err, "table public.orders is not in the configuration")
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"pgcopy/internal/copy"
+	"pgcopy/internal/storage"
+	"pgcopy/internal/tracing"
+)
+
+var (
+	exportDir    string
+	exportFormat string
+	exportHeader bool
+	rowGroupSize int64
+
+	// Compression settings shared by commands writing files or streams
+	compression      string
+	compressionLevel int
+)
+
+// newExportCmd creates the export command
+func newExportCmd() *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export tables from the source database to files",
+		Long: `Export the configured tables from the source database into one file per table,
+applying the same ignore, transform, cast and filter rules as a database copy.
+
+Parquet files map PostgreSQL types to Parquet logical types and compress their
+pages with the --compress codec instead of compressing the whole file.
+
+A manifest.json describing the files, their columns and row counts is written
+next to the table files.`,
+		RunE: runExport,
+	}
+
+	exportCmd.Flags().StringVar(&sourceDB, "source", "", "PostgreSQL connection string for source database")
+	exportCmd.Flags().StringVar(&configFile, "file", "", "YAML configuration file")
+	exportCmd.Flags().StringVar(&exportDir, "dir", "", "Directory or s3://bucket/prefix the table files are written to")
+	exportCmd.Flags().StringVar(&exportFormat, "format", copy.FormatCSV, "File format (csv, tsv, jsonl or parquet)")
+	exportCmd.Flags().BoolVar(&exportHeader, "header", true, "Write a header row to CSV and TSV files")
+	exportCmd.Flags().StringVar(&compression, "compress", storage.CompressionNone, "Compress files (none, gzip or zstd)")
+	exportCmd.Flags().IntVar(&compressionLevel, "compress-level", 0, "Compression level, 0 for the algorithm's default")
+	exportCmd.Flags().Int64Var(&rowGroupSize, "row-group-size", copy.DefaultRowGroupSize, "Rows per row group of Parquet files")
+
+	exportCmd.MarkFlagRequired("file")
+	exportCmd.MarkFlagRequired("dir")
+
+	return exportCmd
+}
+
+func runExport(cmd *cobra.Command, args []string) (err error) {
+	ctx, span := tracing.Tracer().Start(cmd.Context(), "pgcopy.export")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if err := copy.ValidateFormat(exportFormat); err != nil {
+		return err
+	}
+	if err := storage.ValidateCompression(compression); err != nil {
+		return err
+	}
+
+	config, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	sourceConnStr, err := getSourceConnectionString(config)
+	if err != nil {
+		return fmt.Errorf("failed to determine database connections: %w", err)
+	}
+	sourceOpts, _ := getConnectionOptions(config)
+
+	store, err := storage.New(exportDir)
+	if err != nil {
+		return err
+	}
+
+	engine, err := copy.NewSourceEngine(ctx, sourceConnStr, sourceOpts)
+	if err != nil {
+		return fmt.Errorf("failed to create copy engine: %w", err)
+	}
+	defer engine.Close()
+
+	return engine.Export(ctx, config, store, copy.ExportOptions{
+		Format:           exportFormat,
+		Header:           exportHeader,
+		Compression:      compression,
+		CompressionLevel: compressionLevel,
+		RowGroupSize:     rowGroupSize,
+	})
+}
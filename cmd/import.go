@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"pgcopy/internal/copy"
+	"pgcopy/internal/schema"
+	"pgcopy/internal/storage"
+	"pgcopy/internal/tracing"
+)
+
+var (
+	importDir      string
+	importTruncate bool
+	importRenames  []string
+)
+
+// newImportCmd creates the import command
+func newImportCmd() *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import exported table files into the target database",
+		Long: `Import a directory written by pgcopy export into the target database.
+
+Tables listed in the manifest are loaded in foreign key order. With a config file,
+only the configured tables are imported, using their truncate, load and sequence
+settings.`,
+		RunE: runImport,
+	}
+
+	importCmd.Flags().StringVar(&targetDB, "target", "", "PostgreSQL connection string for target database")
+	importCmd.Flags().StringVar(&configFile, "file", "", "YAML configuration file (optional)")
+	importCmd.Flags().StringVar(&importDir, "dir", "", "Directory or s3://bucket/prefix containing the exported files and manifest")
+	importCmd.Flags().BoolVar(&importTruncate, "truncate", false, "Truncate every target table before importing")
+	importCmd.Flags().StringArrayVar(&importRenames, "rename", nil, "Load a table into another table (schema.table=schema.table), can be repeated")
+
+	importCmd.MarkFlagRequired("dir")
+
+	return importCmd
+}
+
+func runImport(cmd *cobra.Command, args []string) (err error) {
+	ctx, span := tracing.Tracer().Start(cmd.Context(), "pgcopy.import")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	renames, err := parseRenames(importRenames)
+	if err != nil {
+		return err
+	}
+
+	// The config file is optional, it only selects tables and provides connection settings
+	var config *schema.Config
+	if configFile != "" {
+		config, err = loadConfig(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	connConfig := config
+	if connConfig == nil {
+		connConfig = &schema.Config{}
+	}
+
+	targetConnStr, err := getTargetConnectionString(connConfig)
+	if err != nil {
+		return fmt.Errorf("failed to determine database connections: %w", err)
+	}
+	_, targetOpts := getConnectionOptions(connConfig)
+
+	store, err := storage.New(importDir)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := copy.ReadManifest(ctx, store)
+	if err != nil {
+		return err
+	}
+
+	engine, err := copy.NewTargetEngine(ctx, targetConnStr, targetOpts)
+	if err != nil {
+		return fmt.Errorf("failed to create copy engine: %w", err)
+	}
+	defer engine.Close()
+
+	return engine.Import(ctx, manifest, store, config, copy.ImportOptions{
+		Truncate: importTruncate,
+		Renames:  renames,
+	})
+}
+
+// parseRenames parses --rename values of the form schema.table=schema.table
+func parseRenames(values []string) (map[string]string, error) {
+	renames := make(map[string]string, len(values))
+	for _, value := range values {
+		from, to, ok := strings.Cut(value, "=")
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid rename '%s' (expected schema.table=schema.table)", value)
+		}
+		renames[from] = to
+	}
+	return renames, nil
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRenames(t *testing.T) {
+	renames, err := parseRenames([]string{"public.users=staging.users", "public.orders=staging.orders"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"public.users":  "staging.users",
+		"public.orders": "staging.orders",
+	}, renames)
+
+	_, err = parseRenames([]string{"public.users"})
+	assert.Error(t, err)
+	_, err = parseRenames([]string{"=staging.users"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"pgcopy/internal/copy"
+	"pgcopy/internal/tracing"
+)
+
+var (
+	loadTruncate bool
+	loadColumns  []string
+)
+
+// newLoadCmd creates the load command
+func newLoadCmd() *cobra.Command {
+	loadCmd := &cobra.Command{
+		Use:   "load",
+		Short: "Load a single table into the target database from stdin",
+		Long: `Load one configured table into the target database from stdin, e.g. the output
+of pgcopy dump. The table's truncate, load and sequence settings from the config
+file apply, and its ignored columns are expected to be absent from the stream.
+Fields are matched to the table's columns by the CSV or TSV header or the JSON
+keys; input without a header needs --columns in stream order.
+Gzip and zstd compressed input is detected automatically.`,
+		Example: `  pgcopy dump --file prod.yaml --table public.users | pgcopy load --file dev.yaml --table public.users`,
+		RunE:    runLoad,
+	}
+
+	loadCmd.Flags().StringVar(&targetDB, "target", "", "PostgreSQL connection string for target database")
+	loadCmd.Flags().StringVar(&configFile, "file", "", "YAML configuration file")
+	loadCmd.Flags().StringVar(&pipeTable, "table", "", "Table to load (schema.table)")
+	loadCmd.Flags().StringVar(&pipeFormat, "format", copy.FormatCSV, "Input format (csv, tsv or jsonl)")
+	loadCmd.Flags().BoolVar(&pipeHeader, "header", true, "Read the column names from the header row of CSV and TSV input")
+	loadCmd.Flags().StringSliceVar(&loadColumns, "columns", nil, "Columns of CSV or TSV input in stream order, required without a header")
+	loadCmd.Flags().BoolVar(&loadTruncate, "truncate", false, "Truncate the target table before loading")
+
+	loadCmd.MarkFlagRequired("file")
+	loadCmd.MarkFlagRequired("table")
+
+	return loadCmd
+}
+
+func runLoad(cmd *cobra.Command, args []string) (err error) {
+	ctx, span := tracing.Tracer().Start(cmd.Context(), "pgcopy.load")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	config, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	table, err := config.FindTable(pipeTable)
+	if err != nil {
+		return err
+	}
+
+	targetConnStr, err := getTargetConnectionString(config)
+	if err != nil {
+		return fmt.Errorf("failed to determine database connections: %w", err)
+	}
+	_, targetOpts := getConnectionOptions(config)
+
+	engine, err := copy.NewTargetEngine(ctx, targetConnStr, targetOpts)
+	if err != nil {
+		return fmt.Errorf("failed to create copy engine: %w", err)
+	}
+	defer engine.Close()
+
+	return engine.Load(ctx, table, cmd.InOrStdin(), copy.LoadOptions{
+		Format:   pipeFormat,
+		Header:   pipeHeader,
+		Truncate: loadTruncate,
+		Columns:  loadColumns,
+	})
+}
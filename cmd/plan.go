@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"pgcopy/internal/log"
+	"pgcopy/internal/tracing"
+)
+
+var planOut string
+
+// newPlanCmd creates the plan command
+func newPlanCmd() *cobra.Command {
+	planCmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Resolve a copy into a plan file to review and apply later",
+		Long: `Resolve every configured table against the source and target databases without
+changing either, and write the result as a JSON plan: the copied columns, the exact
+COPY statements, the order tables are copied in, with referenced tables first, and
+the destructive actions, truncates and the tables their CASCADE empties, and the
+statements a schema_check of alter would run.
+
+The plan is applied with the apply command, which copies exactly what was planned
+and refuses to run if a source or target table changed in the meantime. With --out,
+a summary of the plan is printed as well.
+
+The command exits with an error when the copy of any table would fail.`,
+		Example: `  pgcopy plan --file config.yaml -o plan.json
+  pgcopy apply plan.json --file config.yaml`,
+		RunE: runPlan,
+	}
+
+	planCmd.Flags().StringVar(&sourceDB, "source", "", "PostgreSQL connection string for source database")
+	planCmd.Flags().StringVar(&targetDB, "target", "", "PostgreSQL connection string for target database")
+	planCmd.Flags().StringVar(&configFile, "file", "", "YAML configuration file")
+	planCmd.Flags().StringVar(&schemaCheck, "schema-check", "", "Pre-flight schema check mode (warn, fail, skip, alter or off), overrides the config file")
+	planCmd.Flags().StringVarP(&planOut, "out", "o", "", "Write the plan to this file instead of stdout")
+
+	planCmd.MarkFlagRequired("file")
+
+	return planCmd
+}
+
+func runPlan(cmd *cobra.Command, args []string) (err error) {
+	ctx, span := tracing.Tracer().Start(cmd.Context(), "pgcopy.plan")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	config, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if err := overrideSchemaCheck(config); err != nil {
+		return err
+	}
+
+	engine, err := newEngine(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+
+	plan, err := engine.Plan(ctx, config)
+	if err != nil {
+		return err
+	}
+	if err := engine.OrderPlan(ctx, plan); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := writePlanJSON(&buf, plan); err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+
+	if planOut == "" {
+		if _, err := cmd.OutOrStdout().Write(buf.Bytes()); err != nil {
+			return err
+		}
+	} else {
+		if err := os.WriteFile(planOut, buf.Bytes(), 0o600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", planOut, err)
+		}
+		if err := writePlanText(cmd.OutOrStdout(), plan); err != nil {
+			return fmt.Errorf("failed to write plan: %w", err)
+		}
+		log.Info().Str("file", planOut).Int("tables", len(plan.Tables)).Msg("Plan written")
+	}
+
+	if failed := plan.Failed(); len(failed) > 0 {
+		return fmt.Errorf("the copy of %d table(s) would fail, see the plan", len(failed))
+	}
+	return nil
+}
@@ -1,21 +1,29 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
-	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"pgcopy/internal/copy"
+	"pgcopy/internal/db"
+	"pgcopy/internal/log"
 	"pgcopy/internal/schema"
+	"pgcopy/internal/tracing"
 )
 
 var (
-	sourceDB   string
-	targetDB   string
-	configFile string
-	dryRun     bool
+	sourceDB    string
+	targetDB    string
+	configFile  string
+	dryRun      bool
+	dryRunOut   string
+	schemaCheck string
+	logLevel    string
+	logFormat   string
+	logFile     string
 )
 
 // NewRootCmd creates the root command
@@ -27,7 +35,8 @@ func NewRootCmd() *cobra.Command {
 from a source database to a target database using streaming via COPY protocol.
 
 Database connections can be specified either via command line flags or in the config file.`,
-		RunE: runCopy,
+		PersistentPreRunE: setupLogging,
+		RunE:              runCopy,
 	}
 
 	// Flags
@@ -35,6 +44,13 @@ Database connections can be specified either via command line flags or in the co
 	rootCmd.Flags().StringVar(&targetDB, "target", "", "PostgreSQL connection string for target database")
 	rootCmd.Flags().StringVar(&configFile, "file", "", "YAML configuration file")
 	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be copied without executing")
+	rootCmd.Flags().StringVarP(&dryRunOut, "output", "o", outputText, "Dry run output format (text or json)")
+	rootCmd.Flags().StringVar(&schemaCheck, "schema-check", "", "Pre-flight schema check mode (warn, fail, skip, alter or off), overrides the config file")
+
+	// Logging flags apply to every subcommand
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Log level (trace, debug, info, warn, error)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", log.FormatConsole, "Log format (console or json)")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Write logs to this file instead of stderr")
 
 	// Mark required flags (config file is always required)
 	rootCmd.MarkFlagRequired("file")
@@ -44,68 +60,209 @@ Database connections can be specified either via command line flags or in the co
 	viper.BindPFlag("target", rootCmd.Flags().Lookup("target"))
 	viper.BindPFlag("file", rootCmd.Flags().Lookup("file"))
 	viper.BindPFlag("dry-run", rootCmd.Flags().Lookup("dry-run"))
+	viper.BindPFlag("schema-check", rootCmd.Flags().Lookup("schema-check"))
+	viper.BindPFlag("log-level", rootCmd.PersistentFlags().Lookup("log-level"))
+	viper.BindPFlag("log-format", rootCmd.PersistentFlags().Lookup("log-format"))
+	viper.BindPFlag("log-file", rootCmd.PersistentFlags().Lookup("log-file"))
+
+	rootCmd.AddCommand(newDiffCmd())
+	rootCmd.AddCommand(newExportCmd())
+	rootCmd.AddCommand(newImportCmd())
+	rootCmd.AddCommand(newDumpCmd())
+	rootCmd.AddCommand(newLoadCmd())
+	rootCmd.AddCommand(newScanCmd())
+	rootCmd.AddCommand(newInitCmd())
+	rootCmd.AddCommand(newValidateCmd())
+	rootCmd.AddCommand(newPlanCmd())
+	rootCmd.AddCommand(newApplyCmd())
 
 	return rootCmd
 }
 
-func runCopy(cmd *cobra.Command, args []string) error {
-	ctx := cmd.Context()
+// setupLogging configures the global logger from the logging flags
+func setupLogging(cmd *cobra.Command, args []string) error {
+	return log.Setup(log.Options{
+		Level:  logLevel,
+		Format: logFormat,
+		File:   logFile,
+	})
+}
+
+func runCopy(cmd *cobra.Command, args []string) (err error) {
+	ctx, span := tracing.Tracer().Start(cmd.Context(), "pgcopy.run")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if dryRun && dryRunOut != outputText && dryRunOut != outputJSON {
+		return fmt.Errorf("invalid output format '%s' (expected %s or %s)", dryRunOut, outputText, outputJSON)
+	}
 
 	log.Info().Msg("Starting pgcopy operation")
 
 	// Load configuration
-	config, err := schema.LoadConfig(configFile)
+	config, err := loadConfig(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
+		return err
 	}
 
-	// Determine database connections
-	sourceConnStr, targetConnStr, err := getConnectionStrings(config)
-	if err != nil {
-		return fmt.Errorf("failed to determine database connections: %w", err)
+	if err := overrideSchemaCheck(config); err != nil {
+		return err
 	}
 
-	// Create copy engine
-	engine, err := copy.NewEngine(sourceConnStr, targetConnStr)
+	engine, err := newEngine(ctx, config)
 	if err != nil {
-		return fmt.Errorf("failed to create copy engine: %w", err)
+		return err
 	}
 	defer engine.Close()
 
 	// Execute copy operation
 	if dryRun {
 		log.Info().Msg("DRY RUN MODE - No actual copying will be performed")
-		return engine.DryRun(ctx, config)
+		plan, err := engine.DryRun(ctx, config)
+		if err != nil {
+			return err
+		}
+		if dryRunOut == outputJSON {
+			err = writePlanJSON(cmd.OutOrStdout(), plan)
+		} else {
+			err = writePlanText(cmd.OutOrStdout(), plan)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write plan: %w", err)
+		}
+		return nil
 	}
 
 	return engine.Copy(ctx, config)
 }
 
+// newEngine connects to the source and target databases given by the flags or config file
+func newEngine(ctx context.Context, config *schema.Config) (*copy.Engine, error) {
+	// Determine database connections
+	sourceConnStr, targetConnStr, err := getConnectionStrings(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine database connections: %w", err)
+	}
+
+	sourceOpts, targetOpts := getConnectionOptions(config)
+
+	// Create copy engine
+	engine, err := copy.NewEngineWithOptions(ctx, sourceConnStr, sourceOpts, targetConnStr, targetOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create copy engine: %w", err)
+	}
+
+	return engine, nil
+}
+
+// loadConfig loads the configuration file inside its own span
+func loadConfig(ctx context.Context) (*schema.Config, error) {
+	_, span := tracing.Tracer().Start(ctx, "config.load")
+	defer span.End()
+
+	config, err := schema.LoadConfig(configFile)
+	if err != nil {
+		err = fmt.Errorf("failed to load configuration: %w", err)
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// overrideSchemaCheck applies the --schema-check flag, which takes precedence over the config file
+func overrideSchemaCheck(config *schema.Config) error {
+	if schemaCheck == "" {
+		return nil
+	}
+	if err := schema.ValidateSchemaCheck(schemaCheck); err != nil {
+		return err
+	}
+	config.SchemaCheck = schemaCheck
+	return nil
+}
+
 // getConnectionStrings determines the database connection strings from config or flags
 func getConnectionStrings(config *schema.Config) (string, string, error) {
-	var sourceConnStr, targetConnStr string
+	sourceConnStr, err := getSourceConnectionString(config)
+	if err != nil {
+		return "", "", err
+	}
 
-	// Source database connection - command line flags take precedence
+	targetConnStr, err := getTargetConnectionString(config)
+	if err != nil {
+		return "", "", err
+	}
+
+	return sourceConnStr, targetConnStr, nil
+}
+
+// getSourceConnectionString determines the source connection string from config or flags
+func getSourceConnectionString(config *schema.Config) (string, error) {
+	// Command line flags take precedence
 	if sourceDB != "" {
-		sourceConnStr = sourceDB
 		log.Info().Msg("Using source database connection from command line (overrides config file)")
-	} else if config.Source.Host != "" {
-		sourceConnStr = config.Source.BuildConnectionString()
+		return sourceDB, nil
+	}
+	if config.Source.Host != "" {
 		log.Info().Msg("Using source database connection from config file")
-	} else {
-		return "", "", fmt.Errorf("source database connection not provided in config file or command line")
+		return config.Source.BuildConnectionString(), nil
 	}
+	return "", fmt.Errorf("source database connection not provided in config file or command line")
+}
 
-	// Target database connection - command line flags take precedence
+// getTargetConnectionString determines the target connection string from config or flags
+func getTargetConnectionString(config *schema.Config) (string, error) {
+	// Command line flags take precedence
 	if targetDB != "" {
-		targetConnStr = targetDB
 		log.Info().Msg("Using target database connection from command line (overrides config file)")
-	} else if config.Target.Host != "" {
-		targetConnStr = config.Target.BuildConnectionString()
+		return targetDB, nil
+	}
+	if config.Target.Host != "" {
 		log.Info().Msg("Using target database connection from config file")
-	} else {
-		return "", "", fmt.Errorf("target database connection not provided in config file or command line")
+		return config.Target.BuildConnectionString(), nil
 	}
+	return "", fmt.Errorf("target database connection not provided in config file or command line")
+}
 
-	return sourceConnStr, targetConnStr, nil
+// getConnectionOptions determines the connection options for databases taken from the config file.
+// Connections given on the command line do not inherit settings from the config file.
+func getConnectionOptions(config *schema.Config) (db.Options, db.Options) {
+	var sourceOpts, targetOpts db.Options
+
+	if sourceDB == "" {
+		sourceOpts = databaseOptions(config.Source)
+	}
+	if targetDB == "" {
+		targetOpts = databaseOptions(config.Target)
+	}
+
+	return sourceOpts, targetOpts
+}
+
+// databaseOptions converts the YAML connection settings a connection string cannot hold
+func databaseOptions(database schema.DatabaseConfig) db.Options {
+	return db.Options{
+		Tunnel:   tunnelConfig(database.SSHTunnel),
+		MaxConns: int32(database.MaxConns),
+		MinConns: int32(database.MinConns),
+	}
+}
+
+// tunnelConfig converts the YAML SSH tunnel settings into a db.TunnelConfig
+func tunnelConfig(tunnel *schema.SSHTunnelConfig) *db.TunnelConfig {
+	if tunnel == nil {
+		return nil
+	}
+
+	return &db.TunnelConfig{
+		Host:           tunnel.Host,
+		Port:           tunnel.Port,
+		User:           tunnel.User,
+		KeyFile:        tunnel.KeyFile,
+		KeyPassphrase:  tunnel.KeyPassphrase,
+		KnownHostsFile: tunnel.KnownHosts,
+	}
 }
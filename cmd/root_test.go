@@ -6,6 +6,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"pgcopy/internal/db"
 	"pgcopy/internal/schema"
 )
 
@@ -167,3 +168,40 @@ func TestGetConnectionStrings(t *testing.T) {
 		})
 	}
 }
+
+func TestGetConnectionOptions(t *testing.T) {
+	tunnel := &schema.SSHTunnelConfig{
+		Host:       "bastion.example.com",
+		Port:       2222,
+		User:       "jump",
+		KeyFile:    "~/.ssh/id_ed25519",
+		KnownHosts: "~/.ssh/known_hosts",
+	}
+	config := &schema.Config{
+		Source: schema.DatabaseConfig{Host: "prod-db.internal", SSHTunnel: tunnel, MaxConns: 4, MinConns: 1},
+		Target: schema.DatabaseConfig{Host: "staging-db.internal", SSHTunnel: tunnel, MaxConns: 8},
+	}
+
+	originalSourceDB := sourceDB
+	originalTargetDB := targetDB
+	defer func() {
+		sourceDB = originalSourceDB
+		targetDB = originalTargetDB
+	}()
+
+	// Source from config uses the tunnel, target from command line does not
+	sourceDB = ""
+	targetDB = "host=localhost dbname=staging"
+
+	sourceOpts, targetOpts := getConnectionOptions(config)
+
+	require.NotNil(t, sourceOpts.Tunnel)
+	assert.Equal(t, "bastion.example.com", sourceOpts.Tunnel.Host)
+	assert.Equal(t, 2222, sourceOpts.Tunnel.Port)
+	assert.Equal(t, "jump", sourceOpts.Tunnel.User)
+	assert.Equal(t, "~/.ssh/id_ed25519", sourceOpts.Tunnel.KeyFile)
+	assert.Equal(t, "~/.ssh/known_hosts", sourceOpts.Tunnel.KnownHostsFile)
+	assert.Equal(t, int32(4), sourceOpts.MaxConns)
+	assert.Equal(t, int32(1), sourceOpts.MinConns)
+	assert.Equal(t, db.Options{}, targetOpts)
+}
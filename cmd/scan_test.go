@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"pgcopy/internal/copy"
+	"pgcopy/internal/pii"
+	"pgcopy/internal/schema"
+)
+
+func TestWriteScanText(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeScanText(&buf, &copy.ScanReport{}))
+	assert.Equal(t, "No probable PII columns found\n", buf.String())
+
+	buf.Reset()
+	report := &copy.ScanReport{Findings: []copy.PIIFinding{
+		{Schema: "public", Table: "users", Column: "contact", Type: "text", Category: pii.Email,
+			DetectedBy: copy.DetectedByValues, Matched: 9, Sampled: 10, Transform: "hash"},
+	}}
+	require.NoError(t, writeScanText(&buf, report))
+	assert.Contains(t, buf.String(), "CATEGORY")
+	assert.Contains(t, buf.String(), "contact")
+	assert.Contains(t, buf.String(), "9/10")
+}
+
+func TestWriteScanYAML(t *testing.T) {
+	report := &copy.ScanReport{Findings: []copy.PIIFinding{
+		{Schema: "public", Table: "users", Column: "email", Category: pii.Email, Transform: "hash"},
+		{Schema: "public", Table: "users", Column: "ssn", Category: pii.NationalID, Transform: "redact", Masked: true},
+	}}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeScanYAML(&buf, report))
+
+	// The suggestion is a valid config file fragment
+	var config schema.Config
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &config))
+	require.Len(t, config.Schemas, 1)
+	require.Len(t, config.Schemas[0].Tables, 1)
+	assert.Equal(t, map[string]string{"email": "hash"}, config.Schemas[0].Tables[0].Transform)
+	assert.NotContains(t, buf.String(), "source")
+
+	buf.Reset()
+	require.NoError(t, writeScanYAML(&buf, &copy.ScanReport{}))
+	assert.Equal(t, "# No unmasked PII columns found\n", buf.String())
+}
+
+func TestScanRejectsInvalidOptions(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"scan", "--source", "postgres://localhost/db", "-o", "xml"}, wantErr: "invalid output format"},
+		{args: []string{"scan", "--source", "postgres://localhost/db", "--threshold", "1.5"}, wantErr: "invalid threshold"},
+		{args: []string{"scan"}, wantErr: "source database connection not provided"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantErr, func(t *testing.T) {
+			rootCmd := NewRootCmd()
+			rootCmd.SetArgs(tt.args)
+			rootCmd.SilenceUsage = true
+			rootCmd.SilenceErrors = true
+
+			err := rootCmd.Execute()
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
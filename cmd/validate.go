@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"pgcopy/internal/copy"
+	"pgcopy/internal/log"
+	"pgcopy/internal/tracing"
+)
+
+var validateOutput string
+
+// newValidateCmd creates the validate command
+func newValidateCmd() *cobra.Command {
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the config file against the source and target databases",
+		Long: `Check every configured table against the source and target databases without
+copying anything, and report all problems at once:
+
+  - tables missing in the source or target
+  - ignored, transformed and cast columns that do not exist in the source
+  - source queries, filters, transformations and casts that do not compile
+  - target columns that cannot take the copied values, see the diff command
+  - missing SELECT privileges on the source and INSERT, TRUNCATE or ownership
+    on the target, as required by the table's settings
+  - columns violating the masking policy
+
+The command exits with an error when any problem is found.`,
+		RunE: runValidate,
+	}
+
+	validateCmd.Flags().StringVar(&sourceDB, "source", "", "PostgreSQL connection string for source database")
+	validateCmd.Flags().StringVar(&targetDB, "target", "", "PostgreSQL connection string for target database")
+	validateCmd.Flags().StringVar(&configFile, "file", "", "YAML configuration file")
+	validateCmd.Flags().StringVarP(&validateOutput, "output", "o", outputText, "Output format (text or json)")
+
+	validateCmd.MarkFlagRequired("file")
+
+	return validateCmd
+}
+
+func runValidate(cmd *cobra.Command, args []string) (err error) {
+	ctx, span := tracing.Tracer().Start(cmd.Context(), "pgcopy.validate")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if validateOutput != outputText && validateOutput != outputJSON {
+		return fmt.Errorf("invalid output format '%s' (expected %s or %s)", validateOutput, outputText, outputJSON)
+	}
+
+	config, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	engine, err := newEngine(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+
+	report, err := engine.Validate(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	if validateOutput == outputJSON {
+		err = writeValidationJSON(cmd.OutOrStdout(), report)
+	} else {
+		err = writeValidationText(cmd.OutOrStdout(), report)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write validation report: %w", err)
+	}
+
+	if len(report.Problems) > 0 {
+		return fmt.Errorf("configuration has %d problem(s)", len(report.Problems))
+	}
+
+	log.Info().Msg("Configuration is valid")
+	return nil
+}
+
+// writeValidationText writes the problems as an aligned table
+func writeValidationText(w io.Writer, report *copy.ValidationReport) error {
+	if len(report.Problems) == 0 {
+		_, err := fmt.Fprintln(w, "No problems found")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCHEMA\tTABLE\tCOLUMN\tCHECK\tMESSAGE")
+	for _, p := range report.Problems {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", p.Schema, p.Table, p.Column, p.Check, p.Message)
+	}
+	return tw.Flush()
+}
+
+// writeValidationJSON writes the problems as indented JSON
+func writeValidationJSON(w io.Writer, report *copy.ValidationReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
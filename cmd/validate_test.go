@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pgcopy/internal/copy"
+)
+
+func TestWriteValidationText(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeValidationText(&buf, &copy.ValidationReport{}))
+	assert.Equal(t, "No problems found\n", buf.String())
+
+	buf.Reset()
+	report := &copy.ValidationReport{Problems: []copy.Problem{
+		{Schema: "public", Table: "users", Column: "emial", Check: copy.CheckColumn,
+			Message: "transformed column does not exist in source"},
+	}}
+	require.NoError(t, writeValidationText(&buf, report))
+	assert.Contains(t, buf.String(), "CHECK")
+	assert.Contains(t, buf.String(), "emial")
+	assert.Contains(t, buf.String(), "transformed column does not exist in source")
+}
+
+func TestWriteValidationJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeValidationJSON(&buf, &copy.ValidationReport{Problems: []copy.Problem{}}))
+
+	var decoded map[string][]map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.NotNil(t, decoded["problems"])
+	assert.Empty(t, decoded["problems"])
+}
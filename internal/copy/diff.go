@@ -0,0 +1,459 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/trace"
+
+	"pgcopy/internal/log"
+	"pgcopy/internal/schema"
+	"pgcopy/internal/tracing"
+)
+
+// Kinds of schema differences reported by Diff
+const (
+	DiffMissingTable  = "missing_table"
+	DiffMissingColumn = "missing_column"
+	DiffExtraColumn   = "extra_column"
+	DiffTypeMismatch  = "type_mismatch"
+	DiffNullability   = "nullability"
+)
+
+// ColumnInfo describes a table column as seen in the catalog
+type ColumnInfo struct {
+	Name       string
+	Type       string
+	NotNull    bool
+	HasDefault bool
+}
+
+// Difference is a single schema difference between the source and target table
+type Difference struct {
+	Schema     string `json:"schema"`
+	Table      string `json:"table"`
+	Column     string `json:"column,omitempty"`
+	Kind       string `json:"kind"`
+	SourceType string `json:"source_type,omitempty"`
+	TargetType string `json:"target_type,omitempty"`
+	// Blocking differences make the copy of the table fail
+	Blocking bool   `json:"blocking"`
+	Message  string `json:"message"`
+}
+
+// SchemaDiff holds the differences found for all configured tables
+type SchemaDiff struct {
+	Differences []Difference `json:"differences"`
+}
+
+// HasBlocking reports whether any difference would make a copy fail
+func (d *SchemaDiff) HasBlocking() bool {
+	return slices.ContainsFunc(d.Differences, func(diff Difference) bool { return diff.Blocking })
+}
+
+// tableColumnsQuery lists the columns of a table with their formatted types
+const tableColumnsQuery = `
+	SELECT a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull,
+	       a.atthasdef OR a.attidentity <> '' OR a.attgenerated <> ''
+	FROM pg_attribute a
+	JOIN pg_class c ON c.oid = a.attrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE n.nspname = $1 AND c.relname = $2
+	  AND a.attnum > 0 AND NOT a.attisdropped
+	ORDER BY a.attnum
+`
+
+// Diff compares the columns of every configured table between source and target
+func (e *Engine) Diff(ctx context.Context, config *schema.Config) (diff *SchemaDiff, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.diff")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	diff = &SchemaDiff{}
+	for _, table := range config.GetAllTables() {
+		differences, err := e.diffTable(ctx, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare table %s.%s: %w", table.Schema, table.Table, err)
+		}
+		diff.Differences = append(diff.Differences, differences...)
+	}
+
+	return diff, nil
+}
+
+// diffTable compares the columns of one table between source and target
+func (e *Engine) diffTable(ctx context.Context, table schema.TableInfo) ([]Difference, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.diff_table", trace.WithAttributes(tableAttributes(table)...))
+	defer span.End()
+
+	sourceColumns, err := e.getSourceColumnInfo(ctx, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source columns: %w", err)
+	}
+	targetColumns, err := getColumnInfo(ctx, e.targetConn.GetPool(), table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target columns: %w", err)
+	}
+
+	return compareColumns(table, sourceColumns, targetColumns), nil
+}
+
+// compareColumns reports the differences between the source and target columns of a table.
+// Ignored source columns are not compared.
+func compareColumns(table schema.TableInfo, source, target []ColumnInfo) []Difference {
+	if len(source) == 0 {
+		return []Difference{{
+			Schema:   table.Schema,
+			Table:    table.Table,
+			Kind:     DiffMissingTable,
+			Blocking: true,
+			Message:  "table does not exist in source",
+		}}
+	}
+	if len(target) == 0 {
+		return []Difference{{
+			Schema:   table.Schema,
+			Table:    table.Table,
+			Kind:     DiffMissingTable,
+			Blocking: true,
+			Message:  "table does not exist in target",
+		}}
+	}
+
+	targetByName := make(map[string]ColumnInfo, len(target))
+	for _, col := range target {
+		targetByName[col.Name] = col
+	}
+
+	var differences []Difference
+	copied := make(map[string]bool, len(source))
+	for _, src := range source {
+		if slices.Contains(table.Ignore, src.Name) {
+			continue
+		}
+		copied[src.Name] = true
+
+		tgt, ok := targetByName[src.Name]
+		if !ok {
+			differences = append(differences, Difference{
+				Schema: table.Schema, Table: table.Table, Column: src.Name,
+				Kind: DiffMissingColumn, SourceType: src.Type, Blocking: true,
+				Message: "column does not exist in target",
+			})
+			continue
+		}
+
+		if src.Type != tgt.Type {
+			// Values that fit are loaded whatever the types, so only the strict modes block
+			compatible := typesCompatible(src.Type, tgt.Type)
+			message := "target type may not hold all source values"
+			if compatible {
+				message = "target type is wider than source type"
+			}
+			differences = append(differences, Difference{
+				Schema: table.Schema, Table: table.Table, Column: src.Name,
+				Kind: DiffTypeMismatch, SourceType: src.Type, TargetType: tgt.Type,
+				Blocking: !compatible && schemaCheckMode(table) != schema.SchemaCheckWarn,
+				Message:  message,
+			})
+		}
+
+		if !src.NotNull && tgt.NotNull {
+			differences = append(differences, Difference{
+				Schema: table.Schema, Table: table.Table, Column: src.Name,
+				Kind: DiffNullability, SourceType: src.Type, TargetType: tgt.Type,
+				Message: "column is nullable in source but NOT NULL in target",
+			})
+		}
+	}
+
+	for _, tgt := range target {
+		if copied[tgt.Name] {
+			continue
+		}
+		required := tgt.NotNull && !tgt.HasDefault
+		if slices.Contains(table.Ignore, tgt.Name) && !required {
+			continue
+		}
+
+		message := "column does not exist in source, target default is used"
+		if required {
+			message = "column does not exist in source and is NOT NULL without a default"
+		}
+		differences = append(differences, Difference{
+			Schema: table.Schema, Table: table.Table, Column: tgt.Name,
+			Kind: DiffExtraColumn, TargetType: tgt.Type, Blocking: required,
+			Message: message,
+		})
+	}
+
+	return differences
+}
+
+// widerTypes lists the types a column can be copied into without losing values
+var widerTypes = map[string][]string{
+	"smallint":  {"integer", "bigint", "numeric", "real", "double precision"},
+	"integer":   {"bigint", "numeric", "double precision"},
+	"bigint":    {"numeric"},
+	"real":      {"double precision"},
+	"json":      {"jsonb"},
+	"date":      {"timestamp without time zone", "timestamp with time zone"},
+	"character": {"character varying"},
+}
+
+// typeModifier splits a formatted type such as numeric(10,2) into its name and modifiers
+var typeModifier = regexp.MustCompile(`^([a-z ]+?)(?:\((\d+)(?:,(\d+))?\))?$`)
+
+// typesCompatible reports whether every value of the source type can be loaded into the target type
+func typesCompatible(source, target string) bool {
+	if source == target || target == "text" {
+		return true
+	}
+
+	// Arrays are compatible when their elements are
+	if strings.HasSuffix(source, "[]") || strings.HasSuffix(target, "[]") {
+		if !strings.HasSuffix(source, "[]") || !strings.HasSuffix(target, "[]") {
+			return false
+		}
+		return typesCompatible(strings.TrimSuffix(source, "[]"), strings.TrimSuffix(target, "[]"))
+	}
+
+	srcMatch := typeModifier.FindStringSubmatch(source)
+	tgtMatch := typeModifier.FindStringSubmatch(target)
+	if srcMatch == nil || tgtMatch == nil {
+		return false
+	}
+	srcName, tgtName := srcMatch[1], tgtMatch[1]
+
+	if srcName != tgtName {
+		if !slices.Contains(widerTypes[srcName], tgtName) {
+			return false
+		}
+		// A length limit on the target must be at least the source's
+		return tgtMatch[2] == "" || (srcMatch[2] != "" && atoi(srcMatch[2]) <= atoi(tgtMatch[2]))
+	}
+
+	// Same type with different modifiers: unbounded targets accept everything
+	if tgtMatch[2] == "" {
+		return true
+	}
+	if srcMatch[2] == "" {
+		return false
+	}
+
+	if srcName == "numeric" {
+		srcScale, tgtScale := atoi(srcMatch[3]), atoi(tgtMatch[3])
+		srcDigits, tgtDigits := atoi(srcMatch[2])-srcScale, atoi(tgtMatch[2])-tgtScale
+		return tgtScale >= srcScale && tgtDigits >= srcDigits
+	}
+
+	return atoi(srcMatch[2]) <= atoi(tgtMatch[2])
+}
+
+// atoi parses a type modifier, treating a missing one as zero
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// getColumnInfo returns the columns of a table, or none if the table does not exist
+func getColumnInfo(ctx context.Context, pool *pgxpool.Pool, table schema.TableInfo) ([]ColumnInfo, error) {
+	rows, err := pool.Query(ctx, tableColumnsQuery, table.Schema, table.Table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []ColumnInfo
+	for rows.Next() {
+		var col ColumnInfo
+		if err := rows.Scan(&col.Name, &col.Type, &col.NotNull, &col.HasDefault); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+
+	return columns, rows.Err()
+}
+
+// getSourceColumnInfo returns the source columns of a table, or the result columns of its query
+func (e *Engine) getSourceColumnInfo(ctx context.Context, table schema.TableInfo) ([]ColumnInfo, error) {
+	if table.Query == "" {
+		return getColumnInfo(ctx, e.sourceConn.GetPool(), table)
+	}
+
+	conn, err := e.sourceConn.GetPool().Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	described, err := describeColumns(ctx, conn.Conn(), table.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]ColumnInfo, len(described))
+	for i, col := range described {
+		// The nullability of query results is unknown, so it is not compared
+		columns[i] = ColumnInfo{Name: col.Name, Type: col.Type, NotNull: true}
+	}
+	return columns, nil
+}
+
+// schemaCheckMode returns the effective schema check mode of a table
+func schemaCheckMode(table schema.TableInfo) string {
+	if table.SchemaCheck == "" {
+		return schema.SchemaCheckWarn
+	}
+	return table.SchemaCheck
+}
+
+// schemaResolution is how the schema check mode resolves the differences of a table
+type schemaResolution struct {
+	// Table has the casts resolving type mismatches and the skipped columns ignored
+	Table schema.TableInfo
+	// Skipped columns are left out of the copy
+	Skipped []string
+	// Alter statements change the target to take the source columns
+	Alter []string
+}
+
+// checkSchema compares a table before it is copied and resolves blocking differences
+// according to the schema check mode. It returns the table with any skipped columns ignored.
+func (e *Engine) checkSchema(ctx context.Context, table schema.TableInfo) (schema.TableInfo, error) {
+	resolution, err := e.resolveSchema(ctx, table)
+	if err != nil {
+		return table, err
+	}
+
+	for _, column := range resolution.Skipped {
+		log.Warn().Str("schema", table.Schema).Str("table", table.Table).Str("column", column).
+			Msg("Column left out of the copy")
+	}
+	for _, statement := range resolution.Alter {
+		if _, err := e.targetConn.GetPool().Exec(ctx, statement); err != nil {
+			return table, fmt.Errorf("failed to alter target column: %w", err)
+		}
+		log.Info().Str("schema", table.Schema).Str("table", table.Table).Str("statement", statement).
+			Msg("Target table altered")
+	}
+
+	return resolution.Table, nil
+}
+
+// resolveSchema compares a table and works out how the schema check mode resolves its
+// blocking differences, without changing the target. It fails if any is left unresolved.
+func (e *Engine) resolveSchema(ctx context.Context, table schema.TableInfo) (schemaResolution, error) {
+	mode := schemaCheckMode(table)
+	if mode == schema.SchemaCheckOff && !table.AutoCast && len(table.Cast) == 0 {
+		return schemaResolution{Table: table}, nil
+	}
+
+	differences, err := e.diffTable(ctx, table)
+	if err != nil {
+		return schemaResolution{Table: table}, err
+	}
+
+	var resolution schemaResolution
+	var unresolved []string
+	for _, d := range differences {
+		if d.Kind == DiffTypeMismatch {
+			table = resolveCast(table, &d)
+		}
+
+		logDifference(d)
+		if !d.Blocking || mode == schema.SchemaCheckOff {
+			continue
+		}
+
+		switch {
+		case mode == schema.SchemaCheckSkip && (d.Kind == DiffMissingColumn || d.Kind == DiffTypeMismatch):
+			resolution.Skipped = append(resolution.Skipped, d.Column)
+		case mode == schema.SchemaCheckAlter && alterStatement(d) != "":
+			resolution.Alter = append(resolution.Alter, alterStatement(d))
+		default:
+			unresolved = append(unresolved, formatDifference(d))
+		}
+	}
+
+	if len(unresolved) > 0 {
+		return schemaResolution{Table: table}, fmt.Errorf("schema check failed: %s", strings.Join(unresolved, "; "))
+	}
+
+	if len(resolution.Skipped) > 0 {
+		table.Ignore = append(slices.Clone(table.Ignore), resolution.Skipped...)
+	}
+	resolution.Table = table
+	return resolution, nil
+}
+
+// logDifference logs a difference, as a warning when it would make the copy fail or may
+// lose values
+func logDifference(d Difference) {
+	event := log.Info()
+	if d.Blocking || (d.Kind == DiffTypeMismatch && !typesCompatible(d.SourceType, d.TargetType)) {
+		event = log.Warn()
+	}
+	event.Str("schema", d.Schema).Str("table", d.Table).Str("column", d.Column).Str("kind", d.Kind).
+		Str("source_type", d.SourceType).Str("target_type", d.TargetType).Msg(d.Message)
+}
+
+// resolveCast casts a mismatched column to the target type when the table has an explicit
+// cast for it or casts automatically. A cast column no longer blocks the copy, but lossy
+// conversions are logged since values may be rounded, truncated or fail to convert.
+func resolveCast(table schema.TableInfo, d *Difference) schema.TableInfo {
+	castType, explicit := table.Cast[d.Column]
+	if !explicit {
+		if !table.AutoCast {
+			return table
+		}
+		castType = d.TargetType
+		table.Cast = maps.Clone(table.Cast)
+		if table.Cast == nil {
+			table.Cast = make(map[string]string)
+		}
+		table.Cast[d.Column] = castType
+	}
+
+	if !typesCompatible(d.SourceType, castType) {
+		log.Warn().Str("schema", d.Schema).Str("table", d.Table).Str("column", d.Column).
+			Str("source_type", d.SourceType).Str("cast", castType).
+			Msg("Lossy conversion, values may be rounded, truncated or fail to convert")
+	}
+
+	d.Blocking = false
+	d.Message = fmt.Sprintf("source values are cast to %s", castType)
+	return table
+}
+
+// alterStatement returns the statement resolving a difference on the target, if any
+func alterStatement(d Difference) string {
+	column := pgx.Identifier{d.Column}.Sanitize()
+	switch d.Kind {
+	case DiffMissingColumn:
+		return fmt.Sprintf("ALTER TABLE %s.%s ADD COLUMN %s %s", d.Schema, d.Table, column, d.SourceType)
+	case DiffTypeMismatch:
+		return fmt.Sprintf("ALTER TABLE %s.%s ALTER COLUMN %s TYPE %s USING %s::%s",
+			d.Schema, d.Table, column, d.SourceType, column, d.SourceType)
+	}
+	return ""
+}
+
+// formatDifference describes a difference on a single line
+func formatDifference(d Difference) string {
+	name := d.Schema + "." + d.Table
+	if d.Column != "" {
+		name += "." + d.Column
+	}
+	return fmt.Sprintf("%s: %s", name, d.Message)
+}
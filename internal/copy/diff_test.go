@@ -0,0 +1,213 @@
+package copy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pgcopy/internal/schema"
+)
+
+func TestCompareColumns(t *testing.T) {
+	table := schema.TableInfo{Schema: "public", Table: "users"}
+
+	tests := []struct {
+		name     string
+		table    schema.TableInfo
+		source   []ColumnInfo
+		target   []ColumnInfo
+		expected []Difference
+	}{
+		{
+			name:   "identical tables",
+			table:  table,
+			source: []ColumnInfo{{Name: "id", Type: "integer", NotNull: true}},
+			target: []ColumnInfo{{Name: "id", Type: "integer", NotNull: true}},
+		},
+		{
+			name:   "missing target table",
+			table:  table,
+			source: []ColumnInfo{{Name: "id", Type: "integer"}},
+			expected: []Difference{
+				{Schema: "public", Table: "users", Kind: DiffMissingTable, Blocking: true, Message: "table does not exist in target"},
+			},
+		},
+		{
+			name:  "missing target column",
+			table: table,
+			source: []ColumnInfo{
+				{Name: "id", Type: "integer"},
+				{Name: "nickname", Type: "text"},
+			},
+			target: []ColumnInfo{{Name: "id", Type: "integer"}},
+			expected: []Difference{
+				{Schema: "public", Table: "users", Column: "nickname", Kind: DiffMissingColumn, SourceType: "text",
+					Blocking: true, Message: "column does not exist in target"},
+			},
+		},
+		{
+			name: "ignored column missing in target",
+			table: schema.TableInfo{
+				Schema: "public",
+				Table:  "users",
+				Ignore: []string{"nickname"},
+			},
+			source: []ColumnInfo{
+				{Name: "id", Type: "integer"},
+				{Name: "nickname", Type: "text"},
+			},
+			target: []ColumnInfo{{Name: "id", Type: "integer"}},
+		},
+		{
+			name:   "extra target columns",
+			table:  table,
+			source: []ColumnInfo{{Name: "id", Type: "integer"}},
+			target: []ColumnInfo{
+				{Name: "id", Type: "integer"},
+				{Name: "created_at", Type: "timestamp with time zone", NotNull: true, HasDefault: true},
+				{Name: "tenant", Type: "text", NotNull: true},
+			},
+			expected: []Difference{
+				{Schema: "public", Table: "users", Column: "created_at", Kind: DiffExtraColumn,
+					TargetType: "timestamp with time zone", Message: "column does not exist in source, target default is used"},
+				{Schema: "public", Table: "users", Column: "tenant", Kind: DiffExtraColumn, TargetType: "text",
+					Blocking: true, Message: "column does not exist in source and is NOT NULL without a default"},
+			},
+		},
+		{
+			name:   "type and nullability differences",
+			table:  table,
+			source: []ColumnInfo{{Name: "id", Type: "bigint"}, {Name: "age", Type: "smallint"}},
+			target: []ColumnInfo{{Name: "id", Type: "integer"}, {Name: "age", Type: "integer", NotNull: true}},
+			expected: []Difference{
+				{Schema: "public", Table: "users", Column: "id", Kind: DiffTypeMismatch, SourceType: "bigint",
+					TargetType: "integer", Message: "target type may not hold all source values"},
+				{Schema: "public", Table: "users", Column: "age", Kind: DiffTypeMismatch, SourceType: "smallint",
+					TargetType: "integer", Message: "target type is wider than source type"},
+				{Schema: "public", Table: "users", Column: "age", Kind: DiffNullability, SourceType: "smallint",
+					TargetType: "integer", Message: "column is nullable in source but NOT NULL in target"},
+			},
+		},
+		{
+			name:  "narrower types block in fail mode",
+			table: schema.TableInfo{Schema: "public", Table: "users", SchemaCheck: schema.SchemaCheckFail},
+			source: []ColumnInfo{
+				{Name: "id", Type: "bigint"},
+				{Name: "name", Type: "text"},
+				{Name: "created_at", Type: "timestamp without time zone"},
+			},
+			target: []ColumnInfo{
+				{Name: "id", Type: "integer"},
+				{Name: "name", Type: "character varying(100)"},
+				{Name: "created_at", Type: "timestamp with time zone"},
+			},
+			expected: []Difference{
+				{Schema: "public", Table: "users", Column: "id", Kind: DiffTypeMismatch, SourceType: "bigint",
+					TargetType: "integer", Blocking: true, Message: "target type may not hold all source values"},
+				{Schema: "public", Table: "users", Column: "name", Kind: DiffTypeMismatch, SourceType: "text",
+					TargetType: "character varying(100)", Blocking: true, Message: "target type may not hold all source values"},
+				{Schema: "public", Table: "users", Column: "created_at", Kind: DiffTypeMismatch, SourceType: "timestamp without time zone",
+					TargetType: "timestamp with time zone", Blocking: true, Message: "target type may not hold all source values"},
+			},
+		},
+		{
+			name:  "narrower types only warn by default",
+			table: table,
+			source: []ColumnInfo{
+				{Name: "name", Type: "character varying(255)"},
+				{Name: "email", Type: "character varying"},
+			},
+			target: []ColumnInfo{
+				{Name: "name", Type: "character varying(100)"},
+				{Name: "email", Type: "citext"},
+			},
+			expected: []Difference{
+				{Schema: "public", Table: "users", Column: "name", Kind: DiffTypeMismatch, SourceType: "character varying(255)",
+					TargetType: "character varying(100)", Message: "target type may not hold all source values"},
+				{Schema: "public", Table: "users", Column: "email", Kind: DiffTypeMismatch, SourceType: "character varying",
+					TargetType: "citext", Message: "target type may not hold all source values"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, compareColumns(tt.table, tt.source, tt.target))
+		})
+	}
+}
+
+func TestTypesCompatible(t *testing.T) {
+	tests := []struct {
+		source   string
+		target   string
+		expected bool
+	}{
+		{"integer", "integer", true},
+		{"integer", "bigint", true},
+		{"bigint", "integer", false},
+		{"integer", "text", true},
+		{"text", "character varying(50)", false},
+		{"character varying(50)", "character varying(100)", true},
+		{"character varying(100)", "character varying(50)", false},
+		{"character varying(100)", "character varying", true},
+		{"character(10)", "character varying(10)", true},
+		{"numeric(10,2)", "numeric(12,2)", true},
+		{"numeric(10,2)", "numeric(10,3)", false},
+		{"numeric(10,2)", "numeric", true},
+		{"numeric", "numeric(10,2)", false},
+		{"integer", "numeric(5,0)", false},
+		{"json", "jsonb", true},
+		{"jsonb", "json", false},
+		{"integer[]", "bigint[]", true},
+		{"integer[]", "integer", false},
+		{"uuid", "integer", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source+" to "+tt.target, func(t *testing.T) {
+			assert.Equal(t, tt.expected, typesCompatible(tt.source, tt.target))
+		})
+	}
+}
+
+func TestAlterStatement(t *testing.T) {
+	assert.Equal(t,
+		`ALTER TABLE public.users ADD COLUMN "nickname" character varying(50)`,
+		alterStatement(Difference{Schema: "public", Table: "users", Column: "nickname", Kind: DiffMissingColumn,
+			SourceType: "character varying(50)"}))
+	assert.Equal(t,
+		`ALTER TABLE public.users ALTER COLUMN "id" TYPE bigint USING "id"::bigint`,
+		alterStatement(Difference{Schema: "public", Table: "users", Column: "id", Kind: DiffTypeMismatch,
+			SourceType: "bigint", TargetType: "integer"}))
+	assert.Empty(t, alterStatement(Difference{Schema: "public", Table: "users", Kind: DiffMissingTable}))
+}
+
+func TestResolveCast(t *testing.T) {
+	mismatch := Difference{
+		Schema: "public", Table: "events", Column: "id", Kind: DiffTypeMismatch,
+		SourceType: "bigint", TargetType: "integer", Blocking: true,
+	}
+
+	// Without auto_cast or an explicit cast the difference is unchanged
+	d := mismatch
+	table := resolveCast(schema.TableInfo{Schema: "public", Table: "events"}, &d)
+	assert.True(t, d.Blocking)
+	assert.Nil(t, table.Cast)
+
+	// auto_cast casts to the target type
+	d = mismatch
+	explicit := map[string]string{"created_at": "timestamptz"}
+	table = resolveCast(schema.TableInfo{Schema: "public", Table: "events", AutoCast: true, Cast: explicit}, &d)
+	assert.False(t, d.Blocking)
+	assert.Equal(t, map[string]string{"id": "integer", "created_at": "timestamptz"}, table.Cast)
+	assert.Equal(t, map[string]string{"created_at": "timestamptz"}, explicit, "configured casts must not be modified")
+
+	// An explicit cast wins over auto_cast
+	d = mismatch
+	table = resolveCast(schema.TableInfo{Schema: "public", Table: "events", AutoCast: true,
+		Cast: map[string]string{"id": "numeric"}}, &d)
+	assert.False(t, d.Blocking)
+	assert.Equal(t, "numeric", table.Cast["id"])
+	assert.Equal(t, "source values are cast to numeric", d.Message)
+}
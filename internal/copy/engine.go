@@ -2,16 +2,22 @@ package copy
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"slices"
 	"strings"
 	"time"
 
-	"github.com/rs/zerolog/log"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"pgcopy/internal/db"
+	"pgcopy/internal/log"
 	"pgcopy/internal/schema"
+	"pgcopy/internal/tracing"
 )
 
 // Engine represents the copy engine
@@ -31,15 +37,18 @@ type Stats struct {
 }
 
 // NewEngine creates a new copy engine
-func NewEngine(sourceURL, targetURL string) (*Engine, error) {
-	ctx := context.Background()
+func NewEngine(ctx context.Context, sourceURL, targetURL string) (*Engine, error) {
+	return NewEngineWithOptions(ctx, sourceURL, db.Options{}, targetURL, db.Options{})
+}
 
-	sourceConn, err := db.NewConnection(ctx, sourceURL)
+// NewEngineWithOptions creates a new copy engine with per-database connection options
+func NewEngineWithOptions(ctx context.Context, sourceURL string, sourceOpts db.Options, targetURL string, targetOpts db.Options) (*Engine, error) {
+	sourceConn, err := db.NewConnectionWithOptions(ctx, sourceURL, sourceOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to source database: %w", err)
 	}
 
-	targetConn, err := db.NewConnection(ctx, targetURL)
+	targetConn, err := db.NewConnectionWithOptions(ctx, targetURL, targetOpts)
 	if err != nil {
 		sourceConn.Close()
 		return nil, fmt.Errorf("failed to connect to target database: %w", err)
@@ -54,6 +63,36 @@ func NewEngine(sourceURL, targetURL string) (*Engine, error) {
 	}, nil
 }
 
+// NewSourceEngine creates an engine connected only to a source database, used to export tables
+func NewSourceEngine(ctx context.Context, sourceURL string, sourceOpts db.Options) (*Engine, error) {
+	sourceConn, err := db.NewConnectionWithOptions(ctx, sourceURL, sourceOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to source database: %w", err)
+	}
+
+	return &Engine{
+		sourceConn: sourceConn,
+		stats: &Stats{
+			StartTime: time.Now(),
+		},
+	}, nil
+}
+
+// NewTargetEngine creates an engine connected only to a target database, used to import tables
+func NewTargetEngine(ctx context.Context, targetURL string, targetOpts db.Options) (*Engine, error) {
+	targetConn, err := db.NewConnectionWithOptions(ctx, targetURL, targetOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to target database: %w", err)
+	}
+
+	return &Engine{
+		targetConn: targetConn,
+		stats: &Stats{
+			StartTime: time.Now(),
+		},
+	}, nil
+}
+
 // Close closes the engine and all connections
 func (e *Engine) Close() {
 	if e.sourceConn != nil {
@@ -69,6 +108,16 @@ func (e *Engine) Copy(ctx context.Context, config *schema.Config) error {
 	tables := config.GetAllTables()
 	log.Info().Int("total_tables", len(tables)).Msg("Starting copy operation")
 
+	ctx, span := tracing.Tracer().Start(ctx, "copy.run", trace.WithAttributes(
+		tracing.AttrTables.Int(len(tables)),
+	))
+	defer span.End()
+
+	if err := e.enforcePolicy(ctx, tables); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+
 	// Process tables concurrently
 	for _, table := range tables {
 
@@ -83,37 +132,53 @@ func (e *Engine) Copy(ctx context.Context, config *schema.Config) error {
 
 	e.stats.EndTime = time.Now()
 
+	span.SetAttributes(
+		tracing.AttrRowsCopied.Int64(e.stats.RowsCopied),
+		tracing.AttrErrors.Int(len(e.stats.Errors)),
+	)
+
 	e.printSummary()
 	return nil
 }
 
-// DryRun shows what would be copied without executing
-func (e *Engine) DryRun(ctx context.Context, config *schema.Config) error {
-	tables := config.GetAllTables()
-
-	log.Info().Int("total_tables", len(tables)).Msg("DRY RUN - Tables that would be copied:")
+// DryRun resolves what a copy would do without executing it, logging the plan of
+// every table and any reason its copy would fail
+func (e *Engine) DryRun(ctx context.Context, config *schema.Config) (*Plan, error) {
+	plan, err := e.Plan(ctx, config)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, table := range tables {
-		log.Info().
-			Str("schema", table.Schema).
+	log.Info().Int("total_tables", len(plan.Tables)).Msg("DRY RUN - Tables that would be copied:")
+	for _, table := range plan.Tables {
+		event := log.Info()
+		if table.Error != "" {
+			event = log.Warn().Str("error", table.Error)
+		}
+		event.Str("schema", table.Schema).
 			Str("table", table.Table).
-			Strs("ignore", table.Ignore).
-			Str("filter", table.Filter).
-			Bool("truncate", table.Truncate).
-			Msg("Table configuration")
+			Int("columns", len(table.Columns)).
+			Int64("estimated_rows", table.EstimatedRows).
+			Int64("estimated_bytes", table.EstimatedBytes).
+			Strs("truncate_cascade", table.TruncateCascade).
+			Msg("Table plan")
 	}
 
-	return nil
+	return plan, nil
 }
 
 // copyTable copies a single table using COPY protocol
-func (e *Engine) copyTable(ctx context.Context, table schema.TableInfo) error {
-	// Truncate target table if requested
-	if table.Truncate {
-		if err := e.truncateTable(ctx, table); err != nil {
-			return fmt.Errorf("failed to truncate table %s.%s: %w", table.Schema, table.Table, err)
-		}
-		log.Info().Str("schema", table.Schema).Str("table", table.Table).Msg("Table truncated before copy")
+func (e *Engine) copyTable(ctx context.Context, table schema.TableInfo) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.table", trace.WithAttributes(tableAttributes(table)...))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	// Compare source and target columns before touching the target
+	table, err = e.checkSchema(ctx, table)
+	if err != nil {
+		return err
 	}
 
 	// Build column list
@@ -132,6 +197,46 @@ func (e *Engine) copyTable(ctx context.Context, table schema.TableInfo) error {
 		return fmt.Errorf("failed to build target copy query: %w", err)
 	}
 
+	return e.loadTable(ctx, table, sourceQuery, targetQuery)
+}
+
+// loadTable runs the COPY statements of a table, with the truncate, index rebuild,
+// statistics and sequence steps its settings ask for
+func (e *Engine) loadTable(ctx context.Context, table schema.TableInfo, sourceQuery, targetQuery string) (err error) {
+	// Truncate target table if requested
+	if table.Truncate {
+		if err := e.truncateTable(ctx, table); err != nil {
+			return fmt.Errorf("failed to truncate table %s.%s: %w", table.Schema, table.Table, err)
+		}
+		log.Info().Str("schema", table.Schema).Str("table", table.Table).Msg("Table truncated before copy")
+	}
+
+	// Refresh statistics once the load succeeded. Deferred before the index rebuild so it
+	// runs after the indexes are back and expression indexes get statistics too.
+	if table.LoadSettings.AnalyzeEnabled() {
+		defer func() {
+			if err != nil {
+				return
+			}
+			if analyzeErr := e.analyzeTable(ctx, table); analyzeErr != nil {
+				log.Warn().Err(analyzeErr).Str("schema", table.Schema).Str("table", table.Table).Msg("Failed to analyze table")
+			}
+		}()
+	}
+
+	// Drop indexes and constraints for the duration of the load, restoring them even on failure
+	if table.RebuildIndexes {
+		indexes, err := e.dropIndexes(ctx, table)
+		if err != nil {
+			return fmt.Errorf("failed to drop indexes: %w", err)
+		}
+		defer func() {
+			if restoreErr := e.restoreIndexes(ctx, table, indexes); restoreErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to restore indexes: %w", restoreErr))
+			}
+		}()
+	}
+
 	log.Debug().
 		Str("schema", table.Schema).
 		Str("table", table.Table).
@@ -140,11 +245,61 @@ func (e *Engine) copyTable(ctx context.Context, table schema.TableInfo) error {
 		Msg("Executing COPY")
 
 	// Execute copy using native COPY protocol
-	return e.executeCopyWithProtocol(ctx, sourceQuery, targetQuery)
+	if err := e.executeCopyWithProtocol(ctx, table, sourceQuery, targetQuery); err != nil {
+		return err
+	}
+
+	// Advance target sequences past the copied values
+	if err := e.syncSequences(ctx, table); err != nil {
+		return fmt.Errorf("failed to synchronize sequences: %w", err)
+	}
+
+	return nil
 }
 
 // getTableColumns gets the columns for a table
-func (e *Engine) getTableColumns(ctx context.Context, table schema.TableInfo) ([]string, error) {
+func (e *Engine) getTableColumns(ctx context.Context, table schema.TableInfo) (columns []string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.discover_columns", trace.WithAttributes(tableAttributes(table)...))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.SetAttributes(tracing.AttrColumns.Int(len(columns)))
+		span.End()
+	}()
+
+	if table.Query != "" {
+		return e.getQueryColumns(ctx, table)
+	}
+	return tableColumns(ctx, e.sourceConn.GetPool(), table)
+}
+
+// getQueryColumns returns the result columns of a table's source query that are not ignored
+func (e *Engine) getQueryColumns(ctx context.Context, table schema.TableInfo) ([]string, error) {
+	conn, err := e.sourceConn.GetPool().Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire source connection: %w", err)
+	}
+	defer conn.Release()
+
+	fields, err := resultFields(ctx, conn.Conn(), table.Query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe source query: %w", err)
+	}
+
+	var columns []string
+	for _, field := range fields {
+		// Columns are matched to the target by name, so every one needs a distinct name
+		if field.Name == "?column?" || slices.Contains(columns, field.Name) {
+			return nil, fmt.Errorf("source query returns column %q more than once or unnamed, alias every column", field.Name)
+		}
+		if !slices.Contains(table.Ignore, field.Name) {
+			columns = append(columns, field.Name)
+		}
+	}
+	return columns, nil
+}
+
+// tableColumns lists the columns of a table that are not ignored
+func tableColumns(ctx context.Context, pool *pgxpool.Pool, table schema.TableInfo) (columns []string, err error) {
 	query := `
 		SELECT column_name 
 		FROM information_schema.columns 
@@ -152,13 +307,12 @@ func (e *Engine) getTableColumns(ctx context.Context, table schema.TableInfo) ([
 		ORDER BY ordinal_position
 	`
 
-	rows, err := e.sourceConn.GetPool().Query(ctx, query, table.Schema, table.Table)
+	rows, err := pool.Query(ctx, query, table.Schema, table.Table)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var columns []string
 	for rows.Next() {
 		var column string
 		if err := rows.Scan(&column); err != nil {
@@ -176,34 +330,107 @@ func (e *Engine) getTableColumns(ctx context.Context, table schema.TableInfo) ([
 
 // buildSourceCopyQuery builds the source COPY query
 func (e *Engine) buildSourceCopyQuery(table schema.TableInfo, columns []string) (string, error) {
+	query, err := e.buildSourceSelectQuery(table, columns)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("COPY (%s) TO STDOUT", query), nil
+}
+
+// buildSourceSelectQuery builds the query selecting the copied columns, with
+// transformations, casts and the filter applied
+func (e *Engine) buildSourceSelectQuery(table schema.TableInfo, columns []string) (string, error) {
 	if len(columns) == 0 {
 		return "", fmt.Errorf("no columns to copy for table %s.%s", table.Schema, table.Table)
 	}
 
-	// Build column list with transformations
+	// Build column list with transformations and casts
 	var columnList []string
 	for _, col := range columns {
-		if transformation, exists := table.Transform[col]; exists {
+		transformation, transformed := table.Transform[col]
+		castType, cast := table.Cast[col]
+
+		var transformedCol string
+		if transformed {
+			var err error
+			transformedCol, err = e.transformExpression(table, transformation, col)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		switch {
+		case transformed && cast:
+			// Cast the result of the transformation
+			columnList = append(columnList, fmt.Sprintf("(%s)::%s AS %s", transformedCol, castType, col))
+		case transformed:
 			// Apply transformation
-			transformedCol := e.expandTransformation(transformation, col)
 			columnList = append(columnList, fmt.Sprintf("%s AS %s", transformedCol, col))
-		} else {
+		case cast:
+			columnList = append(columnList, fmt.Sprintf("%s::%s AS %s", col, castType, col))
+		default:
 			// Use column as-is
 			columnList = append(columnList, col)
 		}
 	}
 
-	query := fmt.Sprintf("COPY (SELECT %s FROM %s.%s) TO STDOUT",
-		formatColumns(columnList), table.Schema, table.Table)
+	query := fmt.Sprintf("SELECT %s FROM %s", formatColumns(columnList), sourceRelation(table))
 
 	if table.Filter != "" {
-		query = fmt.Sprintf("COPY (SELECT %s FROM %s.%s WHERE %s) TO STDOUT",
-			formatColumns(columnList), table.Schema, table.Table, table.Filter)
+		query = fmt.Sprintf("SELECT %s FROM %s WHERE %s", formatColumns(columnList), sourceRelation(table), table.Filter)
 	}
 
 	return query, nil
 }
 
+// sourceRelation returns what a table is read from, the source table or its query
+func sourceRelation(table schema.TableInfo) string {
+	if table.Query != "" {
+		return fmt.Sprintf("(%s) AS src", table.Query)
+	}
+	return fmt.Sprintf("%s.%s", table.Schema, table.Table)
+}
+
+// transformExpression returns the SQL expression transforming a column, resolving
+// lookups from the table's configuration
+func (e *Engine) transformExpression(table schema.TableInfo, transformation string, columnName string) (string, error) {
+	name, ok := schema.LookupName(transformation)
+	if !ok {
+		return e.expandTransformation(transformation, columnName), nil
+	}
+
+	lookup, ok := table.Lookups[name]
+	if !ok {
+		return "", fmt.Errorf("column %s uses undefined lookup '%s'", columnName, name)
+	}
+	return lookupExpression(name, lookup, columnName), nil
+}
+
+// lookupExpression replaces a column's values from a dictionary. The dictionary is read
+// from a session setting of the source connection, see prepareSourceSession, so its
+// values never appear in statements, logs or plans. The subquery parses it once per
+// statement. NULLs stay NULL, other missing keys get the lookup's default.
+func lookupExpression(name string, lookup schema.Lookup, columnName string) string {
+	expr := fmt.Sprintf("(SELECT current_setting('%s')::jsonb) ->> %s::text", lookupSetting(name), columnName)
+	if lookup.Default == nil {
+		return expr
+	}
+	return fmt.Sprintf("CASE WHEN %s IS NULL THEN NULL ELSE COALESCE(%s, %s) END",
+		columnName, expr, quoteLiteral(*lookup.Default))
+}
+
+// lookupSetting returns the session setting holding a lookup's dictionary. The name is
+// hex encoded since setting names only take identifier characters.
+func lookupSetting(name string) string {
+	return "pgcopy.lookup_" + hex.EncodeToString([]byte(name))
+}
+
+// quoteLiteral quotes a string as an SQL literal
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
 // expandTransformation expands built-in transformation functions or applies custom SQL
 func (e *Engine) expandTransformation(transformation string, columnName string) string {
 	switch transformation {
@@ -236,10 +463,14 @@ func (e *Engine) buildTargetCopyQuery(table schema.TableInfo, columns []string)
 }
 
 // truncateTable truncates the target table
-func (e *Engine) truncateTable(ctx context.Context, table schema.TableInfo) error {
-	query := fmt.Sprintf("TRUNCATE TABLE %s.%s CASCADE", table.Schema, table.Table)
+func (e *Engine) truncateTable(ctx context.Context, table schema.TableInfo) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.truncate", trace.WithAttributes(tableAttributes(table)...))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
 
-	_, err := e.targetConn.GetPool().Exec(ctx, query)
+	_, err = e.targetConn.GetPool().Exec(ctx, truncateStatement(table))
 	if err != nil {
 		return fmt.Errorf("failed to execute truncate: %w", err)
 	}
@@ -247,8 +478,13 @@ func (e *Engine) truncateTable(ctx context.Context, table schema.TableInfo) erro
 	return nil
 }
 
+// truncateStatement returns the statement emptying the target table
+func truncateStatement(table schema.TableInfo) string {
+	return fmt.Sprintf("TRUNCATE TABLE %s.%s CASCADE", table.Schema, table.Table)
+}
+
 // executeCopyWithProtocol executes the copy operation using native COPY protocol
-func (e *Engine) executeCopyWithProtocol(ctx context.Context, sourceQuery, targetQuery string) error {
+func (e *Engine) executeCopyWithProtocol(ctx context.Context, table schema.TableInfo, sourceQuery, targetQuery string) error {
 	// Get connections
 	sourceConn, err := e.sourceConn.GetPool().Acquire(ctx)
 	if err != nil {
@@ -256,12 +492,25 @@ func (e *Engine) executeCopyWithProtocol(ctx context.Context, sourceQuery, targe
 	}
 	defer sourceConn.Release()
 
+	restoreSource, err := prepareSourceSession(ctx, sourceConn.Conn(), table)
+	if err != nil {
+		return fmt.Errorf("failed to prepare source session: %w", err)
+	}
+	defer restoreSource()
+
 	targetConn, err := e.targetConn.GetPool().Acquire(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to acquire target connection: %w", err)
 	}
 	defer targetConn.Release()
 
+	// Apply per-table session settings, reverting them whatever the outcome
+	restoreSession, err := e.prepareTargetSession(ctx, targetConn.Conn(), table)
+	if err != nil {
+		return fmt.Errorf("failed to prepare target session: %w", err)
+	}
+	defer restoreSession()
+
 	// Create a pipe to stream data between source and target
 	r, w := io.Pipe()
 
@@ -282,11 +531,20 @@ func (e *Engine) executeCopyWithProtocol(ctx context.Context, sourceQuery, targe
 
 	rowsCopied := commandTag.RowsAffected()
 	e.incrementRowsCopied(rowsCopied)
+	trace.SpanFromContext(ctx).SetAttributes(tracing.AttrRowsCopied.Int64(rowsCopied))
 	log.Info().Int64("rows_copied", rowsCopied).Msg("Table copy completed")
 
 	return nil
 }
 
+// tableAttributes returns the span attributes identifying a table
+func tableAttributes(table schema.TableInfo) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		tracing.AttrSchema.String(table.Schema),
+		tracing.AttrTable.String(table.Table),
+	}
+}
+
 // formatColumns formats column names for SQL
 func formatColumns(columns []string) string {
 	if len(columns) == 0 {
@@ -49,6 +49,27 @@ func TestEngine_buildSourceCopyQuery(t *testing.T) {
 			columns:  []string{"id"},
 			expected: "COPY (SELECT id FROM public.users) TO STDOUT",
 		},
+		{
+			name: "cast columns",
+			table: schema.TableInfo{
+				Schema: "public",
+				Table:  "events",
+				Cast:   map[string]string{"id": "bigint", "created_at": "timestamptz"},
+			},
+			columns:  []string{"id", "name", "created_at"},
+			expected: "COPY (SELECT id::bigint AS id, name, created_at::timestamptz AS created_at FROM public.events) TO STDOUT",
+		},
+		{
+			name: "cast transformed column",
+			table: schema.TableInfo{
+				Schema:    "public",
+				Table:     "users",
+				Transform: map[string]string{"id": "id + 1000"},
+				Cast:      map[string]string{"id": "bigint"},
+			},
+			columns:  []string{"id"},
+			expected: "COPY (SELECT (id + 1000)::bigint AS id FROM public.users) TO STDOUT",
+		},
 		{
 			name: "no columns",
 			table: schema.TableInfo{
@@ -211,8 +232,17 @@ func TestEngine_DryRun(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err := engine.DryRun(ctx, config)
-	assert.NoError(t, err)
+	plan, err := engine.DryRun(ctx, config)
+	require.NoError(t, err)
+
+	// Without connections the tables are listed but cannot be resolved
+	require.Len(t, plan.Tables, 2)
+	assert.Equal(t, "users", plan.Tables[0].Table)
+	assert.Equal(t, "products", plan.Tables[1].Table)
+	for _, table := range plan.Tables {
+		assert.NotEmpty(t, table.Error)
+		assert.Equal(t, int64(-1), table.EstimatedRows)
+	}
 }
 
 func TestEngine_Close(t *testing.T) {
@@ -271,6 +301,62 @@ func TestBuildSourceCopyQueryWithFilterAndTransform(t *testing.T) {
 	assert.Equal(t, expected, query)
 }
 
+func TestBuildSourceCopyQueryWithQuery(t *testing.T) {
+	engine := &Engine{}
+
+	table := schema.TableInfo{
+		Schema: "staging",
+		Table:  "order_summaries",
+		Query:  "SELECT o.id, u.email, o.total FROM public.orders o JOIN public.users u ON u.id = o.user_id",
+		Filter: "total > 100",
+		Transform: map[string]string{
+			"email": "hash",
+		},
+	}
+
+	columns := []string{"id", "email", "total"}
+
+	query, err := engine.buildSourceCopyQuery(table, columns)
+	require.NoError(t, err)
+
+	expected := "COPY (SELECT id, encode(sha256(email::text::bytea), 'hex') AS email, total FROM (SELECT o.id, u.email, o.total FROM public.orders o JOIN public.users u ON u.id = o.user_id) AS src WHERE total > 100) TO STDOUT"
+	assert.Equal(t, expected, query)
+}
+
+func TestBuildSourceCopyQueryWithLookup(t *testing.T) {
+	engine := &Engine{}
+	unknown := "UNKNOWN"
+
+	table := schema.TableInfo{
+		Schema: "public",
+		Table:  "customers",
+		Transform: map[string]string{
+			"code":   "lookup:codes",
+			"region": "lookup:regions",
+		},
+		Cast: map[string]string{
+			"region": "varchar(20)",
+		},
+		Lookups: map[string]schema.Lookup{
+			"codes":   {Values: map[string]string{"C-1": "Acme", "C-2": "O'Neil & Co"}, Default: &unknown},
+			"regions": {Values: map[string]string{"1": "north"}},
+		},
+	}
+
+	query, err := engine.buildSourceCopyQuery(table, []string{"id", "code", "region"})
+	require.NoError(t, err)
+
+	// Dictionaries are read from session settings, never inlined in the statement
+	expected := `COPY (SELECT id, CASE WHEN code IS NULL THEN NULL ELSE COALESCE((SELECT current_setting('pgcopy.lookup_636f646573')::jsonb) ->> code::text, 'UNKNOWN') END AS code, ` +
+		`((SELECT current_setting('pgcopy.lookup_726567696f6e73')::jsonb) ->> region::text)::varchar(20) AS region FROM public.customers) TO STDOUT`
+	assert.Equal(t, expected, query)
+	assert.NotContains(t, query, "Acme")
+
+	table.Transform["code"] = "lookup:missing"
+	_, err = engine.buildSourceCopyQuery(table, []string{"id", "code"})
+	assert.ErrorContains(t, err, "undefined lookup 'missing'")
+}
+
 func TestExpandTransformation(t *testing.T) {
 	engine := &Engine{}
 
@@ -360,3 +446,9 @@ func TestTruncateTable(t *testing.T) {
 	actualQuery := fmt.Sprintf("TRUNCATE TABLE %s.%s", table.Schema, table.Table)
 	assert.Equal(t, expectedQuery, actualQuery)
 }
+
+func TestSequenceMode(t *testing.T) {
+	assert.Equal(t, schema.SequencesMax, sequenceMode(schema.TableInfo{}))
+	assert.Equal(t, schema.SequencesSource, sequenceMode(schema.TableInfo{Sequences: schema.SequencesSource}))
+	assert.Equal(t, schema.SequencesSkip, sequenceMode(schema.TableInfo{Sequences: schema.SequencesSkip}))
+}
@@ -0,0 +1,285 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/trace"
+
+	"pgcopy/internal/log"
+	"pgcopy/internal/schema"
+	"pgcopy/internal/storage"
+	"pgcopy/internal/tracing"
+)
+
+// Export file formats
+const (
+	FormatCSV     = "csv"
+	FormatTSV     = "tsv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+// ExportOptions configures how tables are written to files
+type ExportOptions struct {
+	// Format is the file format, FormatCSV by default
+	Format string
+	// Header writes a header row to CSV and TSV files
+	Header bool
+	// Compression compresses every file with storage.CompressionGzip or storage.CompressionZstd.
+	// Parquet files use it as the codec of their pages instead.
+	Compression string
+	// CompressionLevel is the algorithm's compression level, 0 for its default
+	CompressionLevel int
+	// RowGroupSize is the number of rows per Parquet row group, DefaultRowGroupSize if 0
+	RowGroupSize int64
+}
+
+// ValidateFormat returns an error if format is not a known export format
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatCSV, FormatTSV, FormatJSONL, FormatParquet:
+		return nil
+	}
+	return fmt.Errorf("invalid format '%s' (expected %s, %s, %s or %s)", format, FormatCSV, FormatTSV, FormatJSONL, FormatParquet)
+}
+
+// describeColumnsQuery formats the type of every column of a query result
+const describeColumnsQuery = `
+	SELECT format_type(t.oid, t.typmod)
+	FROM unnest($1::oid[], $2::int[]) WITH ORDINALITY AS t(oid, typmod, position)
+	ORDER BY t.position
+`
+
+// Export writes each configured table to a file in the storage, followed by a manifest
+// describing the files. Tables that fail are logged and left out of the manifest.
+func (e *Engine) Export(ctx context.Context, config *schema.Config, store storage.Storage, opts ExportOptions) error {
+	if opts.Format == "" {
+		opts.Format = FormatCSV
+	}
+	if err := ValidateFormat(opts.Format); err != nil {
+		return err
+	}
+	if err := storage.ValidateCompression(opts.Compression); err != nil {
+		return err
+	}
+	if opts.Compression == storage.CompressionNone {
+		opts.Compression = ""
+	}
+
+	tables := config.GetAllTables()
+	log.Info().Int("total_tables", len(tables)).Str("location", store.String()).Str("format", opts.Format).
+		Msg("Starting export operation")
+
+	ctx, span := tracing.Tracer().Start(ctx, "copy.export", trace.WithAttributes(
+		tracing.AttrTables.Int(len(tables)),
+	))
+	defer span.End()
+
+	if err := e.enforcePolicy(ctx, tables); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+
+	manifest := &Manifest{
+		Version:     manifestVersion,
+		CreatedAt:   time.Now().UTC(),
+		Format:      opts.Format,
+		Header:      opts.Header && (opts.Format == FormatCSV || opts.Format == FormatTSV),
+		Compression: opts.Compression,
+		Tables:      []ManifestTable{},
+	}
+
+	for _, table := range tables {
+		entry, err := e.exportTable(ctx, table, store, opts)
+		if err != nil {
+			e.addError(err)
+			log.Error().Err(err).Str("schema", table.Schema).Str("table", table.Table).Msg("Failed to export table")
+			continue
+		}
+
+		manifest.Tables = append(manifest.Tables, *entry)
+		e.incrementTablesProcessed()
+		log.Info().Str("schema", table.Schema).Str("table", table.Table).Str("file", entry.File).Msg("Table exported successfully")
+	}
+
+	if err := writeManifest(ctx, store, manifest); err != nil {
+		tracing.RecordError(span, err)
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	e.stats.EndTime = time.Now()
+
+	span.SetAttributes(
+		tracing.AttrRowsCopied.Int64(e.stats.RowsCopied),
+		tracing.AttrErrors.Int(len(e.stats.Errors)),
+	)
+
+	e.printSummary()
+	return nil
+}
+
+// exportTable writes a single table to a file and returns its manifest entry
+func (e *Engine) exportTable(ctx context.Context, table schema.TableInfo, store storage.Storage, opts ExportOptions) (entry *ManifestTable, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.export_table", trace.WithAttributes(tableAttributes(table)...))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	columns, err := e.getTableColumns(ctx, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table columns: %w", err)
+	}
+
+	selectQuery, err := e.buildSourceSelectQuery(table, columns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build source query: %w", err)
+	}
+
+	conn, err := e.sourceConn.GetPool().Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire source connection: %w", err)
+	}
+	defer conn.Release()
+
+	restoreSource, err := prepareSourceSession(ctx, conn.Conn(), table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare source session: %w", err)
+	}
+	defer restoreSource()
+
+	// Record the types of the exported values, which transformations and casts may change
+	manifestColumns, err := describeColumns(ctx, conn.Conn(), selectQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe columns: %w", err)
+	}
+
+	entry = &ManifestTable{
+		Schema:  table.Schema,
+		Table:   table.Table,
+		File:    exportFileName(table, opts.Format, opts.Compression),
+		Columns: manifestColumns,
+	}
+
+	file, err := store.Create(ctx, entry.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", entry.File, err)
+	}
+
+	if opts.Format == FormatParquet {
+		// Parquet compresses its pages itself, so the file is written as is
+		log.Debug().Str("schema", table.Schema).Str("table", table.Table).Str("query", selectQuery).Msg("Executing export")
+		entry.Rows, err = writeParquet(ctx, conn.Conn(), file, table.Table, selectQuery, opts)
+		if err != nil {
+			file.Abort(err)
+		} else {
+			err = file.Close()
+		}
+	} else {
+		query := exportCopyQuery(selectQuery, opts)
+		log.Debug().Str("schema", table.Schema).Str("table", table.Table).Str("query", query).Msg("Executing export")
+		entry.Rows, err = exportCopy(ctx, conn.Conn(), file, query, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to export to %s: %w", entry.File, err)
+	}
+
+	e.incrementRowsCopied(entry.Rows)
+	span.SetAttributes(tracing.AttrRowsCopied.Int64(entry.Rows))
+	log.Info().Int64("rows_exported", entry.Rows).Msg("Table export completed")
+
+	return entry, nil
+}
+
+// exportCopy streams a COPY TO query into a file, compressing it as configured. The file
+// is aborted if the export fails, so no partial file is left behind.
+func exportCopy(ctx context.Context, conn *pgx.Conn, file storage.File, query string, opts ExportOptions) (int64, error) {
+	w, err := storage.NewWriter(file, opts.Compression, opts.CompressionLevel)
+	if err != nil {
+		file.Abort(err)
+		return 0, err
+	}
+
+	commandTag, err := conn.PgConn().CopyTo(ctx, w, query)
+	if err != nil {
+		file.Abort(err)
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	return commandTag.RowsAffected(), nil
+}
+
+// describeColumns returns the names and types of the columns a query returns
+func describeColumns(ctx context.Context, conn *pgx.Conn, query string) ([]ManifestColumn, error) {
+	fields, err := resultFields(ctx, conn, query)
+	if err != nil {
+		return nil, err
+	}
+
+	oids := make([]uint32, len(fields))
+	typmods := make([]int32, len(fields))
+	for i, field := range fields {
+		oids[i] = field.DataTypeOID
+		typmods[i] = field.TypeModifier
+	}
+
+	typeRows, err := conn.Query(ctx, describeColumnsQuery, oids, typmods)
+	if err != nil {
+		return nil, err
+	}
+	types, err := pgx.CollectRows(typeRows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]ManifestColumn, len(fields))
+	for i, field := range fields {
+		columns[i] = ManifestColumn{Name: field.Name, Type: types[i]}
+	}
+	return columns, nil
+}
+
+// resultFields returns the field descriptions of the columns a query returns
+func resultFields(ctx context.Context, conn *pgx.Conn, query string) ([]pgconn.FieldDescription, error) {
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT * FROM (%s) t LIMIT 0", query))
+	if err != nil {
+		return nil, err
+	}
+	// The descriptions belong to the result and are reused by the next query
+	fields := slices.Clone(rows.FieldDescriptions())
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// exportFileName returns the name of the file a table is exported to. Compressed Parquet
+// files keep their extension since the compression is internal to the format.
+func exportFileName(table schema.TableInfo, format, compression string) string {
+	if format == FormatParquet {
+		compression = ""
+	}
+	return fmt.Sprintf("%s.%s.%s%s", table.Schema, table.Table, format, storage.Extension(compression))
+}
+
+// exportCopyQuery wraps a select query in the COPY statement writing the export format.
+// JSON Lines are produced as CSV with quote and delimiter characters that cannot appear
+// in jsonb text output, so every line is written verbatim.
+func exportCopyQuery(selectQuery string, opts ExportOptions) string {
+	switch opts.Format {
+	case FormatJSONL:
+		return fmt.Sprintf(`COPY (SELECT to_jsonb(t)::text FROM (%s) t) TO STDOUT WITH (FORMAT csv, QUOTE E'\x01', DELIMITER E'\x02')`, selectQuery)
+	case FormatTSV:
+		return fmt.Sprintf(`COPY (%s) TO STDOUT WITH (FORMAT csv, DELIMITER E'\t', HEADER %t)`, selectQuery, opts.Header)
+	default:
+		return fmt.Sprintf("COPY (%s) TO STDOUT WITH (FORMAT csv, HEADER %t)", selectQuery, opts.Header)
+	}
+}
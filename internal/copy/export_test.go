@@ -0,0 +1,92 @@
+package copy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pgcopy/internal/schema"
+	"pgcopy/internal/storage"
+)
+
+func TestExportCopyQuery(t *testing.T) {
+	selectQuery := "SELECT id, name FROM public.users"
+
+	tests := []struct {
+		name     string
+		opts     ExportOptions
+		expected string
+	}{
+		{
+			name:     "csv with header",
+			opts:     ExportOptions{Format: FormatCSV, Header: true},
+			expected: "COPY (SELECT id, name FROM public.users) TO STDOUT WITH (FORMAT csv, HEADER true)",
+		},
+		{
+			name:     "tsv without header",
+			opts:     ExportOptions{Format: FormatTSV},
+			expected: `COPY (SELECT id, name FROM public.users) TO STDOUT WITH (FORMAT csv, DELIMITER E'\t', HEADER false)`,
+		},
+		{
+			name:     "json lines",
+			opts:     ExportOptions{Format: FormatJSONL, Header: true},
+			expected: `COPY (SELECT to_jsonb(t)::text FROM (SELECT id, name FROM public.users) t) TO STDOUT WITH (FORMAT csv, QUOTE E'\x01', DELIMITER E'\x02')`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, exportCopyQuery(selectQuery, tt.opts))
+		})
+	}
+}
+
+func TestExportFileName(t *testing.T) {
+	table := schema.TableInfo{Schema: "analytics", Table: "page_views"}
+	assert.Equal(t, "analytics.page_views.csv", exportFileName(table, FormatCSV, ""))
+	assert.Equal(t, "analytics.page_views.jsonl", exportFileName(table, FormatJSONL, storage.CompressionNone))
+	assert.Equal(t, "analytics.page_views.csv.gz", exportFileName(table, FormatCSV, storage.CompressionGzip))
+	assert.Equal(t, "analytics.page_views.tsv.zst", exportFileName(table, FormatTSV, storage.CompressionZstd))
+	assert.Equal(t, "analytics.page_views.parquet", exportFileName(table, FormatParquet, storage.CompressionZstd))
+}
+
+func TestValidateFormat(t *testing.T) {
+	assert.NoError(t, ValidateFormat(FormatCSV))
+	assert.NoError(t, ValidateFormat(FormatTSV))
+	assert.NoError(t, ValidateFormat(FormatJSONL))
+	assert.NoError(t, ValidateFormat(FormatParquet))
+	assert.Error(t, ValidateFormat("xml"))
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewLocal(t.TempDir())
+	require.NoError(t, err)
+
+	manifest := &Manifest{
+		Version: manifestVersion,
+		Format:  FormatJSONL,
+		Tables: []ManifestTable{
+			{
+				Schema:  "public",
+				Table:   "users",
+				File:    "public.users.jsonl",
+				Columns: []ManifestColumn{{Name: "id", Type: "integer"}, {Name: "email", Type: "text"}},
+				Rows:    3,
+			},
+		},
+	}
+	require.NoError(t, writeManifest(ctx, store, manifest))
+
+	read, err := ReadManifest(ctx, store)
+	require.NoError(t, err)
+	assert.Equal(t, manifest.Tables, read.Tables)
+	assert.Equal(t, []string{"id", "email"}, read.Tables[0].ColumnNames())
+
+	manifest.Version = 99
+	require.NoError(t, writeManifest(ctx, store, manifest))
+	_, err = ReadManifest(ctx, store)
+	assert.ErrorContains(t, err, "unsupported manifest version")
+}
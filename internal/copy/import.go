@@ -0,0 +1,373 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/trace"
+
+	"pgcopy/internal/log"
+	"pgcopy/internal/schema"
+	"pgcopy/internal/storage"
+	"pgcopy/internal/tracing"
+)
+
+// ImportOptions configures how exported files are loaded into the target
+type ImportOptions struct {
+	// Truncate empties every target table before loading
+	Truncate bool
+	// Renames maps exported schema.table names to the schema.table they are loaded into
+	Renames map[string]string
+}
+
+// importTable is an exported table file with the target table it is loaded into
+type importTable struct {
+	entry  ManifestTable
+	target schema.TableInfo
+}
+
+// foreignKeysQuery lists the tables referenced by each table's foreign keys
+const foreignKeysQuery = `
+	SELECT cn.nspname, c.relname, rn.nspname, r.relname
+	FROM pg_constraint con
+	JOIN pg_class c ON c.oid = con.conrelid
+	JOIN pg_namespace cn ON cn.oid = c.relnamespace
+	JOIN pg_class r ON r.oid = con.confrelid
+	JOIN pg_namespace rn ON rn.oid = r.relnamespace
+	WHERE con.contype = 'f' AND con.conrelid <> con.confrelid
+`
+
+// Import loads the table files listed in a manifest into the target. When config is not
+// nil only its tables are imported, with their truncate, load and sequence settings.
+// Tables are loaded so that referenced tables come before the tables referencing them.
+func (e *Engine) Import(ctx context.Context, manifest *Manifest, store storage.Storage, config *schema.Config, opts ImportOptions) error {
+	if manifest.Format == FormatParquet {
+		return fmt.Errorf("importing %s files is not supported", FormatParquet)
+	}
+
+	tables, err := importTables(manifest, config, opts)
+	if err != nil {
+		return err
+	}
+	log.Info().Int("total_tables", len(tables)).Str("location", store.String()).Str("format", manifest.Format).
+		Msg("Starting import operation")
+
+	ctx, span := tracing.Tracer().Start(ctx, "copy.import", trace.WithAttributes(
+		tracing.AttrTables.Int(len(tables)),
+	))
+	defer span.End()
+
+	tables, err = e.orderImportTables(ctx, tables)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return fmt.Errorf("failed to determine import order: %w", err)
+	}
+
+	// Truncate in a single statement so that tables referencing each other can be emptied
+	if err := e.truncateImportTables(ctx, tables); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+
+	for _, table := range tables {
+		target := table.target
+		if err := e.importTable(ctx, manifest, store, table); err != nil {
+			e.addError(err)
+			log.Error().Err(err).Str("schema", target.Schema).Str("table", target.Table).Msg("Failed to import table")
+		} else {
+			e.incrementTablesProcessed()
+			log.Info().Str("schema", target.Schema).Str("table", target.Table).Str("file", table.entry.File).
+				Msg("Table imported successfully")
+		}
+	}
+
+	e.stats.EndTime = time.Now()
+
+	span.SetAttributes(
+		tracing.AttrRowsCopied.Int64(e.stats.RowsCopied),
+		tracing.AttrErrors.Int(len(e.stats.Errors)),
+	)
+
+	e.printSummary()
+	return nil
+}
+
+// importTables pairs the manifest tables with the target tables they are loaded into
+func importTables(manifest *Manifest, config *schema.Config, opts ImportOptions) ([]importTable, error) {
+	var configured []schema.TableInfo
+	if config != nil {
+		configured = config.GetAllTables()
+	}
+
+	var tables []importTable
+	seen := make(map[string]bool)
+	for _, entry := range manifest.Tables {
+		target := schema.TableInfo{Schema: entry.Schema, Table: entry.Table}
+		if config != nil {
+			i := slices.IndexFunc(configured, func(t schema.TableInfo) bool {
+				return t.Schema == entry.Schema && t.Table == entry.Table
+			})
+			if i < 0 {
+				log.Debug().Str("schema", entry.Schema).Str("table", entry.Table).Msg("Table not in configuration, skipping")
+				continue
+			}
+			target = configured[i]
+		}
+
+		if renamed, ok := opts.Renames[entry.Schema+"."+entry.Table]; ok {
+			schemaName, tableName, err := schema.ParseTableName(renamed)
+			if err != nil {
+				return nil, err
+			}
+			target.Schema, target.Table = schemaName, tableName
+		}
+
+		name := target.Schema + "." + target.Table
+		if seen[name] {
+			return nil, fmt.Errorf("more than one file would be imported into %s", name)
+		}
+		seen[name] = true
+
+		target.Truncate = target.Truncate || opts.Truncate
+		// Without a source database, sequences can only follow the loaded values
+		if target.Sequences == schema.SequencesSource {
+			target.Sequences = schema.SequencesMax
+		}
+
+		tables = append(tables, importTable{entry: entry, target: target})
+	}
+
+	return tables, nil
+}
+
+// orderImportTables sorts the tables so that referenced tables are loaded first
+func (e *Engine) orderImportTables(ctx context.Context, tables []importTable) ([]importTable, error) {
+	parents, err := getForeignKeyParents(ctx, e.targetConn.GetPool())
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(tables))
+	byName := make(map[string]importTable, len(tables))
+	for i, table := range tables {
+		names[i] = table.target.Schema + "." + table.target.Table
+		byName[names[i]] = table
+	}
+
+	ordered, cyclic := orderByDependencies(names, parents)
+	if cyclic {
+		log.Warn().Msg("Foreign keys between imported tables form a cycle, loading those tables in manifest order")
+	}
+
+	result := make([]importTable, len(ordered))
+	for i, name := range ordered {
+		result[i] = byName[name]
+	}
+	return result, nil
+}
+
+// getForeignKeyParents maps each table to the tables its foreign keys reference
+func getForeignKeyParents(ctx context.Context, pool *pgxpool.Pool) (map[string][]string, error) {
+	rows, err := pool.Query(ctx, foreignKeysQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := make(map[string][]string)
+	for rows.Next() {
+		var childSchema, child, parentSchema, parent string
+		if err := rows.Scan(&childSchema, &child, &parentSchema, &parent); err != nil {
+			return nil, err
+		}
+		name := childSchema + "." + child
+		parents[name] = append(parents[name], parentSchema+"."+parent)
+	}
+	return parents, rows.Err()
+}
+
+// orderByDependencies orders names so that each comes after its parents, keeping the
+// original order otherwise. Names in a cycle are appended in their original order.
+func orderByDependencies(names []string, parents map[string][]string) ([]string, bool) {
+	remaining := slices.Clone(names)
+	ordered := make([]string, 0, len(names))
+
+	for len(remaining) > 0 {
+		// Pick the first table whose parents are all loaded or not imported at all
+		next := slices.IndexFunc(remaining, func(name string) bool {
+			for _, parent := range parents[name] {
+				if parent != name && slices.Contains(remaining, parent) {
+					return false
+				}
+			}
+			return true
+		})
+		if next < 0 {
+			return append(ordered, remaining...), true
+		}
+
+		ordered = append(ordered, remaining[next])
+		remaining = slices.Delete(remaining, next, next+1)
+	}
+
+	return ordered, false
+}
+
+// truncateImportTables truncates every table that is truncated before loading
+func (e *Engine) truncateImportTables(ctx context.Context, tables []importTable) error {
+	var names []string
+	for _, table := range tables {
+		if table.target.Truncate {
+			names = append(names, fmt.Sprintf("%s.%s", table.target.Schema, table.target.Table))
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	if _, err := e.targetConn.GetPool().Exec(ctx, "TRUNCATE "+strings.Join(names, ", ")); err != nil {
+		return fmt.Errorf("failed to truncate tables: %w", err)
+	}
+	log.Info().Strs("tables", names).Msg("Tables truncated before import")
+	return nil
+}
+
+// importTable loads a single table file into its target table
+func (e *Engine) importTable(ctx context.Context, manifest *Manifest, store storage.Storage, table importTable) (err error) {
+	target := table.target
+	ctx, span := tracing.Tracer().Start(ctx, "copy.import_table", trace.WithAttributes(tableAttributes(target)...))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	file, err := store.Open(ctx, table.entry.File)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", table.entry.File, err)
+	}
+
+	// Compressed files are detected by extension or content
+	r, err := storage.NewReader(file, table.entry.File)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	defer r.Close()
+
+	rowsImported, err := e.loadStream(ctx, target, table.entry.ColumnNames(), manifest.Format, manifest.Header, r)
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", table.entry.File, err)
+	}
+
+	if rowsImported != table.entry.Rows {
+		log.Warn().Str("schema", target.Schema).Str("table", target.Table).
+			Int64("expected", table.entry.Rows).Int64("imported", rowsImported).
+			Msg("Imported row count differs from manifest")
+	}
+
+	e.incrementRowsCopied(rowsImported)
+	span.SetAttributes(tracing.AttrRowsCopied.Int64(rowsImported))
+	log.Info().Int64("rows_imported", rowsImported).Msg("Table import completed")
+
+	return e.finishLoad(ctx, target)
+}
+
+// loadStream loads rows in an export format into a target table, with the table's
+// session settings applied, and returns the number of rows loaded
+func (e *Engine) loadStream(ctx context.Context, target schema.TableInfo, columnNames []string, format string, header bool, r io.Reader) (int64, error) {
+	conn, err := e.targetConn.GetPool().Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire target connection: %w", err)
+	}
+	defer conn.Release()
+
+	// Apply per-table session settings, reverting them whatever the outcome
+	restoreSession, err := e.prepareTargetSession(ctx, conn.Conn(), target)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare target session: %w", err)
+	}
+	defer restoreSession()
+
+	columns := quoteColumns(columnNames)
+	if format == FormatJSONL {
+		return importJSONLines(ctx, conn.Conn(), target, columns, r)
+	}
+
+	query := importCopyQuery(target, columns, format, header)
+	log.Debug().Str("schema", target.Schema).Str("table", target.Table).Str("query", query).Msg("Executing import")
+
+	commandTag, err := conn.Conn().PgConn().CopyFrom(ctx, r, query)
+	return commandTag.RowsAffected(), err
+}
+
+// finishLoad synchronizes sequences and refreshes statistics of a loaded target table
+func (e *Engine) finishLoad(ctx context.Context, target schema.TableInfo) error {
+	// Advance target sequences past the loaded values
+	if err := e.syncSequences(ctx, target); err != nil {
+		return fmt.Errorf("failed to synchronize sequences: %w", err)
+	}
+
+	if target.LoadSettings.AnalyzeEnabled() {
+		if err := e.analyzeTable(ctx, target); err != nil {
+			log.Warn().Err(err).Str("schema", target.Schema).Str("table", target.Table).Msg("Failed to analyze table")
+		}
+	}
+
+	return nil
+}
+
+// importJSONLines stages JSON Lines in a temporary table and inserts them into the target,
+// converting each object with jsonb_populate_record
+func importJSONLines(ctx context.Context, conn *pgx.Conn, table schema.TableInfo, columns []string, r io.Reader) (int64, error) {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "CREATE TEMP TABLE pgcopy_import (doc jsonb) ON COMMIT DROP"); err != nil {
+		return 0, err
+	}
+	if _, err := conn.PgConn().CopyFrom(ctx, r,
+		`COPY pg_temp.pgcopy_import (doc) FROM STDIN WITH (FORMAT csv, QUOTE E'\x01', DELIMITER E'\x02')`); err != nil {
+		return 0, err
+	}
+
+	recordColumns := make([]string, len(columns))
+	for i, col := range columns {
+		recordColumns[i] = "r." + col
+	}
+	commandTag, err := tx.Exec(ctx, fmt.Sprintf(
+		"INSERT INTO %s.%s (%s) SELECT %s FROM pg_temp.pgcopy_import, jsonb_populate_record(NULL::%s.%s, doc) r",
+		table.Schema, table.Table, formatColumns(columns), formatColumns(recordColumns), table.Schema, table.Table))
+	if err != nil {
+		return 0, err
+	}
+
+	return commandTag.RowsAffected(), tx.Commit(ctx)
+}
+
+// importCopyQuery returns the COPY statement loading a CSV or TSV file into a table
+func importCopyQuery(table schema.TableInfo, columns []string, format string, header bool) string {
+	if format == FormatTSV {
+		return fmt.Sprintf(`COPY %s.%s (%s) FROM STDIN WITH (FORMAT csv, DELIMITER E'\t', HEADER %t)`,
+			table.Schema, table.Table, formatColumns(columns), header)
+	}
+	return fmt.Sprintf("COPY %s.%s (%s) FROM STDIN WITH (FORMAT csv, HEADER %t)",
+		table.Schema, table.Table, formatColumns(columns), header)
+}
+
+// quoteColumns quotes column names taken from a manifest
+func quoteColumns(columns []string) []string {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = pgx.Identifier{col}.Sanitize()
+	}
+	return quoted
+}
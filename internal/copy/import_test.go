@@ -0,0 +1,115 @@
+package copy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pgcopy/internal/schema"
+)
+
+func TestOrderByDependencies(t *testing.T) {
+	tests := []struct {
+		name     string
+		names    []string
+		parents  map[string][]string
+		expected []string
+		cyclic   bool
+	}{
+		{
+			name:     "no dependencies keeps order",
+			names:    []string{"public.b", "public.a"},
+			expected: []string{"public.b", "public.a"},
+		},
+		{
+			name:  "parents first",
+			names: []string{"public.order_items", "public.orders", "public.users"},
+			parents: map[string][]string{
+				"public.order_items": {"public.orders"},
+				"public.orders":      {"public.users"},
+			},
+			expected: []string{"public.users", "public.orders", "public.order_items"},
+		},
+		{
+			name:     "parents outside the import are ignored",
+			names:    []string{"public.orders"},
+			parents:  map[string][]string{"public.orders": {"public.users"}},
+			expected: []string{"public.orders"},
+		},
+		{
+			name:  "cycle appended in original order",
+			names: []string{"public.a", "public.b", "public.c"},
+			parents: map[string][]string{
+				"public.a": {"public.b"},
+				"public.b": {"public.a"},
+			},
+			expected: []string{"public.c", "public.a", "public.b"},
+			cyclic:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ordered, cyclic := orderByDependencies(tt.names, tt.parents)
+			assert.Equal(t, tt.expected, ordered)
+			assert.Equal(t, tt.cyclic, cyclic)
+		})
+	}
+}
+
+func TestImportTables(t *testing.T) {
+	manifest := &Manifest{
+		Format: FormatCSV,
+		Tables: []ManifestTable{
+			{Schema: "public", Table: "users", File: "public.users.csv"},
+			{Schema: "public", Table: "orders", File: "public.orders.csv"},
+		},
+	}
+
+	// Without a config every table is imported
+	tables, err := importTables(manifest, nil, ImportOptions{
+		Truncate: true,
+		Renames:  map[string]string{"public.users": "staging.users"},
+	})
+	require.NoError(t, err)
+	require.Len(t, tables, 2)
+	assert.Equal(t, "staging", tables[0].target.Schema)
+	assert.Equal(t, "users", tables[0].target.Table)
+	assert.True(t, tables[0].target.Truncate)
+	assert.Equal(t, "public.users.csv", tables[0].entry.File)
+
+	// A config selects tables and provides their settings
+	config := &schema.Config{
+		Schemas: []schema.Schema{
+			{
+				Name:   "public",
+				Tables: []schema.Table{{Name: "orders", Truncate: true, Sequences: schema.SequencesSource}},
+			},
+		},
+	}
+	tables, err = importTables(manifest, config, ImportOptions{})
+	require.NoError(t, err)
+	require.Len(t, tables, 1)
+	assert.Equal(t, "orders", tables[0].target.Table)
+	assert.True(t, tables[0].target.Truncate)
+	assert.Equal(t, schema.SequencesMax, tables[0].target.Sequences)
+
+	_, err = importTables(manifest, nil, ImportOptions{Renames: map[string]string{"public.users": "users"}})
+	assert.ErrorContains(t, err, "expected schema.table")
+
+	_, err = importTables(manifest, nil, ImportOptions{Renames: map[string]string{"public.users": "public.orders"}})
+	assert.ErrorContains(t, err, "more than one file")
+}
+
+func TestImportCopyQuery(t *testing.T) {
+	table := schema.TableInfo{Schema: "public", Table: "users"}
+	columns := quoteColumns([]string{"id", "email"})
+
+	assert.Equal(t,
+		`COPY public.users ("id", "email") FROM STDIN WITH (FORMAT csv, HEADER true)`,
+		importCopyQuery(table, columns, FormatCSV, true))
+	assert.Equal(t,
+		`COPY public.users ("id", "email") FROM STDIN WITH (FORMAT csv, DELIMITER E'\t', HEADER false)`,
+		importCopyQuery(table, columns, FormatTSV, false))
+}
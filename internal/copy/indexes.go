@@ -0,0 +1,222 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+
+	"pgcopy/internal/log"
+	"pgcopy/internal/schema"
+	"pgcopy/internal/tracing"
+)
+
+// defaultRebuildParallelism is the number of indexes recreated at once when not configured
+const defaultRebuildParallelism = 1
+
+// indexDefinition is a secondary index captured with pg_get_indexdef
+type indexDefinition struct {
+	Schema     string
+	Name       string
+	Definition string
+}
+
+// constraintDefinition is a FK or CHECK constraint captured with pg_get_constraintdef
+type constraintDefinition struct {
+	Name       string
+	Definition string
+}
+
+// tableIndexes holds everything dropped from a table before a bulk load
+type tableIndexes struct {
+	Indexes     []indexDefinition
+	Constraints []constraintDefinition
+}
+
+// secondaryIndexesQuery finds indexes that do not back a constraint (primary key, unique, exclusion)
+const secondaryIndexesQuery = `
+	SELECT n.nspname, ic.relname, pg_get_indexdef(i.indexrelid)
+	FROM pg_index i
+	JOIN pg_class ic ON ic.oid = i.indexrelid
+	JOIN pg_class c ON c.oid = i.indrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE n.nspname = $1 AND c.relname = $2
+	  AND NOT EXISTS (SELECT 1 FROM pg_constraint con WHERE con.conindid = i.indexrelid)
+	ORDER BY ic.relname
+`
+
+// rebuildConstraintsQuery finds the foreign key and check constraints of a table
+const rebuildConstraintsQuery = `
+	SELECT con.conname, pg_get_constraintdef(con.oid)
+	FROM pg_constraint con
+	JOIN pg_class c ON c.oid = con.conrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE n.nspname = $1 AND c.relname = $2 AND con.contype IN ('f', 'c')
+	ORDER BY con.conname
+`
+
+// createIndexPrefix matches the start of a pg_get_indexdef result
+var createIndexPrefix = regexp.MustCompile(`^CREATE (UNIQUE )?INDEX `)
+
+// dropIndexes captures and drops the secondary indexes and FK/CHECK constraints of a target table.
+// The returned definitions must be passed to restoreIndexes once the copy has finished.
+func (e *Engine) dropIndexes(ctx context.Context, table schema.TableInfo) (indexes *tableIndexes, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.drop_indexes", trace.WithAttributes(tableAttributes(table)...))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	indexes, err = e.captureIndexes(ctx, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture index definitions: %w", err)
+	}
+
+	// Log the definitions so they can be restored by hand if the process dies mid-copy
+	for _, idx := range indexes.Indexes {
+		log.Info().Str("schema", table.Schema).Str("table", table.Table).Str("definition", idx.Definition).Msg("Dropping index")
+	}
+	for _, con := range indexes.Constraints {
+		log.Info().Str("schema", table.Schema).Str("table", table.Table).
+			Str("definition", addConstraintStatement(table, con)).Msg("Dropping constraint")
+	}
+
+	tx, err := e.targetConn.GetPool().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, con := range indexes.Constraints {
+		if _, err := tx.Exec(ctx, dropConstraintStatement(table, con)); err != nil {
+			return nil, fmt.Errorf("failed to drop constraint %s: %w", con.Name, err)
+		}
+	}
+	for _, idx := range indexes.Indexes {
+		if _, err := tx.Exec(ctx, dropIndexStatement(idx)); err != nil {
+			return nil, fmt.Errorf("failed to drop index %s: %w", idx.Name, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return indexes, nil
+}
+
+// restoreIndexes recreates indexes in parallel, then re-adds constraints. It keeps going
+// after a failure so that as much as possible is restored, and reports every error.
+func (e *Engine) restoreIndexes(ctx context.Context, table schema.TableInfo, indexes *tableIndexes) (err error) {
+	if indexes == nil {
+		return nil
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "copy.restore_indexes", trace.WithAttributes(tableAttributes(table)...))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	// Restore even when the copy was cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	parallelism := table.RebuildParallelism
+	if parallelism <= 0 {
+		parallelism = defaultRebuildParallelism
+	}
+
+	indexErrs := make([]error, len(indexes.Indexes))
+	group := new(errgroup.Group)
+	group.SetLimit(parallelism)
+	for i, idx := range indexes.Indexes {
+		group.Go(func() error {
+			statement := createIndexStatement(idx, table.RebuildConcurrently)
+			if err := e.execWithLoadSettings(ctx, table, statement); err != nil {
+				indexErrs[i] = fmt.Errorf("failed to recreate index %s: %w", idx.Name, err)
+				return nil
+			}
+			log.Info().Str("schema", table.Schema).Str("table", table.Table).Str("index", idx.Name).Msg("Index recreated")
+			return nil
+		})
+	}
+	group.Wait()
+
+	errs := indexErrs
+	for _, con := range indexes.Constraints {
+		if err := e.execWithLoadSettings(ctx, table, addConstraintStatement(table, con)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to recreate constraint %s: %w", con.Name, err))
+			continue
+		}
+		log.Info().Str("schema", table.Schema).Str("table", table.Table).Str("constraint", con.Name).Msg("Constraint recreated")
+	}
+
+	return errors.Join(errs...)
+}
+
+// captureIndexes reads the index and constraint definitions of a target table
+func (e *Engine) captureIndexes(ctx context.Context, table schema.TableInfo) (*tableIndexes, error) {
+	pool := e.targetConn.GetPool()
+	indexes := &tableIndexes{}
+
+	rows, err := pool.Query(ctx, secondaryIndexesQuery, table.Schema, table.Table)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var idx indexDefinition
+		if err := rows.Scan(&idx.Schema, &idx.Name, &idx.Definition); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		indexes.Indexes = append(indexes.Indexes, idx)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = pool.Query(ctx, rebuildConstraintsQuery, table.Schema, table.Table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var con constraintDefinition
+		if err := rows.Scan(&con.Name, &con.Definition); err != nil {
+			return nil, err
+		}
+		indexes.Constraints = append(indexes.Constraints, con)
+	}
+
+	return indexes, rows.Err()
+}
+
+// createIndexStatement returns the statement recreating an index, optionally without blocking writes
+func createIndexStatement(idx indexDefinition, concurrently bool) string {
+	if !concurrently {
+		return idx.Definition
+	}
+	return createIndexPrefix.ReplaceAllString(idx.Definition, "CREATE ${1}INDEX CONCURRENTLY ")
+}
+
+// dropIndexStatement returns the statement dropping an index
+func dropIndexStatement(idx indexDefinition) string {
+	return fmt.Sprintf("DROP INDEX %s", pgx.Identifier{idx.Schema, idx.Name}.Sanitize())
+}
+
+// addConstraintStatement returns the statement re-adding a constraint to a table
+func addConstraintStatement(table schema.TableInfo, con constraintDefinition) string {
+	return fmt.Sprintf("ALTER TABLE %s.%s ADD CONSTRAINT %s %s",
+		table.Schema, table.Table, pgx.Identifier{con.Name}.Sanitize(), con.Definition)
+}
+
+// dropConstraintStatement returns the statement dropping a constraint from a table
+func dropConstraintStatement(table schema.TableInfo, con constraintDefinition) string {
+	return fmt.Sprintf("ALTER TABLE %s.%s DROP CONSTRAINT %s",
+		table.Schema, table.Table, pgx.Identifier{con.Name}.Sanitize())
+}
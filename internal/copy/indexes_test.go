@@ -0,0 +1,58 @@
+package copy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pgcopy/internal/schema"
+)
+
+func TestCreateIndexStatement(t *testing.T) {
+	tests := []struct {
+		name         string
+		definition   string
+		concurrently bool
+		expected     string
+	}{
+		{
+			name:       "plain index",
+			definition: "CREATE INDEX idx_users_email ON public.users USING btree (email)",
+			expected:   "CREATE INDEX idx_users_email ON public.users USING btree (email)",
+		},
+		{
+			name:         "concurrent index",
+			definition:   "CREATE INDEX idx_users_email ON public.users USING btree (email)",
+			concurrently: true,
+			expected:     "CREATE INDEX CONCURRENTLY idx_users_email ON public.users USING btree (email)",
+		},
+		{
+			name:         "concurrent unique index",
+			definition:   "CREATE UNIQUE INDEX idx_users_lower_email ON public.users USING btree (lower((email)::text))",
+			concurrently: true,
+			expected:     "CREATE UNIQUE INDEX CONCURRENTLY idx_users_lower_email ON public.users USING btree (lower((email)::text))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := indexDefinition{Schema: "public", Name: "idx", Definition: tt.definition}
+			assert.Equal(t, tt.expected, createIndexStatement(idx, tt.concurrently))
+		})
+	}
+}
+
+func TestIndexStatements(t *testing.T) {
+	table := schema.TableInfo{Schema: "public", Table: "orders"}
+
+	idx := indexDefinition{Schema: "public", Name: "idx_orders_status"}
+	assert.Equal(t, `DROP INDEX "public"."idx_orders_status"`, dropIndexStatement(idx))
+
+	con := constraintDefinition{Name: "orders_user_id_fkey", Definition: "FOREIGN KEY (user_id) REFERENCES users(id)"}
+	assert.Equal(t,
+		`ALTER TABLE public.orders ADD CONSTRAINT "orders_user_id_fkey" FOREIGN KEY (user_id) REFERENCES users(id)`,
+		addConstraintStatement(table, con))
+	assert.Equal(t,
+		`ALTER TABLE public.orders DROP CONSTRAINT "orders_user_id_fkey"`,
+		dropConstraintStatement(table, con))
+}
@@ -0,0 +1,87 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"pgcopy/internal/log"
+	"pgcopy/internal/schema"
+	"pgcopy/internal/tracing"
+)
+
+// TableSummary describes a source table for generating a configuration
+type TableSummary struct {
+	Schema     string
+	Table      string
+	Columns    []ColumnInfo
+	PrimaryKey []string
+	// EstimatedRows is the planner's row estimate, -1 if the table was never analyzed
+	EstimatedRows int64
+}
+
+// tableSummaryQuery returns the row estimate and primary key columns of a table
+const tableSummaryQuery = `
+	SELECT c.reltuples::bigint,
+	       COALESCE((
+	           SELECT array_agg(a.attname::text ORDER BY k.position)
+	           FROM pg_index i
+	           CROSS JOIN LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, position)
+	           JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+	           WHERE i.indrelid = c.oid AND i.indisprimary
+	       ), '{}')
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE n.nspname = $1 AND c.relname = $2
+`
+
+// DescribeTables lists the tables of the given schemas of the source database, or of
+// every non-system schema if none are given, with their columns, primary key and size
+func (e *Engine) DescribeTables(ctx context.Context, schemas []string) (summaries []TableSummary, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.describe_tables")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	tables, err := e.scanTables(ctx, schemas)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	log.Info().Int("total_tables", len(tables)).Msg("Describing source tables")
+
+	for _, table := range tables {
+		summary, err := e.describeTable(ctx, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe table %s.%s: %w", table.Schema, table.Table, err)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// describeTable reads the columns, primary key and row estimate of one table
+func (e *Engine) describeTable(ctx context.Context, table schema.TableInfo) (TableSummary, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.describe_table", trace.WithAttributes(tableAttributes(table)...))
+	defer span.End()
+
+	summary := TableSummary{Schema: table.Schema, Table: table.Table}
+
+	columns, err := getColumnInfo(ctx, e.sourceConn.GetPool(), table)
+	if err != nil {
+		return summary, fmt.Errorf("failed to read columns: %w", err)
+	}
+	summary.Columns = columns
+
+	err = e.sourceConn.GetPool().QueryRow(ctx, tableSummaryQuery, table.Schema, table.Table).
+		Scan(&summary.EstimatedRows, &summary.PrimaryKey)
+	if err != nil {
+		return summary, fmt.Errorf("failed to read table statistics: %w", err)
+	}
+	if summary.EstimatedRows < 0 {
+		summary.EstimatedRows = -1
+	}
+
+	return summary, nil
+}
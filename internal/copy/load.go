@@ -0,0 +1,123 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/trace"
+
+	"pgcopy/internal/log"
+	"pgcopy/internal/schema"
+	"pgcopy/internal/tracing"
+)
+
+// relpersistenceQuery returns 'p' for logged tables and 'u' for unlogged ones
+const relpersistenceQuery = `
+	SELECT c.relpersistence
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE n.nspname = $1 AND c.relname = $2
+`
+
+// applySessionSettings sets the configured load settings on the target session. Each
+// setting is restored to its previous value, so values from the connection string survive.
+func applySessionSettings(ctx context.Context, conn *pgx.Conn, table schema.TableInfo) ([]undoFunc, error) {
+	settings := table.LoadSettings.SessionSettings()
+
+	// Apply in a stable order so failures are reproducible
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var undos []undoFunc
+	for _, name := range names {
+		var previous string
+		if err := conn.QueryRow(ctx, "SELECT current_setting($1)", name).Scan(&previous); err != nil {
+			return undos, fmt.Errorf("failed to read setting %s: %w", name, err)
+		}
+		if _, err := conn.Exec(ctx, "SELECT set_config($1, $2, false)", name, settings[name]); err != nil {
+			return undos, fmt.Errorf("failed to set %s: %w", name, err)
+		}
+		log.Debug().Str("schema", table.Schema).Str("table", table.Table).
+			Str("setting", name).Str("value", settings[name]).Msg("Load setting applied")
+
+		undos = append(undos, func(ctx context.Context) error {
+			_, err := conn.Exec(ctx, "SELECT set_config($1, $2, false)", name, previous)
+			return err
+		})
+	}
+
+	return undos, nil
+}
+
+// execWithLoadSettings runs a statement on a target connection configured with the
+// table's load settings, so that e.g. maintenance_work_mem applies to index rebuilds
+func (e *Engine) execWithLoadSettings(ctx context.Context, table schema.TableInfo, statement string) error {
+	conn, err := e.targetConn.GetPool().Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire target connection: %w", err)
+	}
+	defer conn.Release()
+
+	undos, err := applySessionSettings(ctx, conn.Conn(), table)
+	defer func() {
+		for i := len(undos) - 1; i >= 0; i-- {
+			if err := undos[i](ctx); err != nil {
+				// Never return a connection with leftover settings to the pool
+				conn.Conn().Close(ctx)
+				return
+			}
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Exec(ctx, statement)
+	return err
+}
+
+// setUnlogged switches the target table to UNLOGGED for the load and back to LOGGED
+// afterwards. Tables that are already unlogged are left alone.
+func setUnlogged(ctx context.Context, conn *pgx.Conn, table schema.TableInfo) (undoFunc, error) {
+	var persistence string
+	if err := conn.QueryRow(ctx, relpersistenceQuery, table.Schema, table.Table).Scan(&persistence); err != nil {
+		return nil, fmt.Errorf("failed to read table persistence: %w", err)
+	}
+	if persistence != "p" {
+		return nil, nil
+	}
+
+	if _, err := conn.Exec(ctx, fmt.Sprintf("ALTER TABLE %s.%s SET UNLOGGED", table.Schema, table.Table)); err != nil {
+		return nil, err
+	}
+	log.Info().Str("schema", table.Schema).Str("table", table.Table).Msg("Table set to UNLOGGED for the load")
+
+	return func(ctx context.Context) error {
+		_, err := conn.Exec(ctx, fmt.Sprintf("ALTER TABLE %s.%s SET LOGGED", table.Schema, table.Table))
+		if err == nil {
+			log.Info().Str("schema", table.Schema).Str("table", table.Table).Msg("Table set back to LOGGED")
+		}
+		return err
+	}, nil
+}
+
+// analyzeTable refreshes the planner statistics of a target table after it was loaded
+func (e *Engine) analyzeTable(ctx context.Context, table schema.TableInfo) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.analyze", trace.WithAttributes(tableAttributes(table)...))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if _, err := e.targetConn.GetPool().Exec(ctx, fmt.Sprintf("ANALYZE %s.%s", table.Schema, table.Table)); err != nil {
+		return err
+	}
+
+	log.Info().Str("schema", table.Schema).Str("table", table.Table).Msg("Table analyzed")
+	return nil
+}
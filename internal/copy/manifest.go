@@ -0,0 +1,89 @@
+package copy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"pgcopy/internal/storage"
+)
+
+// ManifestFile is the name of the manifest written next to exported table files
+const ManifestFile = "manifest.json"
+
+// manifestVersion is the version of the manifest format
+const manifestVersion = 1
+
+// Manifest describes the table files of an export
+type Manifest struct {
+	Version     int             `json:"version"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Format      string          `json:"format"`
+	Header      bool            `json:"header"`
+	Compression string          `json:"compression,omitempty"`
+	Tables      []ManifestTable `json:"tables"`
+}
+
+// ManifestTable describes one exported table file
+type ManifestTable struct {
+	Schema  string           `json:"schema"`
+	Table   string           `json:"table"`
+	File    string           `json:"file"`
+	Columns []ManifestColumn `json:"columns"`
+	Rows    int64            `json:"rows"`
+}
+
+// ManifestColumn describes an exported column with its PostgreSQL type
+type ManifestColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ColumnNames returns the names of the exported columns in file order
+func (t ManifestTable) ColumnNames() []string {
+	names := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// writeManifest writes the manifest to the storage
+func writeManifest(ctx context.Context, store storage.Storage, manifest *Manifest) error {
+	w, err := store.Create(ctx, ManifestFile)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		w.Abort(err)
+		return err
+	}
+
+	return w.Close()
+}
+
+// ReadManifest reads the manifest of an export from the storage
+func ReadManifest(ctx context.Context, store storage.Storage) (*Manifest, error) {
+	r, err := store.Open(ctx, ManifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer r.Close()
+
+	var manifest Manifest
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+	if err := ValidateFormat(manifest.Format); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	return &manifest, nil
+}
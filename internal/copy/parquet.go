@@ -0,0 +1,426 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/klauspost/compress/zstd"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	parquetgzip "github.com/parquet-go/parquet-go/compress/gzip"
+	parquetzstd "github.com/parquet-go/parquet-go/compress/zstd"
+
+	"pgcopy/internal/storage"
+)
+
+// DefaultRowGroupSize is the number of rows per Parquet row group when none is configured
+const DefaultRowGroupSize = 100000
+
+// parquetWriteBatch is the number of rows buffered before they are handed to the writer
+const parquetWriteBatch = 1000
+
+// parquetColumn maps a result column to a Parquet leaf column
+type parquetColumn struct {
+	name string
+	// node is the Parquet type of the column, always optional
+	node parquet.Node
+	// castText reads the column as text, for types without a Parquet equivalent
+	castText bool
+	// list is true for array columns, whose elements are converted by element
+	list    bool
+	element parquetElement
+}
+
+// parquetElement describes how a scalar value is converted to a Parquet value
+type parquetElement struct {
+	kind  parquetKind
+	scale int32
+	// size is the byte length of fixed-length decimals
+	size int
+}
+
+// parquetKind is the conversion applied to a scalar value
+type parquetKind int
+
+const (
+	parquetString parquetKind = iota
+	parquetBytes
+	parquetBool
+	parquetInt32
+	parquetInt64
+	parquetFloat
+	parquetDouble
+	parquetDecimal32
+	parquetDecimal64
+	parquetDecimalFixed
+	parquetTimestamp
+	parquetDate
+	parquetUUID
+)
+
+// parquetColumns maps the columns of a query result to Parquet columns
+func parquetColumns(typeMap *pgtype.Map, fields []pgconn.FieldDescription) []parquetColumn {
+	columns := make([]parquetColumn, len(fields))
+	for i, field := range fields {
+		column := parquetColumn{name: field.Name}
+
+		oid, typmod := field.DataTypeOID, field.TypeModifier
+		if t, ok := typeMap.TypeForOID(oid); ok {
+			if codec, ok := t.Codec.(*pgtype.ArrayCodec); ok {
+				column.list = true
+				oid = codec.ElementType.OID
+			}
+		}
+
+		element, node, ok := parquetElementType(oid, typmod)
+		if !ok {
+			column.castText = true
+		}
+		column.element = element
+		if column.list {
+			column.node = parquet.Optional(parquet.List(parquet.Optional(node)))
+		} else {
+			column.node = parquet.Optional(node)
+		}
+		columns[i] = column
+	}
+	return columns
+}
+
+// parquetElementType returns the Parquet type of a PostgreSQL scalar type. Types without
+// a Parquet equivalent are written as strings and reported as not ok, so they are read as text.
+func parquetElementType(oid uint32, typmod int32) (parquetElement, parquet.Node, bool) {
+	switch oid {
+	case pgtype.BoolOID:
+		return parquetElement{kind: parquetBool}, parquet.Leaf(parquet.BooleanType), true
+	case pgtype.Int2OID, pgtype.Int4OID:
+		return parquetElement{kind: parquetInt32}, parquet.Int(32), true
+	case pgtype.Int8OID:
+		return parquetElement{kind: parquetInt64}, parquet.Int(64), true
+	case pgtype.Float4OID:
+		return parquetElement{kind: parquetFloat}, parquet.Leaf(parquet.FloatType), true
+	case pgtype.Float8OID:
+		return parquetElement{kind: parquetDouble}, parquet.Leaf(parquet.DoubleType), true
+	case pgtype.NumericOID:
+		// Numerics without a precision may hold any number of digits and stay strings
+		if typmod < 4 {
+			break
+		}
+		precision := int((typmod - 4) >> 16 & 0xffff)
+		scale := int((typmod - 4) & 0xffff)
+		switch {
+		case precision <= 9:
+			return parquetElement{kind: parquetDecimal32, scale: int32(scale)}, parquet.Decimal(scale, precision, parquet.Int32Type), true
+		case precision <= 18:
+			return parquetElement{kind: parquetDecimal64, scale: int32(scale)}, parquet.Decimal(scale, precision, parquet.Int64Type), true
+		case precision <= 38:
+			return parquetElement{kind: parquetDecimalFixed, scale: int32(scale), size: 16},
+				parquet.Decimal(scale, precision, parquet.FixedLenByteArrayType(16)), true
+		}
+	case pgtype.TimestamptzOID:
+		return parquetElement{kind: parquetTimestamp}, parquet.TimestampAdjusted(parquet.Microsecond, true), true
+	case pgtype.TimestampOID:
+		return parquetElement{kind: parquetTimestamp}, parquet.TimestampAdjusted(parquet.Microsecond, false), true
+	case pgtype.DateOID:
+		return parquetElement{kind: parquetDate}, parquet.Date(), true
+	case pgtype.JSONOID, pgtype.JSONBOID:
+		return parquetElement{kind: parquetString}, parquet.JSON(), false
+	case pgtype.UUIDOID:
+		return parquetElement{kind: parquetUUID}, parquet.UUID(), true
+	case pgtype.ByteaOID:
+		return parquetElement{kind: parquetBytes}, parquet.Leaf(parquet.ByteArrayType), true
+	case pgtype.TextOID, pgtype.VarcharOID, pgtype.BPCharOID, pgtype.NameOID:
+		return parquetElement{kind: parquetString}, parquet.String(), true
+	}
+	return parquetElement{kind: parquetString}, parquet.String(), false
+}
+
+// parquetSelectQuery reads the exported columns, casting the ones written as strings to text
+func parquetSelectQuery(selectQuery string, columns []parquetColumn) string {
+	exprs := make([]string, len(columns))
+	for i, column := range columns {
+		name := pgx.Identifier{column.name}.Sanitize()
+		switch {
+		case column.castText && column.list:
+			exprs[i] = fmt.Sprintf("t.%s::text[] AS %s", name, name)
+		case column.castText:
+			exprs[i] = fmt.Sprintf("t.%s::text AS %s", name, name)
+		default:
+			exprs[i] = "t." + name
+		}
+	}
+	return fmt.Sprintf("SELECT %s FROM (%s) t", strings.Join(exprs, ", "), selectQuery)
+}
+
+// orderedGroup is a Parquet group keeping its fields in result order. parquet.Group sorts
+// its fields by name, which would reorder the columns of every exported file.
+type orderedGroup struct {
+	parquet.Group
+	fields []parquet.Field
+}
+
+// Fields returns the fields in the order they were added
+func (g orderedGroup) Fields() []parquet.Field { return g.fields }
+
+// orderedField is a named field of an orderedGroup
+type orderedField struct {
+	parquet.Node
+	name string
+}
+
+// Name returns the name of the field
+func (f orderedField) Name() string { return f.name }
+
+// Value returns the field of a map holding the group's values
+func (f orderedField) Value(base reflect.Value) reflect.Value {
+	if base.Kind() == reflect.Interface {
+		base = base.Elem()
+	}
+	if base.Kind() != reflect.Map {
+		return reflect.Value{}
+	}
+	return base.MapIndex(reflect.ValueOf(f.name))
+}
+
+// parquetSchema builds the Parquet schema of the exported columns, in result order
+func parquetSchema(name string, columns []parquetColumn) *parquet.Schema {
+	group := orderedGroup{Group: parquet.Group{}}
+	for _, column := range columns {
+		group.Group[column.name] = column.node
+		group.fields = append(group.fields, orderedField{Node: column.node, name: column.name})
+	}
+	return parquet.NewSchema(name, group)
+}
+
+// parquetCodec returns the Parquet compression codec for an export compression setting
+func parquetCodec(compression string, level int) compress.Codec {
+	switch compression {
+	case storage.CompressionGzip:
+		if level == 0 {
+			level = parquetgzip.DefaultCompression
+		}
+		return &parquetgzip.Codec{Level: level}
+	case storage.CompressionZstd:
+		zstdLevel := parquetzstd.DefaultLevel
+		if level != 0 {
+			zstdLevel = zstd.EncoderLevelFromZstd(level)
+		}
+		return &parquetzstd.Codec{Level: zstdLevel}
+	}
+	return &parquet.Uncompressed
+}
+
+// writeParquet writes the rows of a query to w as a Parquet file and returns the number of rows
+func writeParquet(ctx context.Context, conn *pgx.Conn, w io.Writer, name, selectQuery string, opts ExportOptions) (int64, error) {
+	fields, err := resultFields(ctx, conn, selectQuery)
+	if err != nil {
+		return 0, fmt.Errorf("failed to describe columns: %w", err)
+	}
+
+	columns := parquetColumns(conn.TypeMap(), fields)
+	schema := parquetSchema(name, columns)
+
+	rowGroupSize := opts.RowGroupSize
+	if rowGroupSize <= 0 {
+		rowGroupSize = DefaultRowGroupSize
+	}
+	writer := parquet.NewWriter(w, schema,
+		parquet.MaxRowsPerRowGroup(rowGroupSize),
+		parquet.Compression(parquetCodec(opts.Compression, opts.CompressionLevel)),
+	)
+
+	rows, err := conn.Query(ctx, parquetSelectQuery(selectQuery, columns))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int64
+	batch := make([]parquet.Row, 0, parquetWriteBatch)
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return count, err
+		}
+
+		row, err := parquetRow(columns, values)
+		if err != nil {
+			return count, err
+		}
+
+		batch = append(batch, row)
+		if len(batch) == cap(batch) {
+			if _, err := writer.WriteRows(batch); err != nil {
+				return count, err
+			}
+			count += int64(len(batch))
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+
+	if _, err := writer.WriteRows(batch); err != nil {
+		return count, err
+	}
+	count += int64(len(batch))
+
+	return count, writer.Close()
+}
+
+// parquetRow converts the values of a result row to a Parquet row, one leaf per column
+func parquetRow(columns []parquetColumn, values []any) (parquet.Row, error) {
+	var row parquet.Row
+	for i, column := range columns {
+		var err error
+		row, err = appendParquetValues(row, column, values[i], i)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert column %s: %w", column.name, err)
+		}
+	}
+	return row, nil
+}
+
+// appendParquetValues appends the leveled Parquet values of one column to a row.
+// Columns are optional (definition level 1); lists add a repeated level and optional elements.
+func appendParquetValues(row parquet.Row, column parquetColumn, value any, leaf int) (parquet.Row, error) {
+	if !column.list {
+		if value == nil {
+			return append(row, parquet.NullValue().Level(0, 0, leaf)), nil
+		}
+		v, err := parquetValue(column.element, value)
+		if err != nil {
+			return row, err
+		}
+		return append(row, v.Level(0, 1, leaf)), nil
+	}
+
+	if value == nil {
+		return append(row, parquet.NullValue().Level(0, 0, leaf)), nil
+	}
+	elements, ok := value.([]any)
+	if !ok {
+		return row, fmt.Errorf("unexpected array value %T", value)
+	}
+	if len(elements) == 0 {
+		return append(row, parquet.NullValue().Level(0, 1, leaf)), nil
+	}
+
+	for i, element := range elements {
+		repetition := 1
+		if i == 0 {
+			repetition = 0
+		}
+		if element == nil {
+			row = append(row, parquet.NullValue().Level(repetition, 2, leaf))
+			continue
+		}
+		v, err := parquetValue(column.element, element)
+		if err != nil {
+			return row, err
+		}
+		row = append(row, v.Level(repetition, 3, leaf))
+	}
+	return row, nil
+}
+
+// parquetValue converts a value decoded by pgx to a Parquet value
+func parquetValue(element parquetElement, value any) (parquet.Value, error) {
+	switch element.kind {
+	case parquetString:
+		if s, ok := value.(string); ok {
+			return parquet.ByteArrayValue([]byte(s)), nil
+		}
+	case parquetBytes:
+		if b, ok := value.([]byte); ok {
+			return parquet.ByteArrayValue(b), nil
+		}
+	case parquetBool:
+		if b, ok := value.(bool); ok {
+			return parquet.BooleanValue(b), nil
+		}
+	case parquetInt32:
+		switch v := value.(type) {
+		case int16:
+			return parquet.Int32Value(int32(v)), nil
+		case int32:
+			return parquet.Int32Value(v), nil
+		}
+	case parquetInt64:
+		if v, ok := value.(int64); ok {
+			return parquet.Int64Value(v), nil
+		}
+	case parquetFloat:
+		if v, ok := value.(float32); ok {
+			return parquet.FloatValue(v), nil
+		}
+	case parquetDouble:
+		if v, ok := value.(float64); ok {
+			return parquet.DoubleValue(v), nil
+		}
+	case parquetDecimal32, parquetDecimal64, parquetDecimalFixed:
+		if v, ok := value.(pgtype.Numeric); ok {
+			return decimalValue(element, v)
+		}
+	case parquetTimestamp:
+		if v, ok := value.(time.Time); ok {
+			return parquet.Int64Value(v.UnixMicro()), nil
+		}
+		return parquet.Value{}, fmt.Errorf("infinite timestamps cannot be written to Parquet")
+	case parquetDate:
+		if v, ok := value.(time.Time); ok {
+			return parquet.Int32Value(int32(v.Unix() / 86400)), nil
+		}
+		return parquet.Value{}, fmt.Errorf("infinite dates cannot be written to Parquet")
+	case parquetUUID:
+		if v, ok := value.([16]byte); ok {
+			return parquet.FixedLenByteArrayValue(v[:]), nil
+		}
+	}
+	return parquet.Value{}, fmt.Errorf("unexpected value %T", value)
+}
+
+// decimalValue converts a numeric to the unscaled integer of a Parquet decimal
+func decimalValue(element parquetElement, n pgtype.Numeric) (parquet.Value, error) {
+	if n.NaN || n.InfinityModifier != pgtype.Finite {
+		return parquet.Value{}, fmt.Errorf("NaN and infinite numerics cannot be written to Parquet")
+	}
+
+	unscaled := new(big.Int).Set(n.Int)
+	exp := int64(n.Exp) + int64(element.scale)
+	if exp > 0 {
+		unscaled.Mul(unscaled, new(big.Int).Exp(big.NewInt(10), big.NewInt(exp), nil))
+	} else if exp < 0 {
+		unscaled.Quo(unscaled, new(big.Int).Exp(big.NewInt(10), big.NewInt(-exp), nil))
+	}
+
+	switch element.kind {
+	case parquetDecimal32:
+		return parquet.Int32Value(int32(unscaled.Int64())), nil
+	case parquetDecimal64:
+		return parquet.Int64Value(unscaled.Int64()), nil
+	}
+	return parquet.FixedLenByteArrayValue(twosComplement(unscaled, element.size)), nil
+}
+
+// twosComplement encodes an integer as a big-endian two's complement of the given size
+func twosComplement(n *big.Int, size int) []byte {
+	b := make([]byte, size)
+	if n.Sign() >= 0 {
+		n.FillBytes(b)
+		return b
+	}
+	// Negative values are 2^(8*size) + n
+	modulus := new(big.Int).Lsh(big.NewInt(1), uint(8*size))
+	new(big.Int).Add(modulus, n).FillBytes(b)
+	return b
+}
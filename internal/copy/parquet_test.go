@@ -0,0 +1,197 @@
+package copy
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pgcopy/internal/storage"
+)
+
+// numericTypmod returns the type modifier of numeric(precision, scale)
+func numericTypmod(precision, scale int32) int32 {
+	return precision<<16 | scale + 4
+}
+
+func TestParquetElementType(t *testing.T) {
+	tests := []struct {
+		name     string
+		oid      uint32
+		typmod   int32
+		expected string
+		ok       bool
+	}{
+		{name: "integer", oid: pgtype.Int4OID, typmod: -1, expected: "INT(32,true)", ok: true},
+		{name: "bigint", oid: pgtype.Int8OID, typmod: -1, expected: "INT(64,true)", ok: true},
+		{name: "double", oid: pgtype.Float8OID, typmod: -1, expected: "DOUBLE", ok: true},
+		{name: "small numeric", oid: pgtype.NumericOID, typmod: numericTypmod(9, 2), expected: "DECIMAL(9,2)", ok: true},
+		{name: "numeric", oid: pgtype.NumericOID, typmod: numericTypmod(18, 4), expected: "DECIMAL(18,4)", ok: true},
+		{name: "wide numeric", oid: pgtype.NumericOID, typmod: numericTypmod(30, 6), expected: "DECIMAL(30,6)", ok: true},
+		{name: "huge numeric", oid: pgtype.NumericOID, typmod: numericTypmod(60, 6), expected: "STRING", ok: false},
+		{name: "unconstrained numeric", oid: pgtype.NumericOID, typmod: -1, expected: "STRING", ok: false},
+		{name: "timestamptz", oid: pgtype.TimestamptzOID, typmod: -1, expected: "TIMESTAMP(isAdjustedToUTC=true,unit=MICROS)", ok: true},
+		{name: "timestamp", oid: pgtype.TimestampOID, typmod: -1, expected: "TIMESTAMP(isAdjustedToUTC=false,unit=MICROS)", ok: true},
+		{name: "date", oid: pgtype.DateOID, typmod: -1, expected: "DATE", ok: true},
+		{name: "jsonb", oid: pgtype.JSONBOID, typmod: -1, expected: "JSON", ok: false},
+		{name: "uuid", oid: pgtype.UUIDOID, typmod: -1, expected: "UUID", ok: true},
+		{name: "bytea", oid: pgtype.ByteaOID, typmod: -1, expected: "BYTE_ARRAY", ok: true},
+		{name: "varchar", oid: pgtype.VarcharOID, typmod: 104, expected: "STRING", ok: true},
+		{name: "interval", oid: pgtype.IntervalOID, typmod: -1, expected: "STRING", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, node, ok := parquetElementType(tt.oid, tt.typmod)
+			assert.Equal(t, tt.expected, node.Type().String())
+			assert.Equal(t, tt.ok, ok)
+		})
+	}
+}
+
+func TestParquetColumns(t *testing.T) {
+	fields := []pgconn.FieldDescription{
+		{Name: "id", DataTypeOID: pgtype.Int8OID, TypeModifier: -1},
+		{Name: "tags", DataTypeOID: pgtype.TextArrayOID, TypeModifier: -1},
+		{Name: "payload", DataTypeOID: pgtype.JSONBOID, TypeModifier: -1},
+		{Name: "duration", DataTypeOID: pgtype.IntervalArrayOID, TypeModifier: -1},
+	}
+
+	columns := parquetColumns(pgtype.NewMap(), fields)
+	require.Len(t, columns, 4)
+
+	assert.False(t, columns[0].list)
+	assert.True(t, columns[1].list)
+	assert.False(t, columns[1].castText)
+	assert.True(t, columns[2].castText)
+	assert.True(t, columns[3].list)
+	assert.True(t, columns[3].castText)
+
+	assert.Equal(t,
+		`SELECT t."id", t."tags", t."payload"::text AS "payload", t."duration"::text[] AS "duration" FROM (SELECT * FROM public.events) t`,
+		parquetSelectQuery("SELECT * FROM public.events", columns))
+}
+
+func TestDecimalValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		element  parquetElement
+		value    pgtype.Numeric
+		expected parquet.Value
+	}{
+		{
+			name:     "int32 decimal",
+			element:  parquetElement{kind: parquetDecimal32, scale: 2},
+			value:    pgtype.Numeric{Int: big.NewInt(12345), Exp: -2, Valid: true},
+			expected: parquet.Int32Value(12345),
+		},
+		{
+			name:     "int64 decimal scaled up",
+			element:  parquetElement{kind: parquetDecimal64, scale: 4},
+			value:    pgtype.Numeric{Int: big.NewInt(-15), Exp: -1, Valid: true},
+			expected: parquet.Int64Value(-15000),
+		},
+		{
+			name:     "fixed length negative decimal",
+			element:  parquetElement{kind: parquetDecimalFixed, scale: 0, size: 16},
+			value:    pgtype.Numeric{Int: big.NewInt(-1), Valid: true},
+			expected: parquet.FixedLenByteArrayValue(bytes.Repeat([]byte{0xff}, 16)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := decimalValue(tt.element, tt.value)
+			require.NoError(t, err)
+			assert.True(t, parquet.Equal(tt.expected, v))
+		})
+	}
+
+	_, err := decimalValue(parquetElement{kind: parquetDecimal64}, pgtype.Numeric{NaN: true, Valid: true})
+	assert.Error(t, err)
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	fields := []pgconn.FieldDescription{
+		{Name: "id", DataTypeOID: pgtype.Int4OID, TypeModifier: -1},
+		{Name: "amount", DataTypeOID: pgtype.NumericOID, TypeModifier: numericTypmod(10, 2)},
+		{Name: "created_at", DataTypeOID: pgtype.TimestamptzOID, TypeModifier: -1},
+		{Name: "scores", DataTypeOID: pgtype.Int8ArrayOID, TypeModifier: -1},
+		{Name: "name", DataTypeOID: pgtype.TextOID, TypeModifier: -1},
+	}
+	columns := parquetColumns(pgtype.NewMap(), fields)
+	schema := parquetSchema("orders", columns)
+
+	created := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	results := [][]any{
+		{int32(1), pgtype.Numeric{Int: big.NewInt(1999), Exp: -2, Valid: true}, created, []any{int64(1), nil, int64(3)}, "first"},
+		{int32(2), nil, nil, []any{}, nil},
+		{int32(3), nil, nil, nil, "third"},
+	}
+
+	var buf bytes.Buffer
+	writer := parquet.NewWriter(&buf, schema, parquet.MaxRowsPerRowGroup(2), parquet.Compression(parquetCodec(storage.CompressionZstd, 0)))
+	var batch []parquet.Row
+	for _, values := range results {
+		row, err := parquetRow(columns, values)
+		require.NoError(t, err)
+		batch = append(batch, row)
+	}
+	_, err := writer.WriteRows(batch)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	file, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), file.NumRows())
+	assert.Len(t, file.RowGroups(), 2)
+
+	// Columns keep the result order: id, amount, created_at, scores, name
+	var names []string
+	for _, field := range file.Schema().Fields() {
+		names = append(names, field.Name())
+	}
+	assert.Equal(t, []string{"id", "amount", "created_at", "scores", "name"}, names)
+
+	reader := parquet.NewReader(bytes.NewReader(buf.Bytes()))
+	defer reader.Close()
+
+	rows := make([]parquet.Row, 3)
+	n, _ := reader.ReadRows(rows)
+	require.Equal(t, 3, n)
+
+	byColumn := func(row parquet.Row, column int) []parquet.Value {
+		var values []parquet.Value
+		row.Range(func(columnIndex int, columnValues []parquet.Value) bool {
+			if columnIndex == column {
+				values = columnValues
+			}
+			return true
+		})
+		return values
+	}
+
+	assert.Equal(t, int32(1), byColumn(rows[0], 0)[0].Int32())
+	assert.Equal(t, int32(1999), byColumn(rows[0], 1)[0].Int32())
+	assert.Equal(t, created.UnixMicro(), byColumn(rows[0], 2)[0].Int64())
+	assert.Equal(t, "first", byColumn(rows[0], 4)[0].String())
+
+	scores := byColumn(rows[0], 3)
+	require.Len(t, scores, 3)
+	assert.Equal(t, int64(1), scores[0].Int64())
+	assert.True(t, scores[1].IsNull())
+	assert.Equal(t, 2, scores[1].DefinitionLevel())
+	assert.Equal(t, 1, scores[2].RepetitionLevel())
+
+	// An empty array is defined but has no elements, a NULL array is not defined
+	assert.True(t, byColumn(rows[1], 1)[0].IsNull())
+	assert.Equal(t, 1, byColumn(rows[1], 3)[0].DefinitionLevel())
+	assert.Equal(t, 0, byColumn(rows[2], 3)[0].DefinitionLevel())
+	assert.Equal(t, "third", byColumn(rows[2], 4)[0].String())
+}
@@ -0,0 +1,245 @@
+package copy
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"pgcopy/internal/log"
+	"pgcopy/internal/schema"
+	"pgcopy/internal/storage"
+	"pgcopy/internal/tracing"
+)
+
+// LoadOptions configures how a single table stream is loaded
+type LoadOptions struct {
+	// Format is the stream format, FormatCSV by default
+	Format string
+	// Header reads the column names from the header row of CSV and TSV streams
+	Header bool
+	// Columns are the target columns of the fields of a CSV or TSV stream, in stream
+	// order. They are required when the stream has no header.
+	Columns []string
+	// Truncate empties the table before loading, in addition to the table's truncate setting
+	Truncate bool
+}
+
+// Dump writes a single table to w in an export format, applying the table's ignore,
+// transform, cast and filter rules. The stream is compressed as configured.
+func (e *Engine) Dump(ctx context.Context, table schema.TableInfo, w io.Writer, opts ExportOptions) (err error) {
+	if opts.Format == "" {
+		opts.Format = FormatCSV
+	}
+	if err := ValidateFormat(opts.Format); err != nil {
+		return err
+	}
+	if err := storage.ValidateCompression(opts.Compression); err != nil {
+		return err
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "copy.dump", trace.WithAttributes(tableAttributes(table)...))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	columns, err := e.getTableColumns(ctx, table)
+	if err != nil {
+		return fmt.Errorf("failed to get table columns: %w", err)
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("table %s.%s not found or has no columns to dump", table.Schema, table.Table)
+	}
+	if err := e.checkColumnsPolicy(ctx, table, columns); err != nil {
+		return fmt.Errorf("masking policy violated: %w", err)
+	}
+
+	selectQuery, err := e.buildSourceSelectQuery(table, columns)
+	if err != nil {
+		return fmt.Errorf("failed to build source query: %w", err)
+	}
+
+	conn, err := e.sourceConn.GetPool().Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire source connection: %w", err)
+	}
+	defer conn.Release()
+
+	restoreSource, err := prepareSourceSession(ctx, conn.Conn(), table)
+	if err != nil {
+		return fmt.Errorf("failed to prepare source session: %w", err)
+	}
+	defer restoreSource()
+
+	var rows int64
+	if opts.Format == FormatParquet {
+		log.Debug().Str("schema", table.Schema).Str("table", table.Table).Str("query", selectQuery).Msg("Executing dump")
+		rows, err = writeParquet(ctx, conn.Conn(), w, table.Table, selectQuery, opts)
+	} else {
+		query := exportCopyQuery(selectQuery, opts)
+		log.Debug().Str("schema", table.Schema).Str("table", table.Table).Str("query", query).Msg("Executing dump")
+		rows, err = exportCopy(ctx, conn.Conn(), nopWriteCloser{w}, query, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to dump table: %w", err)
+	}
+
+	e.incrementRowsCopied(rows)
+	span.SetAttributes(tracing.AttrRowsCopied.Int64(rows))
+	log.Info().Str("schema", table.Schema).Str("table", table.Table).Int64("rows_dumped", rows).Msg("Table dumped")
+	return nil
+}
+
+// Load reads a single table from r into the target, applying the table's truncate, load
+// and sequence settings. Compressed streams are detected from their content. Fields are
+// matched to the target columns by name, from the CSV or TSV header, the keys of JSON
+// Lines objects or the given columns, since the column order of the target may differ
+// from the stream's.
+func (e *Engine) Load(ctx context.Context, table schema.TableInfo, r io.Reader, opts LoadOptions) (err error) {
+	if opts.Format == "" {
+		opts.Format = FormatCSV
+	}
+	if err := ValidateFormat(opts.Format); err != nil {
+		return err
+	}
+	if opts.Format == FormatParquet {
+		return fmt.Errorf("loading %s streams is not supported", FormatParquet)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "copy.load", trace.WithAttributes(tableAttributes(table)...))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	table.Truncate = table.Truncate || opts.Truncate
+	// Without a source database, sequences can only follow the loaded values
+	if table.Sequences == schema.SequencesSource {
+		table.Sequences = schema.SequencesMax
+	}
+
+	// Ignored columns are expected to be absent from the stream, as written by Dump
+	targetColumns, err := tableColumns(ctx, e.targetConn.GetPool(), table)
+	if err != nil {
+		return fmt.Errorf("failed to get table columns: %w", err)
+	}
+	if len(targetColumns) == 0 {
+		return fmt.Errorf("table %s.%s not found or has no columns to load", table.Schema, table.Table)
+	}
+
+	in, err := storage.NewReader(io.NopCloser(r), "")
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	columns, stream, err := streamColumns(in, targetColumns, opts)
+	if err != nil {
+		return fmt.Errorf("failed to map stream columns of table %s.%s: %w", table.Schema, table.Table, err)
+	}
+
+	if table.Truncate {
+		if err := e.truncateTable(ctx, table); err != nil {
+			return err
+		}
+	}
+
+	rows, err := e.loadStream(ctx, table, columns, opts.Format, opts.Header, stream)
+	if err != nil {
+		return fmt.Errorf("failed to load table: %w", err)
+	}
+
+	e.incrementRowsCopied(rows)
+	span.SetAttributes(tracing.AttrRowsCopied.Int64(rows))
+	log.Info().Str("schema", table.Schema).Str("table", table.Table).Int64("rows_loaded", rows).Msg("Table loaded")
+
+	return e.finishLoad(ctx, table)
+}
+
+// streamColumns returns the target columns of a stream's fields: the given columns, the
+// names of the CSV or TSV header, or the keys of the first JSON Lines object. The returned
+// reader still holds the lines read to find them.
+func streamColumns(r io.Reader, targetColumns []string, opts LoadOptions) ([]string, io.Reader, error) {
+	if len(opts.Columns) > 0 {
+		if opts.Format == FormatJSONL {
+			return nil, nil, fmt.Errorf("columns cannot be given for %s streams, their keys name the columns", FormatJSONL)
+		}
+		return opts.Columns, r, checkStreamColumns(opts.Columns, targetColumns)
+	}
+	if opts.Format != FormatJSONL && !opts.Header {
+		return nil, nil, fmt.Errorf("a %s stream without a header needs its columns listed, the target column order may differ from the stream's", opts.Format)
+	}
+
+	buffered := bufio.NewReader(r)
+	line, err := buffered.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	stream := io.MultiReader(strings.NewReader(line), buffered)
+	if strings.TrimSpace(line) == "" {
+		// An empty stream loads no rows whatever its columns
+		return targetColumns, stream, nil
+	}
+
+	var columns []string
+	if opts.Format == FormatJSONL {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &object); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse first JSON Lines object: %w", err)
+		}
+		// Keys are unordered, so keep the target order of the columns present
+		for key := range object {
+			if !slices.Contains(targetColumns, key) {
+				return nil, nil, fmt.Errorf("column %q of the stream does not exist in the target table or is ignored", key)
+			}
+		}
+		for _, col := range targetColumns {
+			if _, ok := object[col]; ok {
+				columns = append(columns, col)
+			}
+		}
+	} else {
+		reader := csv.NewReader(strings.NewReader(line))
+		if opts.Format == FormatTSV {
+			reader.Comma = '\t'
+		}
+		if columns, err = reader.Read(); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse header: %w", err)
+		}
+	}
+
+	return columns, stream, checkStreamColumns(columns, targetColumns)
+}
+
+// checkStreamColumns checks that every stream column is a distinct column loaded into the target
+func checkStreamColumns(columns, targetColumns []string) error {
+	for i, col := range columns {
+		if !slices.Contains(targetColumns, col) {
+			return fmt.Errorf("column %q of the stream does not exist in the target table or is ignored", col)
+		}
+		if slices.Contains(columns[:i], col) {
+			return fmt.Errorf("column %q appears more than once in the stream", col)
+		}
+	}
+	return nil
+}
+
+// nopWriteCloser leaves the underlying writer open, e.g. stdout, and is used as a storage.File
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// Abort does nothing, what was written to a stream cannot be taken back
+func (nopWriteCloser) Abort(err error) {}
@@ -0,0 +1,107 @@
+package copy
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamColumns(t *testing.T) {
+	target := []string{"id", "name", "email"}
+
+	tests := []struct {
+		name     string
+		input    string
+		opts     LoadOptions
+		expected []string
+		wantErr  string
+	}{
+		{
+			name:     "csv header in a different order",
+			input:    "email,id,name\na@example.com,1,alice\n",
+			opts:     LoadOptions{Format: FormatCSV, Header: true},
+			expected: []string{"email", "id", "name"},
+		},
+		{
+			name:     "tsv header with a subset of columns",
+			input:    "name\tid\nalice\t1\n",
+			opts:     LoadOptions{Format: FormatTSV, Header: true},
+			expected: []string{"name", "id"},
+		},
+		{
+			name:     "quoted csv header",
+			input:    "\"id\",\"name\"\n1,alice\n",
+			opts:     LoadOptions{Format: FormatCSV, Header: true},
+			expected: []string{"id", "name"},
+		},
+		{
+			name:     "jsonl keys in target order",
+			input:    `{"email":"a@example.com","id":1}` + "\n",
+			opts:     LoadOptions{Format: FormatJSONL},
+			expected: []string{"id", "email"},
+		},
+		{
+			name:     "explicit columns without a header",
+			input:    "alice,1\n",
+			opts:     LoadOptions{Format: FormatCSV, Columns: []string{"name", "id"}},
+			expected: []string{"name", "id"},
+		},
+		{
+			name:     "empty stream",
+			input:    "",
+			opts:     LoadOptions{Format: FormatCSV, Header: true},
+			expected: target,
+		},
+		{
+			name:    "no header and no columns refused",
+			input:   "1,alice\n",
+			opts:    LoadOptions{Format: FormatCSV},
+			wantErr: "without a header needs its columns listed",
+		},
+		{
+			name:    "unknown header column",
+			input:   "id,password_hash\n1,x\n",
+			opts:    LoadOptions{Format: FormatCSV, Header: true},
+			wantErr: `column "password_hash"`,
+		},
+		{
+			name:    "unknown jsonl key",
+			input:   `{"id":1,"password_hash":"x"}` + "\n",
+			opts:    LoadOptions{Format: FormatJSONL},
+			wantErr: `column "password_hash"`,
+		},
+		{
+			name:    "duplicate column",
+			input:   "1,1\n",
+			opts:    LoadOptions{Format: FormatCSV, Columns: []string{"id", "id"}},
+			wantErr: "more than once",
+		},
+		{
+			name:    "columns with jsonl refused",
+			input:   `{"id":1}` + "\n",
+			opts:    LoadOptions{Format: FormatJSONL, Columns: []string{"id"}},
+			wantErr: "cannot be given",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns, stream, err := streamColumns(strings.NewReader(tt.input), target, tt.opts)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, columns)
+
+			// The lines read to find the columns are still in the stream
+			data, err := io.ReadAll(stream)
+			require.NoError(t, err)
+			assert.Equal(t, tt.input, string(data))
+		})
+	}
+}
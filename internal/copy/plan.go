@@ -0,0 +1,690 @@
+package copy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/trace"
+
+	"pgcopy/internal/log"
+	"pgcopy/internal/schema"
+	"pgcopy/internal/tracing"
+)
+
+// planVersion is the version of the plan file format
+const planVersion = 2
+
+// Plan is what a copy would do for every configured table. Saved to a file, it is
+// applied as is, without the configuration.
+type Plan struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Source and Target are the databases the plan was made against
+	Source DatabaseIdentity `json:"source"`
+	Target DatabaseIdentity `json:"target"`
+	Tables []TablePlan      `json:"tables"`
+}
+
+// DatabaseIdentity identifies a database a plan was made against
+type DatabaseIdentity struct {
+	// SystemIdentifier identifies the cluster, empty if pg_control_system() cannot be read
+	SystemIdentifier string `json:"system_identifier,omitempty"`
+	Database         string `json:"database"`
+	Host             string `json:"host"`
+	Port             uint16 `json:"port"`
+}
+
+// String describes the database for messages
+func (d DatabaseIdentity) String() string {
+	s := fmt.Sprintf("%s on %s:%d", d.Database, d.Host, d.Port)
+	if d.SystemIdentifier != "" {
+		s += fmt.Sprintf(" (system %s)", d.SystemIdentifier)
+	}
+	return s
+}
+
+// matches reports whether two identities name the same database. Clusters are compared by
+// system identifier when both are known, since the same server may be reached at another
+// address, and by address otherwise.
+func (d DatabaseIdentity) matches(other DatabaseIdentity) bool {
+	if d.Database != other.Database {
+		return false
+	}
+	if d.SystemIdentifier != "" && other.SystemIdentifier != "" {
+		return d.SystemIdentifier == other.SystemIdentifier
+	}
+	return d.Host == other.Host && d.Port == other.Port
+}
+
+// TablePlan is what a copy would do for one table
+type TablePlan struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// Query is the source query the table is read from, if any
+	Query   string   `json:"query,omitempty"`
+	Columns []string `json:"columns"`
+	// SourceQuery and TargetQuery are the exact COPY statements run on each database
+	SourceQuery string `json:"source_query"`
+	TargetQuery string `json:"target_query"`
+	// Lookups are the fingerprints of the lookup dictionaries the source query reads, by
+	// name. The values are not saved, they are taken from the configuration when applying.
+	Lookups map[string]string `json:"lookups,omitempty"`
+	// EstimatedRows and EstimatedBytes are the planner's estimates for the source select,
+	// filter included, -1 if unknown
+	EstimatedRows  int64 `json:"estimated_rows"`
+	EstimatedBytes int64 `json:"estimated_bytes"`
+	// Truncate is the statement emptying the target table, TruncateCascade the other
+	// target tables it empties through foreign keys
+	Truncate        string   `json:"truncate,omitempty"`
+	TruncateCascade []string `json:"truncate_cascade,omitempty"`
+	// Skipped columns are left out and Alter statements run by the schema check
+	Skipped   []string `json:"skipped,omitempty"`
+	Alter     []string `json:"alter,omitempty"`
+	Sequences []string `json:"sequences,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+	// Error is why the copy of the table would fail or be refused
+	Error string `json:"error,omitempty"`
+
+	Settings TableSettings `json:"settings"`
+	// SourceFingerprint and TargetFingerprint identify the columns of the source and
+	// target table, and the tables the truncate cascades to, when the plan was made
+	SourceFingerprint string `json:"source_fingerprint,omitempty"`
+	TargetFingerprint string `json:"target_fingerprint,omitempty"`
+	// Checksum is the SHA-256 of everything apply runs or checks for the table, to refuse
+	// a plan whose statements or settings were edited after planning
+	Checksum string `json:"checksum"`
+}
+
+// TableSettings are the settings a table's plan is applied with
+type TableSettings struct {
+	Sequences           string              `json:"sequences"`
+	RebuildIndexes      bool                `json:"rebuild_indexes,omitempty"`
+	RebuildConcurrently bool                `json:"rebuild_concurrently,omitempty"`
+	RebuildParallelism  int                 `json:"rebuild_parallelism,omitempty"`
+	DisableTriggers     bool                `json:"disable_triggers,omitempty"`
+	LoadSettings        schema.LoadSettings `json:"load_settings"`
+}
+
+// Failed returns the tables whose copy would fail or be refused
+func (p *Plan) Failed() []TablePlan {
+	var failed []TablePlan
+	for _, table := range p.Tables {
+		if table.Error != "" {
+			failed = append(failed, table)
+		}
+	}
+	return failed
+}
+
+// EstimatedRows returns the total estimated rows of the tables with an estimate
+func (p *Plan) EstimatedRows() int64 {
+	var total int64
+	for _, table := range p.Tables {
+		if table.EstimatedRows > 0 {
+			total += table.EstimatedRows
+		}
+	}
+	return total
+}
+
+// EstimatedBytes returns the total estimated bytes of the tables with an estimate
+func (p *Plan) EstimatedBytes() int64 {
+	var total int64
+	for _, table := range p.Tables {
+		if table.EstimatedBytes > 0 {
+			total += table.EstimatedBytes
+		}
+	}
+	return total
+}
+
+// truncateCascadeQuery lists the tables a TRUNCATE ... CASCADE of a table also empties,
+// following foreign keys referencing it transitively
+const truncateCascadeQuery = `
+	WITH RECURSIVE referencing(oid) AS (
+		SELECT con.conrelid
+		FROM pg_constraint con
+		WHERE con.contype = 'f' AND con.confrelid = $1::text::regclass
+		UNION
+		SELECT con.conrelid
+		FROM pg_constraint con
+		JOIN referencing r ON con.confrelid = r.oid
+		WHERE con.contype = 'f'
+	)
+	SELECT n.nspname, c.relname
+	FROM referencing r
+	JOIN pg_class c ON c.oid = r.oid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE r.oid <> $1::text::regclass
+	ORDER BY n.nspname, c.relname
+`
+
+// explainOutput is the part of EXPLAIN (FORMAT JSON) used for estimates
+type explainOutput []struct {
+	Plan struct {
+		Rows  float64 `json:"Plan Rows"`
+		Width int64   `json:"Plan Width"`
+	} `json:"Plan"`
+}
+
+// Plan resolves what a copy of every configured table would do without changing either
+// database: the copied columns, the COPY statements, size estimates and destructive
+// actions. Tables whose copy would fail are planned with an error.
+func (e *Engine) Plan(ctx context.Context, config *schema.Config) (plan *Plan, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.plan")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	plan = &Plan{Version: planVersion, CreatedAt: time.Now().UTC(), Tables: []TablePlan{}}
+	if e.sourceConn != nil && e.targetConn != nil {
+		if plan.Source, plan.Target, err = e.databaseIdentities(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for _, table := range config.GetAllTables() {
+		tablePlan := e.planTable(ctx, table)
+		tablePlan.Checksum = tablePlan.checksum()
+		plan.Tables = append(plan.Tables, tablePlan)
+	}
+	return plan, nil
+}
+
+// planTable resolves the copy of one table the way copyTable runs it
+func (e *Engine) planTable(ctx context.Context, table schema.TableInfo) TablePlan {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.plan_table", trace.WithAttributes(tableAttributes(table)...))
+	defer span.End()
+
+	plan := TablePlan{
+		Schema:         table.Schema,
+		Table:          table.Table,
+		Query:          table.Query,
+		EstimatedRows:  -1,
+		EstimatedBytes: -1,
+		Settings: TableSettings{
+			Sequences:           sequenceMode(table),
+			RebuildIndexes:      table.RebuildIndexes,
+			RebuildConcurrently: table.RebuildConcurrently,
+			RebuildParallelism:  table.RebuildParallelism,
+			DisableTriggers:     table.DisableTriggers,
+			LoadSettings:        table.LoadSettings,
+		},
+	}
+	if e.sourceConn == nil || e.targetConn == nil {
+		plan.Error = "not connected to the source and target databases"
+		return plan
+	}
+
+	var err error
+	if plan.SourceFingerprint, plan.TargetFingerprint, err = e.tableFingerprints(ctx, table); err != nil {
+		plan.Error = fmt.Sprintf("failed to read table definitions: %v", err)
+		return plan
+	}
+
+	resolution, err := e.resolveSchema(ctx, table)
+	if err != nil {
+		plan.Error = err.Error()
+		return plan
+	}
+	table = resolution.Table
+	plan.Skipped = resolution.Skipped
+	plan.Alter = resolution.Alter
+
+	columns, err := e.getTableColumns(ctx, table)
+	if err != nil {
+		plan.Error = fmt.Sprintf("failed to get table columns: %v", err)
+		return plan
+	}
+	plan.Columns = columns
+
+	if plan.SourceQuery, err = e.buildSourceCopyQuery(table, columns); err != nil {
+		plan.Error = err.Error()
+		return plan
+	}
+	if plan.TargetQuery, err = e.buildTargetCopyQuery(table, columns); err != nil {
+		plan.Error = err.Error()
+		return plan
+	}
+
+	for name, lookup := range table.Lookups {
+		if plan.Lookups == nil {
+			plan.Lookups = make(map[string]string)
+		}
+		plan.Lookups[name] = lookupFingerprint(lookup)
+	}
+
+	selectQuery, _ := e.buildSourceSelectQuery(table, columns)
+	if plan.EstimatedRows, plan.EstimatedBytes, err = estimateQuery(ctx, e.sourceConn.GetPool(), selectQuery); err != nil {
+		plan.Error = fmt.Sprintf("source select does not compile: %v", err)
+		return plan
+	}
+
+	if table.Truncate {
+		plan.Truncate = truncateStatement(table)
+		if plan.TruncateCascade, err = getTruncateCascade(ctx, e.targetConn.GetPool(), table); err != nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("failed to find tables emptied by the truncate cascade: %v", err))
+		}
+	}
+
+	if mode := sequenceMode(table); mode != schema.SequencesSkip {
+		sequences, err := getSequenceColumns(ctx, e.targetConn.GetPool(), table)
+		if err != nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("failed to look up target sequences: %v", err))
+		}
+		for _, col := range sequences {
+			plan.Sequences = append(plan.Sequences, fmt.Sprintf("%s (%s, %s)", col.Column, col.Sequence, mode))
+		}
+	}
+
+	if err := e.checkColumnsPolicy(ctx, table, columns); err != nil {
+		plan.Error = fmt.Sprintf("masking policy violated: %v", err)
+	}
+
+	return plan
+}
+
+// estimateQuery returns the planner's row and byte estimates for a query, which fails if
+// the query does not compile
+func estimateQuery(ctx context.Context, pool *pgxpool.Pool, query string) (int64, int64, error) {
+	var data []byte
+	if err := pool.QueryRow(ctx, "EXPLAIN (FORMAT JSON) "+query).Scan(&data); err != nil {
+		return -1, -1, err
+	}
+
+	var output explainOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		return -1, -1, fmt.Errorf("failed to parse query plan: %w", err)
+	}
+	if len(output) == 0 {
+		return -1, -1, fmt.Errorf("failed to parse query plan: empty plan")
+	}
+
+	rows := int64(output[0].Plan.Rows)
+	return rows, rows * output[0].Plan.Width, nil
+}
+
+// getTruncateCascade lists the target tables a truncate of the table also empties
+func getTruncateCascade(ctx context.Context, pool *pgxpool.Pool, table schema.TableInfo) ([]string, error) {
+	name := pgx.Identifier{table.Schema, table.Table}.Sanitize()
+	rows, err := pool.Query(ctx, truncateCascadeQuery, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var schemaName, tableName string
+		if err := rows.Scan(&schemaName, &tableName); err != nil {
+			return nil, err
+		}
+		tables = append(tables, schemaName+"."+tableName)
+	}
+	return tables, rows.Err()
+}
+
+// tableFingerprints returns the fingerprints of a table's source and target columns. The
+// target fingerprint covers the tables a truncate would cascade to as well.
+func (e *Engine) tableFingerprints(ctx context.Context, table schema.TableInfo) (string, string, error) {
+	source, err := e.getSourceColumnInfo(ctx, table)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read source columns: %w", err)
+	}
+	target, err := getColumnInfo(ctx, e.targetConn.GetPool(), table)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read target columns: %w", err)
+	}
+
+	var cascade []string
+	if table.Truncate && len(target) > 0 {
+		if cascade, err = getTruncateCascade(ctx, e.targetConn.GetPool(), table); err != nil {
+			return "", "", fmt.Errorf("failed to find tables emptied by the truncate cascade: %w", err)
+		}
+	}
+
+	return fingerprint(source), fingerprint(target, cascade...), nil
+}
+
+// fingerprint hashes column definitions and any extra values
+func fingerprint(columns []ColumnInfo, extra ...string) string {
+	h := sha256.New()
+	for _, col := range columns {
+		fmt.Fprintf(h, "%s %s %t %t\n", col.Name, col.Type, col.NotNull, col.HasDefault)
+	}
+	for _, value := range extra {
+		fmt.Fprintf(h, "+%s\n", value)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// checksum hashes the statements, columns, settings and fingerprints of a table's plan.
+// Estimates and warnings are left out since they do not change what apply does.
+func (t TablePlan) checksum() string {
+	data, _ := json.Marshal(struct {
+		Schema, Table, Query     string
+		Columns                  []string
+		SourceQuery, TargetQuery string
+		Lookups                  map[string]string
+		Truncate                 string
+		Alter                    []string
+		Settings                 TableSettings
+		SourceFingerprint        string
+		TargetFingerprint        string
+	}{
+		t.Schema, t.Table, t.Query,
+		t.Columns,
+		t.SourceQuery, t.TargetQuery,
+		t.Lookups,
+		t.Truncate,
+		t.Alter,
+		t.Settings,
+		t.SourceFingerprint,
+		t.TargetFingerprint,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupFingerprint hashes a lookup's dictionary and default
+func lookupFingerprint(lookup schema.Lookup) string {
+	// Maps are encoded with sorted keys, so equal dictionaries hash the same
+	data, _ := json.Marshal(struct {
+		Values  map[string]string
+		Default *string
+	}{lookup.Values, lookup.Default})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// OrderPlan sorts the tables of a plan so that referenced tables are copied first, and
+// warns about truncates cascading to tables copied before them
+func (e *Engine) OrderPlan(ctx context.Context, plan *Plan) error {
+	parents, err := getForeignKeyParents(ctx, e.targetConn.GetPool())
+	if err != nil {
+		return fmt.Errorf("failed to read target foreign keys: %w", err)
+	}
+
+	names := make([]string, len(plan.Tables))
+	byName := make(map[string]TablePlan, len(plan.Tables))
+	for i, table := range plan.Tables {
+		names[i] = table.Schema + "." + table.Table
+		byName[names[i]] = table
+	}
+
+	ordered, cyclic := orderByDependencies(names, parents)
+	if cyclic {
+		log.Warn().Msg("Foreign keys between planned tables form a cycle, copying those tables in configuration order")
+	}
+
+	for i, name := range ordered {
+		table := byName[name]
+		for _, emptied := range table.TruncateCascade {
+			if slices.Contains(ordered[:i], emptied) {
+				table.Warnings = append(table.Warnings,
+					fmt.Sprintf("truncate empties %s, which is copied before this table", emptied))
+			}
+		}
+		plan.Tables[i] = table
+	}
+	return nil
+}
+
+// ReadPlan reads a plan file
+func ReadPlan(r io.Reader) (*Plan, error) {
+	var plan Plan
+	if err := json.NewDecoder(r).Decode(&plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %w", err)
+	}
+	if plan.Version != planVersion {
+		return nil, fmt.Errorf("unsupported plan version %d", plan.Version)
+	}
+	return &plan, nil
+}
+
+// Apply executes a saved plan: the tables are copied in the plan's order with its COPY
+// statements, truncates and settings. The plan is refused if any table would fail, if it
+// was edited or if a source or target table changed since it was planned. The configuration
+// provides the dictionaries of the lookups the plan uses and the masking policy the planned
+// columns are checked against, and may be nil.
+func (e *Engine) Apply(ctx context.Context, plan *Plan, config *schema.Config) error {
+	log.Info().Int("total_tables", len(plan.Tables)).Time("planned_at", plan.CreatedAt).Msg("Applying plan")
+
+	ctx, span := tracing.Tracer().Start(ctx, "copy.apply", trace.WithAttributes(
+		tracing.AttrTables.Int(len(plan.Tables)),
+	))
+	defer span.End()
+
+	var lookups map[string]schema.Lookup
+	if config != nil {
+		lookups = config.Lookups
+	}
+	if err := e.verifyPlan(ctx, plan, lookups); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	if config != nil {
+		if err := e.checkPlanPolicy(ctx, plan, config); err != nil {
+			tracing.RecordError(span, err)
+			return err
+		}
+	}
+
+	for _, table := range plan.Tables {
+		if err := e.applyTable(ctx, table, lookups); err != nil {
+			e.addError(err)
+			log.Error().Err(err).Str("schema", table.Schema).Str("table", table.Table).Msg("Failed to copy table")
+		} else {
+			e.incrementTablesProcessed()
+			log.Info().Str("schema", table.Schema).Str("table", table.Table).Msg("Table copied successfully")
+		}
+	}
+
+	e.stats.EndTime = time.Now()
+
+	span.SetAttributes(
+		tracing.AttrRowsCopied.Int64(e.stats.RowsCopied),
+		tracing.AttrErrors.Int(len(e.stats.Errors)),
+	)
+
+	e.printSummary()
+	return nil
+}
+
+// verifyPlan checks that every table of a plan can be copied and was not edited, that it is
+// applied to the databases it was made against with the planned lookups and that no source
+// or target table changed since
+func (e *Engine) verifyPlan(ctx context.Context, plan *Plan, lookups map[string]schema.Lookup) error {
+	var errs []error
+	for _, table := range plan.Failed() {
+		errs = append(errs, fmt.Errorf("%s.%s: %s", table.Schema, table.Table, table.Error))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("plan cannot be applied, %d table(s) would fail: %w", len(errs), errors.Join(errs...))
+	}
+	if err := checkPlanChecksums(plan); err != nil {
+		return err
+	}
+	if err := checkPlanLookups(plan, lookups); err != nil {
+		return err
+	}
+
+	source, target, err := e.databaseIdentities(ctx)
+	if err != nil {
+		return err
+	}
+	if err := checkPlanDatabases(plan, source, target); err != nil {
+		return err
+	}
+
+	for _, table := range plan.Tables {
+		source, target, err := e.tableFingerprints(ctx, table.tableInfo())
+		if err != nil {
+			return fmt.Errorf("failed to check table %s.%s: %w", table.Schema, table.Table, err)
+		}
+		if source != table.SourceFingerprint {
+			errs = append(errs, fmt.Errorf("source table %s.%s changed", table.Schema, table.Table))
+		}
+		if target != table.TargetFingerprint {
+			errs = append(errs, fmt.Errorf("target table %s.%s changed", table.Schema, table.Table))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("schema changed since the plan was made, plan again: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// checkPlanChecksums checks that the tables of a plan were not edited since planning
+func checkPlanChecksums(plan *Plan) error {
+	var errs []error
+	for _, table := range plan.Tables {
+		if table.Checksum != table.checksum() {
+			errs = append(errs, fmt.Errorf("%s.%s", table.Schema, table.Table))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("plan was modified since it was made, plan again: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// checkPlanPolicy checks the planned columns of every table against the configured masking
+// policy, with the configured transformations of the table
+func (e *Engine) checkPlanPolicy(ctx context.Context, plan *Plan, config *schema.Config) error {
+	configured := make(map[string]schema.TableInfo)
+	for _, table := range config.GetAllTables() {
+		configured[table.Schema+"."+table.Table] = table
+	}
+
+	var errs []error
+	for _, planned := range plan.Tables {
+		table := planned.tableInfo()
+		table.Policy = config.Policy
+		table.Transform = configured[table.Schema+"."+table.Table].Transform
+		if err := e.checkColumnsPolicy(ctx, table, planned.Columns); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("masking policy violated: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// checkPlanLookups checks that the lookups a plan reads are configured with the planned
+// dictionaries
+func checkPlanLookups(plan *Plan, lookups map[string]schema.Lookup) error {
+	var errs []error
+	for _, table := range plan.Tables {
+		for _, name := range sortedKeys(table.Lookups) {
+			lookup, ok := lookups[name]
+			switch {
+			case !ok:
+				errs = append(errs, fmt.Errorf("%s.%s: lookup '%s' is not configured, give the configuration file with --file",
+					table.Schema, table.Table, name))
+			case lookupFingerprint(lookup) != table.Lookups[name]:
+				errs = append(errs, fmt.Errorf("%s.%s: lookup '%s' changed", table.Schema, table.Table, name))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("lookups differ from the plan, plan again: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// checkPlanDatabases checks that a plan is applied to the databases it was made against
+func checkPlanDatabases(plan *Plan, source, target DatabaseIdentity) error {
+	var errs []error
+	if !plan.Source.matches(source) {
+		errs = append(errs, fmt.Errorf("source is %s, plan was made against %s", source, plan.Source))
+	}
+	if !plan.Target.matches(target) {
+		errs = append(errs, fmt.Errorf("target is %s, plan was made against %s", target, plan.Target))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("plan was made against other databases: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// databaseIdentities identifies the source and target databases
+func (e *Engine) databaseIdentities(ctx context.Context) (source, target DatabaseIdentity, err error) {
+	if source, err = databaseIdentity(ctx, e.sourceConn.GetPool()); err != nil {
+		return source, target, fmt.Errorf("failed to identify source database: %w", err)
+	}
+	if target, err = databaseIdentity(ctx, e.targetConn.GetPool()); err != nil {
+		return source, target, fmt.Errorf("failed to identify target database: %w", err)
+	}
+	return source, target, nil
+}
+
+// databaseIdentity identifies the database a pool connects to. Reading the system identifier
+// needs pg_monitor or superuser rights, so it is left empty when it is not permitted.
+func databaseIdentity(ctx context.Context, pool *pgxpool.Pool) (DatabaseIdentity, error) {
+	config := pool.Config().ConnConfig
+	identity := DatabaseIdentity{Host: config.Host, Port: config.Port}
+	if err := pool.QueryRow(ctx, "SELECT current_database()").Scan(&identity.Database); err != nil {
+		return identity, err
+	}
+
+	var systemIdentifier string
+	if err := pool.QueryRow(ctx, "SELECT system_identifier::text FROM pg_control_system()").Scan(&systemIdentifier); err == nil {
+		identity.SystemIdentifier = systemIdentifier
+	} else {
+		log.Debug().Err(err).Str("database", identity.Database).Msg("System identifier not readable, plan checks the server address")
+	}
+	return identity, nil
+}
+
+// applyTable copies a single table as planned
+func (e *Engine) applyTable(ctx context.Context, plan TablePlan, lookups map[string]schema.Lookup) (err error) {
+	table := plan.tableInfo()
+	for name := range plan.Lookups {
+		if table.Lookups == nil {
+			table.Lookups = make(map[string]schema.Lookup)
+		}
+		table.Lookups[name] = lookups[name]
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "copy.apply_table", trace.WithAttributes(tableAttributes(table)...))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	for _, statement := range plan.Alter {
+		if _, err := e.targetConn.GetPool().Exec(ctx, statement); err != nil {
+			return fmt.Errorf("failed to alter target column: %w", err)
+		}
+		log.Info().Str("schema", table.Schema).Str("table", table.Table).Str("statement", statement).
+			Msg("Target table altered")
+	}
+
+	return e.loadTable(ctx, table, plan.SourceQuery, plan.TargetQuery)
+}
+
+// tableInfo returns the table settings a plan is applied with
+func (t TablePlan) tableInfo() schema.TableInfo {
+	return schema.TableInfo{
+		Schema:              t.Schema,
+		Table:               t.Table,
+		Query:               t.Query,
+		Truncate:            t.Truncate != "",
+		Sequences:           t.Settings.Sequences,
+		RebuildIndexes:      t.Settings.RebuildIndexes,
+		RebuildConcurrently: t.Settings.RebuildConcurrently,
+		RebuildParallelism:  t.Settings.RebuildParallelism,
+		DisableTriggers:     t.Settings.DisableTriggers,
+		LoadSettings:        t.Settings.LoadSettings,
+	}
+}
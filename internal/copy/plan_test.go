@@ -0,0 +1,267 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pgcopy/internal/schema"
+)
+
+func TestFingerprint(t *testing.T) {
+	columns := []ColumnInfo{
+		{Name: "id", Type: "integer", NotNull: true, HasDefault: true},
+		{Name: "email", Type: "text"},
+	}
+
+	assert.Equal(t, fingerprint(columns), fingerprint(columns))
+	assert.Len(t, fingerprint(columns), 64)
+
+	tests := []struct {
+		name    string
+		columns []ColumnInfo
+		extra   []string
+	}{
+		{"type changed", []ColumnInfo{columns[0], {Name: "email", Type: "character varying(255)"}}, nil},
+		{"nullability changed", []ColumnInfo{columns[0], {Name: "email", Type: "text", NotNull: true}}, nil},
+		{"column added", append([]ColumnInfo{{Name: "name", Type: "text"}}, columns...), nil},
+		{"column removed", columns[:1], nil},
+		{"columns reordered", []ColumnInfo{columns[1], columns[0]}, nil},
+		{"cascade added", columns, []string{"public.orders"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NotEqual(t, fingerprint(columns), fingerprint(tt.columns, tt.extra...))
+		})
+	}
+}
+
+func TestReadPlan(t *testing.T) {
+	plan := &Plan{
+		Version: planVersion,
+		Tables: []TablePlan{
+			{
+				Schema: "public", Table: "users", Columns: []string{"id", "email"},
+				SourceQuery: "COPY (SELECT id, email FROM public.users) TO STDOUT",
+				TargetQuery: "COPY public.users (id, email) FROM STDIN",
+				Truncate:    "TRUNCATE TABLE public.users CASCADE",
+				Settings: TableSettings{
+					Sequences:    schema.SequencesMax,
+					LoadSettings: schema.LoadSettings{SynchronousCommit: "off", Unlogged: true},
+				},
+				SourceFingerprint: "abc",
+				TargetFingerprint: "def",
+			},
+		},
+	}
+	data, err := json.Marshal(plan)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"synchronous_commit":"off"`)
+
+	read, err := ReadPlan(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, plan.Tables, read.Tables)
+
+	_, err = ReadPlan(strings.NewReader(`{"version": 1, "tables": []}`))
+	assert.ErrorContains(t, err, "unsupported plan version 1")
+
+	_, err = ReadPlan(strings.NewReader(`not json`))
+	assert.ErrorContains(t, err, "failed to parse plan")
+}
+
+func TestTablePlanTableInfo(t *testing.T) {
+	plan := TablePlan{
+		Schema:   "public",
+		Table:    "users",
+		Query:    "SELECT id FROM public.users",
+		Truncate: "TRUNCATE TABLE public.users CASCADE",
+		Settings: TableSettings{
+			Sequences:       schema.SequencesSkip,
+			RebuildIndexes:  true,
+			DisableTriggers: true,
+			LoadSettings:    schema.LoadSettings{Unlogged: true},
+		},
+	}
+
+	table := plan.tableInfo()
+	assert.Equal(t, "public", table.Schema)
+	assert.Equal(t, "users", table.Table)
+	assert.Equal(t, "SELECT id FROM public.users", table.Query)
+	assert.True(t, table.Truncate)
+	assert.Equal(t, schema.SequencesSkip, table.Sequences)
+	assert.True(t, table.RebuildIndexes)
+	assert.True(t, table.DisableTriggers)
+	assert.True(t, table.LoadSettings.Unlogged)
+
+	plan.Truncate = ""
+	assert.False(t, plan.tableInfo().Truncate)
+}
+
+func TestPlanTotalsAndFailures(t *testing.T) {
+	plan := &Plan{Tables: []TablePlan{
+		{Table: "users", EstimatedRows: 100, EstimatedBytes: 4000},
+		{Table: "orders", EstimatedRows: 50, EstimatedBytes: 1000},
+		{Table: "missing", EstimatedRows: -1, EstimatedBytes: -1, Error: "table does not exist in target"},
+	}}
+
+	assert.Equal(t, int64(150), plan.EstimatedRows())
+	assert.Equal(t, int64(5000), plan.EstimatedBytes())
+
+	failed := plan.Failed()
+	require.Len(t, failed, 1)
+	assert.Equal(t, "missing", failed[0].Table)
+}
+
+func TestApplyRefusesFailedPlan(t *testing.T) {
+	engine := &Engine{stats: &Stats{}}
+	plan := &Plan{Version: planVersion, Tables: []TablePlan{
+		{Schema: "public", Table: "missing", Error: "schema check failed: public.missing: table does not exist in target"},
+	}}
+
+	err := engine.Apply(context.Background(), plan, nil)
+	assert.ErrorContains(t, err, "plan cannot be applied, 1 table(s) would fail")
+	assert.ErrorContains(t, err, "public.missing: schema check failed")
+}
+
+func TestCheckPlanDatabases(t *testing.T) {
+	prod := DatabaseIdentity{SystemIdentifier: "7312", Database: "app", Host: "prod.example.com", Port: 5432}
+	dev := DatabaseIdentity{SystemIdentifier: "7400", Database: "app", Host: "dev.example.com", Port: 5432}
+	plan := &Plan{Version: planVersion, Source: prod, Target: dev}
+
+	tests := []struct {
+		name    string
+		source  DatabaseIdentity
+		target  DatabaseIdentity
+		wantErr []string
+	}{
+		{
+			name:   "same databases",
+			source: prod,
+			target: dev,
+		},
+		{
+			name:   "same cluster at another address",
+			source: DatabaseIdentity{SystemIdentifier: "7312", Database: "app", Host: "10.0.0.5", Port: 5432},
+			target: dev,
+		},
+		{
+			name:    "source and target swapped",
+			source:  dev,
+			target:  prod,
+			wantErr: []string{"source is app on dev.example.com:5432 (system 7400), plan was made against app on prod.example.com:5432 (system 7312)", "target is app on prod.example.com"},
+		},
+		{
+			name:    "other database of the same cluster",
+			source:  prod,
+			target:  DatabaseIdentity{SystemIdentifier: "7400", Database: "app_copy", Host: "dev.example.com", Port: 5432},
+			wantErr: []string{"target is app_copy on dev.example.com"},
+		},
+		{
+			name:    "system identifier unknown, other address",
+			source:  prod,
+			target:  DatabaseIdentity{Database: "app", Host: "staging.example.com", Port: 5432},
+			wantErr: []string{"target is app on staging.example.com:5432"},
+		},
+		{
+			name:   "system identifier unknown, same address",
+			source: prod,
+			target: DatabaseIdentity{Database: "app", Host: "dev.example.com", Port: 5432},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPlanDatabases(plan, tt.source, tt.target)
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, "plan was made against other databases")
+			for _, message := range tt.wantErr {
+				assert.ErrorContains(t, err, message)
+			}
+		})
+	}
+}
+
+func TestCheckPlanLookups(t *testing.T) {
+	unknown := "UNKNOWN"
+	codes := schema.Lookup{Values: map[string]string{"C-1": "Acme"}, Default: &unknown}
+	plan := &Plan{Version: planVersion, Tables: []TablePlan{
+		{Schema: "public", Table: "customers", Lookups: map[string]string{"codes": lookupFingerprint(codes)}},
+		{Schema: "public", Table: "orders"},
+	}}
+
+	assert.NoError(t, checkPlanLookups(plan, map[string]schema.Lookup{"codes": codes}))
+
+	err := checkPlanLookups(plan, nil)
+	assert.ErrorContains(t, err, "public.customers: lookup 'codes' is not configured, give the configuration file with --file")
+
+	changed := schema.Lookup{Values: map[string]string{"C-1": "Globex"}, Default: &unknown}
+	err = checkPlanLookups(plan, map[string]schema.Lookup{"codes": changed})
+	assert.ErrorContains(t, err, "public.customers: lookup 'codes' changed")
+
+	noDefault := schema.Lookup{Values: codes.Values}
+	err = checkPlanLookups(plan, map[string]schema.Lookup{"codes": noDefault})
+	assert.ErrorContains(t, err, "lookups differ from the plan")
+}
+
+func TestCheckPlanChecksums(t *testing.T) {
+	table := TablePlan{
+		Schema:      "public",
+		Table:       "users",
+		Columns:     []string{"id", "email"},
+		SourceQuery: `COPY (SELECT "id", encode(sha256("email"::bytea), 'hex') FROM "public"."users") TO STDOUT`,
+		TargetQuery: `COPY "public"."users" ("id", "email") FROM STDIN`,
+	}
+	table.Checksum = table.checksum()
+	plan := &Plan{Version: planVersion, Tables: []TablePlan{table}}
+	assert.NoError(t, checkPlanChecksums(plan))
+
+	// Estimates and warnings may change without affecting what is run
+	plan.Tables[0].EstimatedRows = 10
+	plan.Tables[0].Warnings = []string{"reviewed"}
+	assert.NoError(t, checkPlanChecksums(plan))
+
+	plan.Tables[0].SourceQuery = `COPY (SELECT "id", "email" FROM "public"."users") TO STDOUT`
+	err := checkPlanChecksums(plan)
+	assert.ErrorContains(t, err, "plan was modified since it was made, plan again")
+	assert.ErrorContains(t, err, "public.users")
+
+	plan.Tables[0] = table
+	plan.Tables[0].Settings.DisableTriggers = true
+	assert.Error(t, checkPlanChecksums(plan))
+
+	plan.Tables[0] = table
+	plan.Tables[0].Checksum = ""
+	assert.Error(t, checkPlanChecksums(plan))
+}
+
+func TestCheckPlanPolicy(t *testing.T) {
+	engine := &Engine{}
+	plan := &Plan{Version: planVersion, Tables: []TablePlan{
+		{Schema: "public", Table: "users", Columns: []string{"id", "email"}},
+	}}
+	config := func(transform map[string]string) *schema.Config {
+		return &schema.Config{
+			Schemas: []schema.Schema{{Name: "public", Tables: []schema.Table{{Name: "users", Transform: transform}}}},
+			Policy:  &schema.Policy{Columns: []string{"email"}},
+		}
+	}
+
+	assert.NoError(t, engine.checkPlanPolicy(context.Background(), plan, config(map[string]string{"email": "hash"})))
+
+	err := engine.checkPlanPolicy(context.Background(), plan, config(nil))
+	assert.ErrorContains(t, err, "masking policy violated")
+	assert.ErrorContains(t, err, "public.users.email")
+
+	// Tables missing from the configuration are checked without transformations
+	err = engine.checkPlanPolicy(context.Background(), plan, &schema.Config{Policy: &schema.Policy{Columns: []string{"email"}}})
+	assert.ErrorContains(t, err, "public.users.email")
+}
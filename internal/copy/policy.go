@@ -0,0 +1,170 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/trace"
+
+	"pgcopy/internal/schema"
+	"pgcopy/internal/tracing"
+)
+
+// enforcePolicy checks every table against the masking policy before any data is read,
+// so a single unmasked sensitive column stops the whole operation
+func (e *Engine) enforcePolicy(ctx context.Context, tables []schema.TableInfo) error {
+	var errs []error
+	for _, table := range tables {
+		if err := e.checkPolicy(ctx, table); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("masking policy violated: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// checkPolicy reports the source columns of a table that the policy marks as sensitive but
+// that are copied as is. The live columns are checked, so columns added to the source
+// after the configuration was written are caught too.
+func (e *Engine) checkPolicy(ctx context.Context, table schema.TableInfo) (err error) {
+	if !hasPolicy(table) {
+		return nil
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "copy.check_policy", trace.WithAttributes(tableAttributes(table)...))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	// Ignored columns are left out, so every listed column leaves the source
+	columns, err := e.getTableColumns(ctx, table)
+	if err != nil {
+		return fmt.Errorf("failed to get columns of table %s.%s: %w", table.Schema, table.Table, err)
+	}
+
+	return e.checkColumnsPolicy(ctx, table, columns)
+}
+
+// checkColumnsPolicy checks the copied columns of a table against the policy, resolving
+// the columns of a source query to the table columns they are read from
+func (e *Engine) checkColumnsPolicy(ctx context.Context, table schema.TableInfo, columns []string) error {
+	if !hasPolicy(table) {
+		return nil
+	}
+	origins, err := e.columnOrigins(ctx, table, columns)
+	if err != nil {
+		return fmt.Errorf("failed to resolve columns of table %s.%s: %w", table.Schema, table.Table, err)
+	}
+	return policyViolations(table, origins)
+}
+
+// hasPolicy reports whether a policy applies to a table
+func hasPolicy(table schema.TableInfo) bool {
+	return table.Policy != nil && len(table.Policy.Columns) > 0
+}
+
+// columnOrigin is a copied column and the table column its values are read from, which is
+// empty for values computed by a source query
+type columnOrigin struct {
+	Name   string
+	Schema string
+	Table  string
+	Column string
+}
+
+// originQuery looks up a table column by its table OID and attribute number
+const originQuery = `
+	SELECT n.nspname, c.relname, a.attname
+	FROM pg_attribute a
+	JOIN pg_class c ON c.oid = a.attrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE a.attrelid = $1 AND a.attnum = $2
+`
+
+// columnOrigins resolves the copied columns of a table to the table columns they are read
+// from. Source query columns take the origin the server reports for each result field, so
+// aliases and columns of other tables are checked under their real names.
+func (e *Engine) columnOrigins(ctx context.Context, table schema.TableInfo, columns []string) ([]columnOrigin, error) {
+	if table.Query == "" {
+		return tableColumnOrigins(table, columns), nil
+	}
+
+	conn, err := e.sourceConn.GetPool().Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire source connection: %w", err)
+	}
+	defer conn.Release()
+
+	fields, err := resultFields(ctx, conn.Conn(), table.Query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe source query: %w", err)
+	}
+
+	origins := make([]columnOrigin, 0, len(columns))
+	for _, col := range columns {
+		origin := columnOrigin{Name: col}
+		i := slices.IndexFunc(fields, func(f pgconn.FieldDescription) bool { return f.Name == col })
+		if i >= 0 && fields[i].TableOID != 0 && fields[i].TableAttributeNumber > 0 {
+			err := conn.QueryRow(ctx, originQuery, fields[i].TableOID, int16(fields[i].TableAttributeNumber)).
+				Scan(&origin.Schema, &origin.Table, &origin.Column)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return nil, fmt.Errorf("failed to look up origin of column %s: %w", col, err)
+			}
+		}
+		origins = append(origins, origin)
+	}
+	return origins, nil
+}
+
+// tableColumnOrigins returns the origins of columns read from the table itself
+func tableColumnOrigins(table schema.TableInfo, columns []string) []columnOrigin {
+	origins := make([]columnOrigin, len(columns))
+	for i, col := range columns {
+		origins[i] = columnOrigin{Name: col, Schema: table.Schema, Table: table.Table, Column: col}
+	}
+	return origins
+}
+
+// policyViolations returns an error naming the copied columns that match the policy
+// without being masked
+func policyViolations(table schema.TableInfo, columns []columnOrigin) error {
+	var errs []error
+	for _, col := range columns {
+		if problem := policyProblem(table, col); problem != "" {
+			errs = append(errs, fmt.Errorf("column %s.%s.%s %s", table.Schema, table.Table, col.Name, problem))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// policyProblem describes why a copied column violates the policy, or returns an empty
+// string. Both the column the values are read from and the copied name are matched, and
+// computed values are refused unless transformed or allowed, since their origin cannot
+// be checked.
+func policyProblem(table schema.TableInfo, col columnOrigin) string {
+	if !hasPolicy(table) || schema.Masks(table, col.Name) {
+		return ""
+	}
+	if col.Column == "" {
+		if !table.Policy.Allowed(table.Schema, table.Table, col.Name) {
+			return "is computed by the source query, so the policy cannot be checked against its origin, but is neither transformed nor allowed by the policy"
+		}
+	} else if pattern, sensitive := table.Policy.Sensitive(col.Schema, col.Table, col.Column); sensitive {
+		if col.Schema == table.Schema && col.Table == table.Table && col.Column == col.Name {
+			return fmt.Sprintf("matches sensitive pattern '%s' but is neither ignored nor transformed", pattern)
+		}
+		return fmt.Sprintf("is read from %s.%s.%s, which matches sensitive pattern '%s', but is neither ignored nor transformed",
+			col.Schema, col.Table, col.Column, pattern)
+	}
+	if pattern, sensitive := table.Policy.Sensitive(table.Schema, table.Table, col.Name); sensitive {
+		return fmt.Sprintf("matches sensitive pattern '%s' but is neither ignored nor transformed", pattern)
+	}
+	return ""
+}
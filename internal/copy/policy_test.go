@@ -0,0 +1,123 @@
+package copy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pgcopy/internal/schema"
+)
+
+func TestPolicyViolations(t *testing.T) {
+	policy := &schema.Policy{Columns: []string{"email", "*_token", "users.phone"}}
+
+	tests := []struct {
+		name       string
+		table      schema.TableInfo
+		columns    []string
+		origins    []columnOrigin
+		violations []string
+	}{
+		{
+			name:    "no policy",
+			table:   schema.TableInfo{Schema: "public", Table: "users"},
+			columns: []string{"id", "email"},
+		},
+		{
+			name: "sensitive columns masked",
+			table: schema.TableInfo{Schema: "public", Table: "users", Policy: policy,
+				Transform: map[string]string{"email": "hash", "phone": "redact"}},
+			columns: []string{"id", "email", "phone"},
+		},
+		{
+			name: "columns copied as is",
+			table: schema.TableInfo{Schema: "public", Table: "users", Policy: policy,
+				Transform: map[string]string{"email": "default"}},
+			columns:    []string{"id", "email", "phone", "reset_token"},
+			violations: []string{"public.users.email matches sensitive pattern", "public.users.phone matches sensitive pattern", "public.users.reset_token matches sensitive pattern"},
+		},
+		{
+			name:    "pattern for another table",
+			table:   schema.TableInfo{Schema: "public", Table: "orders", Policy: policy},
+			columns: []string{"id", "phone"},
+		},
+		{
+			name:  "aliased query column read from a sensitive column",
+			table: schema.TableInfo{Schema: "public", Table: "contacts", Query: "SELECT id, email AS contact FROM users", Policy: policy},
+			origins: []columnOrigin{
+				{Name: "id", Schema: "public", Table: "users", Column: "id"},
+				{Name: "contact", Schema: "public", Table: "users", Column: "email"},
+			},
+			violations: []string{"public.contacts.contact is read from public.users.email, which"},
+		},
+		{
+			name:  "query column read from another table",
+			table: schema.TableInfo{Schema: "public", Table: "orders", Query: "SELECT o.id, u.phone FROM orders o JOIN users u ON u.id = o.user_id", Policy: policy},
+			origins: []columnOrigin{
+				{Name: "id", Schema: "public", Table: "orders", Column: "id"},
+				{Name: "phone", Schema: "public", Table: "users", Column: "phone"},
+			},
+			violations: []string{"public.orders.phone is read from public.users.phone, which"},
+		},
+		{
+			name: "aliased query column transformed",
+			table: schema.TableInfo{Schema: "public", Table: "contacts", Query: "SELECT email AS contact FROM users", Policy: policy,
+				Transform: map[string]string{"contact": "hash"}},
+			origins: []columnOrigin{{Name: "contact", Schema: "public", Table: "users", Column: "email"}},
+		},
+		{
+			name:       "computed query column",
+			table:      schema.TableInfo{Schema: "public", Table: "contacts", Query: "SELECT lower(email) AS contact FROM users", Policy: policy},
+			origins:    []columnOrigin{{Name: "contact"}},
+			violations: []string{"public.contacts.contact is computed by the source query"},
+		},
+		{
+			name: "computed query column transformed",
+			table: schema.TableInfo{Schema: "public", Table: "contacts", Query: "SELECT lower(email) AS contact FROM users", Policy: policy,
+				Transform: map[string]string{"contact": "redact"}},
+			origins: []columnOrigin{{Name: "contact"}},
+		},
+		{
+			name: "computed query column allowed",
+			table: schema.TableInfo{Schema: "public", Table: "summary", Query: "SELECT count(*) AS order_count FROM orders",
+				Policy: &schema.Policy{Columns: policy.Columns, Allow: []string{"summary.order_count"}}},
+			origins: []columnOrigin{{Name: "order_count"}},
+		},
+		{
+			name: "allowed computed column with a sensitive name",
+			table: schema.TableInfo{Schema: "public", Table: "summary", Query: "SELECT lower(email) AS email FROM users",
+				Policy: &schema.Policy{Columns: policy.Columns, Allow: []string{"summary.*"}}},
+			origins:    []columnOrigin{{Name: "email"}},
+			violations: []string{"public.summary.email matches sensitive pattern 'email'"},
+		},
+		{
+			name: "identity transformation does not mask",
+			table: schema.TableInfo{Schema: "public", Table: "contacts", Query: "SELECT email AS contact FROM users", Policy: policy,
+				Transform: map[string]string{"contact": "contact"}},
+			origins:    []columnOrigin{{Name: "contact", Schema: "public", Table: "users", Column: "email"}},
+			violations: []string{"public.contacts.contact is read from public.users.email"},
+		},
+		{
+			name:    "computed query column without policy",
+			table:   schema.TableInfo{Schema: "public", Table: "contacts", Query: "SELECT lower(email) AS contact FROM users"},
+			origins: []columnOrigin{{Name: "contact"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origins := tt.origins
+			if origins == nil {
+				origins = tableColumnOrigins(tt.table, tt.columns)
+			}
+			err := policyViolations(tt.table, origins)
+			if len(tt.violations) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			for _, violation := range tt.violations {
+				assert.ErrorContains(t, err, "column "+violation)
+			}
+		})
+	}
+}
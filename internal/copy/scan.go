@@ -0,0 +1,292 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/trace"
+
+	"pgcopy/internal/log"
+	"pgcopy/internal/pii"
+	"pgcopy/internal/schema"
+	"pgcopy/internal/tracing"
+)
+
+// Defaults of ScanOptions
+const (
+	DefaultScanSampleSize = 1000
+	DefaultScanThreshold  = 0.5
+)
+
+// Detection methods reported in PIIFinding.DetectedBy
+const (
+	DetectedByName   = "name"
+	DetectedByValues = "values"
+)
+
+// ScanOptions configures a PII scan of the source database
+type ScanOptions struct {
+	// Schemas are the schemas scanned, every non-system schema if empty
+	Schemas []string
+	// SampleSize is the number of rows sampled per table, DefaultScanSampleSize if 0
+	SampleSize int
+	// Threshold is the share of sampled non-null values that must match a pattern for a
+	// column to be reported, DefaultScanThreshold if 0
+	Threshold float64
+	// Config marks findings already ignored or transformed by its tables, may be nil
+	Config *schema.Config
+}
+
+// PIIFinding is a column that probably holds personal data
+type PIIFinding struct {
+	Schema     string       `json:"schema"`
+	Table      string       `json:"table"`
+	Column     string       `json:"column"`
+	Type       string       `json:"type"`
+	Category   pii.Category `json:"category"`
+	DetectedBy string       `json:"detected_by"`
+	// Matched and Sampled count the values matching the category when detected by values
+	Matched int `json:"matched,omitempty"`
+	Sampled int `json:"sampled,omitempty"`
+	// Transform is the suggested transformation
+	Transform string `json:"transform"`
+	// Masked reports whether the configuration already ignores or transforms the column
+	Masked bool `json:"masked"`
+}
+
+// ScanReport holds the probable PII columns found by Scan
+type ScanReport struct {
+	Findings []PIIFinding `json:"findings"`
+}
+
+// scanTablesQuery lists the ordinary and partitioned tables of the given schemas, or of
+// every non-system schema if none are given
+const scanTablesQuery = `
+	SELECT n.nspname, c.relname
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('r', 'p') AND NOT c.relispartition
+	  AND ((cardinality($1::text[]) = 0 AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+	        AND n.nspname NOT LIKE 'pg\_%') OR n.nspname = ANY($1))
+	ORDER BY n.nspname, c.relname
+`
+
+// sampledTypes are the column types whose values are matched against PII patterns
+var sampledTypes = []string{"text", "character varying", "character", "inet", "cidr", "citext"}
+
+// Scan samples the tables of the source database and reports columns that probably hold
+// personal data, from their names and from the values they contain
+func (e *Engine) Scan(ctx context.Context, opts ScanOptions) (report *ScanReport, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.scan")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if opts.SampleSize <= 0 {
+		opts.SampleSize = DefaultScanSampleSize
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultScanThreshold
+	}
+
+	tables, err := e.scanTables(ctx, opts.Schemas)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	log.Info().Int("total_tables", len(tables)).Int("sample_size", opts.SampleSize).Msg("Starting PII scan")
+
+	masked := maskedColumns(opts.Config)
+	report = &ScanReport{Findings: []PIIFinding{}}
+	for _, table := range tables {
+		findings, err := e.scanTable(ctx, table, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan table %s.%s: %w", table.Schema, table.Table, err)
+		}
+		for i := range findings {
+			findings[i].Masked = masked[findings[i].Schema+"."+findings[i].Table+"."+findings[i].Column]
+		}
+		report.Findings = append(report.Findings, findings...)
+	}
+
+	log.Info().Int("findings", len(report.Findings)).Msg("PII scan completed")
+	return report, nil
+}
+
+// scanTables lists the tables to scan
+func (e *Engine) scanTables(ctx context.Context, schemas []string) ([]schema.TableInfo, error) {
+	if schemas == nil {
+		schemas = []string{}
+	}
+	rows, err := e.sourceConn.GetPool().Query(ctx, scanTablesQuery, schemas)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (schema.TableInfo, error) {
+		var table schema.TableInfo
+		err := row.Scan(&table.Schema, &table.Table)
+		return table, err
+	})
+}
+
+// scanTable checks the column names of a table and samples the values of its text columns
+func (e *Engine) scanTable(ctx context.Context, table schema.TableInfo, opts ScanOptions) ([]PIIFinding, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.scan_table", trace.WithAttributes(tableAttributes(table)...))
+	defer span.End()
+
+	columns, err := getColumnInfo(ctx, e.sourceConn.GetPool(), table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+
+	var sampled []ColumnInfo
+	for _, col := range columns {
+		if slices.Contains(sampledTypes, baseType(col.Type)) {
+			sampled = append(sampled, col)
+		}
+	}
+
+	matches, total, err := e.sampleValues(ctx, table, sampled, opts.SampleSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample values: %w", err)
+	}
+
+	var findings []PIIFinding
+	for _, col := range columns {
+		finding := PIIFinding{Schema: table.Schema, Table: table.Table, Column: col.Name, Type: col.Type}
+		if category, ok := pii.MatchName(col.Name); ok {
+			finding.Category = category
+			finding.DetectedBy = DetectedByName
+		}
+		if category, count := bestMatch(matches[col.Name]); total[col.Name] > 0 &&
+			float64(count) >= opts.Threshold*float64(total[col.Name]) {
+			// Values are stronger evidence than the name
+			finding.Category = category
+			finding.DetectedBy = DetectedByValues
+			finding.Matched = count
+			finding.Sampled = total[col.Name]
+		}
+		if finding.Category == "" {
+			continue
+		}
+
+		finding.Transform = pii.Transform(finding.Category)
+		findings = append(findings, finding)
+		log.Debug().Str("schema", table.Schema).Str("table", table.Table).Str("column", col.Name).
+			Str("category", string(finding.Category)).Str("detected_by", finding.DetectedBy).Msg("Probable PII column")
+	}
+	return findings, nil
+}
+
+// sampleValues reads up to limit rows of the given columns and counts, per column, the
+// non-null values and the values matching each PII category
+func (e *Engine) sampleValues(ctx context.Context, table schema.TableInfo, columns []ColumnInfo, limit int) (map[string]map[pii.Category]int, map[string]int, error) {
+	matches := make(map[string]map[pii.Category]int)
+	total := make(map[string]int)
+	if len(columns) == 0 {
+		return matches, total, nil
+	}
+
+	selected := make([]string, len(columns))
+	for i, col := range columns {
+		selected[i] = pgx.Identifier{col.Name}.Sanitize() + "::text"
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s LIMIT %d",
+		strings.Join(selected, ", "), pgx.Identifier{table.Schema, table.Table}.Sanitize(), limit)
+
+	rows, err := e.sourceConn.GetPool().Query(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	values := make([]*string, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		for i, value := range values {
+			if value == nil {
+				continue
+			}
+			name := columns[i].Name
+			total[name]++
+			if category, ok := pii.MatchValue(*value); ok {
+				if matches[name] == nil {
+					matches[name] = make(map[pii.Category]int)
+				}
+				matches[name][category]++
+			}
+		}
+	}
+	return matches, total, rows.Err()
+}
+
+// bestMatch returns the category matched by the most values
+func bestMatch(counts map[pii.Category]int) (pii.Category, int) {
+	var best pii.Category
+	count := 0
+	for category, n := range counts {
+		if n > count || n == count && category < best {
+			best, count = category, n
+		}
+	}
+	return best, count
+}
+
+// baseType strips the type modifier of a formatted type, e.g. character varying(255)
+func baseType(formatted string) string {
+	name, _, _ := strings.Cut(formatted, "(")
+	return strings.TrimSpace(name)
+}
+
+// maskedColumns returns the schema.table.column names a configuration ignores or transforms
+func maskedColumns(config *schema.Config) map[string]bool {
+	masked := make(map[string]bool)
+	if config == nil {
+		return masked
+	}
+	for _, table := range config.GetAllTables() {
+		prefix := table.Schema + "." + table.Table + "."
+		for _, col := range table.Ignore {
+			masked[prefix+col] = true
+		}
+		for col := range table.Transform {
+			masked[prefix+col] = true
+		}
+	}
+	return masked
+}
+
+// SuggestedConfig returns a configuration listing the tables with unmasked findings and
+// the suggested transformation of each column, grouped by schema
+func (r *ScanReport) SuggestedConfig() *schema.Config {
+	config := &schema.Config{}
+	for _, finding := range r.Findings {
+		if finding.Masked {
+			continue
+		}
+
+		i := slices.IndexFunc(config.Schemas, func(s schema.Schema) bool { return s.Name == finding.Schema })
+		if i < 0 {
+			config.Schemas = append(config.Schemas, schema.Schema{Name: finding.Schema})
+			i = len(config.Schemas) - 1
+		}
+		tables := &config.Schemas[i].Tables
+
+		j := slices.IndexFunc(*tables, func(t schema.Table) bool { return t.Name == finding.Table })
+		if j < 0 {
+			*tables = append(*tables, schema.Table{Name: finding.Table, Transform: map[string]string{}})
+			j = len(*tables) - 1
+		}
+		(*tables)[j].Transform[finding.Column] = finding.Transform
+	}
+	return config
+}
@@ -0,0 +1,68 @@
+package copy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pgcopy/internal/pii"
+	"pgcopy/internal/schema"
+)
+
+func TestBestMatch(t *testing.T) {
+	category, count := bestMatch(nil)
+	assert.Empty(t, category)
+	assert.Zero(t, count)
+
+	category, count = bestMatch(map[pii.Category]int{pii.Phone: 3, pii.Email: 7, pii.IPAddress: 7})
+	assert.Equal(t, pii.Email, category)
+	assert.Equal(t, 7, count)
+}
+
+func TestBaseType(t *testing.T) {
+	assert.Equal(t, "character varying", baseType("character varying(255)"))
+	assert.Equal(t, "text", baseType("text"))
+	assert.Equal(t, "text[]", baseType("text[]"))
+}
+
+func TestMaskedColumns(t *testing.T) {
+	assert.Empty(t, maskedColumns(nil))
+
+	config := &schema.Config{
+		Schemas: []schema.Schema{{
+			Name: "public",
+			Tables: []schema.Table{{
+				Name:      "users",
+				Ignore:    []string{"password_hash"},
+				Transform: map[string]string{"email": "hash"},
+			}},
+		}},
+	}
+	assert.Equal(t, map[string]bool{
+		"public.users.password_hash": true,
+		"public.users.email":         true,
+	}, maskedColumns(config))
+}
+
+func TestScanReport_SuggestedConfig(t *testing.T) {
+	report := &ScanReport{Findings: []PIIFinding{
+		{Schema: "public", Table: "users", Column: "email", Category: pii.Email, Transform: "hash"},
+		{Schema: "public", Table: "users", Column: "password_hash", Category: pii.Credential, Transform: "nullify", Masked: true},
+		{Schema: "public", Table: "users", Column: "phone", Category: pii.Phone, Transform: "redact"},
+		{Schema: "analytics", Table: "page_views", Column: "ip_address", Category: pii.IPAddress, Transform: "nullify"},
+	}}
+
+	config := report.SuggestedConfig()
+	require.Len(t, config.Schemas, 2)
+	assert.Equal(t, "public", config.Schemas[0].Name)
+	assert.Equal(t, []schema.Table{
+		{Name: "users", Transform: map[string]string{"email": "hash", "phone": "redact"}},
+	}, config.Schemas[0].Tables)
+	assert.Equal(t, "analytics", config.Schemas[1].Name)
+	assert.Equal(t, []schema.Table{
+		{Name: "page_views", Transform: map[string]string{"ip_address": "nullify"}},
+	}, config.Schemas[1].Tables)
+
+	assert.Empty(t, (&ScanReport{}).SuggestedConfig().Schemas)
+}
@@ -0,0 +1,166 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/trace"
+
+	"pgcopy/internal/log"
+	"pgcopy/internal/schema"
+	"pgcopy/internal/tracing"
+)
+
+// sequenceColumn is a column backed by a sequence, either SERIAL or IDENTITY
+type sequenceColumn struct {
+	Column   string
+	Sequence string
+}
+
+// sequenceColumnsQuery finds the owned sequences and identity columns of a table.
+// pg_get_serial_sequence returns a quoted, schema-qualified sequence name.
+const sequenceColumnsQuery = `
+	SELECT a.attname, pg_get_serial_sequence(format('%I.%I', n.nspname, c.relname), a.attname)
+	FROM pg_attribute a
+	JOIN pg_class c ON c.oid = a.attrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE n.nspname = $1 AND c.relname = $2
+	  AND a.attnum > 0 AND NOT a.attisdropped
+	  AND pg_get_serial_sequence(format('%I.%I', n.nspname, c.relname), a.attname) IS NOT NULL
+	ORDER BY a.attnum
+`
+
+// sequenceMode returns the effective sequence synchronization mode of a table
+func sequenceMode(table schema.TableInfo) string {
+	if table.Sequences == "" {
+		return schema.SequencesMax
+	}
+	return table.Sequences
+}
+
+// syncSequences advances the target sequences of a table after it has been copied
+func (e *Engine) syncSequences(ctx context.Context, table schema.TableInfo) (err error) {
+	mode := sequenceMode(table)
+	if mode == schema.SequencesSkip {
+		return nil
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "copy.sync_sequences", trace.WithAttributes(tableAttributes(table)...))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	targetColumns, err := getSequenceColumns(ctx, e.targetConn.GetPool(), table)
+	if err != nil {
+		return fmt.Errorf("failed to find target sequences: %w", err)
+	}
+	if len(targetColumns) == 0 {
+		return nil
+	}
+
+	sourceSequences := make(map[string]string)
+	if mode == schema.SequencesSource {
+		sourceColumns, err := getSequenceColumns(ctx, e.sourceConn.GetPool(), table)
+		if err != nil {
+			return fmt.Errorf("failed to find source sequences: %w", err)
+		}
+		for _, col := range sourceColumns {
+			sourceSequences[col.Column] = col.Sequence
+		}
+	}
+
+	for _, col := range targetColumns {
+		if sourceSequence, ok := sourceSequences[col.Column]; ok {
+			if err := e.mirrorSequence(ctx, sourceSequence, col.Sequence); err != nil {
+				return fmt.Errorf("failed to mirror sequence %s: %w", col.Sequence, err)
+			}
+			log.Info().
+				Str("schema", table.Schema).
+				Str("table", table.Table).
+				Str("column", col.Column).
+				Str("sequence", col.Sequence).
+				Msg("Sequence mirrored from source")
+			continue
+		}
+
+		if mode == schema.SequencesSource {
+			log.Warn().
+				Str("schema", table.Schema).
+				Str("table", table.Table).
+				Str("column", col.Column).
+				Msg("No matching source sequence, using column maximum")
+		}
+
+		value, err := e.setSequenceToMax(ctx, table, col)
+		if err != nil {
+			return fmt.Errorf("failed to set sequence %s: %w", col.Sequence, err)
+		}
+		log.Info().
+			Str("schema", table.Schema).
+			Str("table", table.Table).
+			Str("column", col.Column).
+			Str("sequence", col.Sequence).
+			Int64("value", value).
+			Msg("Sequence synchronized")
+	}
+
+	return nil
+}
+
+// setSequenceToMax sets the sequence to the column's maximum value, or resets it
+// to its start value when the table is empty. It returns the value that was set.
+func (e *Engine) setSequenceToMax(ctx context.Context, table schema.TableInfo, col sequenceColumn) (int64, error) {
+	pool := e.targetConn.GetPool()
+
+	var maxValue *int64
+	query := fmt.Sprintf("SELECT MAX(%s)::bigint FROM %s.%s", col.Column, table.Schema, table.Table)
+	if err := pool.QueryRow(ctx, query).Scan(&maxValue); err != nil {
+		return 0, err
+	}
+
+	var value int64
+	if maxValue == nil {
+		err := pool.QueryRow(ctx,
+			"SELECT setval($1::regclass, seqstart, false) FROM pg_sequence WHERE seqrelid = $1::regclass",
+			col.Sequence).Scan(&value)
+		return value, err
+	}
+
+	err := pool.QueryRow(ctx, "SELECT setval($1::regclass, $2, true)", col.Sequence, *maxValue).Scan(&value)
+	return value, err
+}
+
+// mirrorSequence copies the state of a source sequence onto a target sequence
+func (e *Engine) mirrorSequence(ctx context.Context, sourceSequence, targetSequence string) error {
+	var lastValue int64
+	var isCalled bool
+	query := fmt.Sprintf("SELECT last_value, is_called FROM %s", sourceSequence)
+	if err := e.sourceConn.GetPool().QueryRow(ctx, query).Scan(&lastValue, &isCalled); err != nil {
+		return err
+	}
+
+	_, err := e.targetConn.GetPool().Exec(ctx, "SELECT setval($1::regclass, $2, $3)", targetSequence, lastValue, isCalled)
+	return err
+}
+
+// getSequenceColumns returns the sequence-backed columns of a table
+func getSequenceColumns(ctx context.Context, pool *pgxpool.Pool, table schema.TableInfo) ([]sequenceColumn, error) {
+	rows, err := pool.Query(ctx, sequenceColumnsQuery, table.Schema, table.Table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []sequenceColumn
+	for rows.Next() {
+		var col sequenceColumn
+		if err := rows.Scan(&col.Column, &col.Sequence); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+
+	return columns, rows.Err()
+}
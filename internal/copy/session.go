@@ -0,0 +1,150 @@
+package copy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"pgcopy/internal/log"
+	"pgcopy/internal/schema"
+)
+
+// insufficientPrivilege is the SQLSTATE returned when a setting requires more privileges
+const insufficientPrivilege = "42501"
+
+// undoFunc reverts one change made to the target session
+type undoFunc func(ctx context.Context) error
+
+// prepareTargetSession applies the per-table settings to the connection used for the
+// target COPY. The returned function reverts them in reverse order and must always be
+// called; if a setting cannot be reverted the connection is closed so that the pool
+// never hands out a session with leftover state.
+func (e *Engine) prepareTargetSession(ctx context.Context, conn *pgx.Conn, table schema.TableInfo) (func(), error) {
+	var undos []undoFunc
+
+	restore := func() {
+		// Revert even when the copy was cancelled
+		ctx := context.WithoutCancel(ctx)
+		for i := len(undos) - 1; i >= 0; i-- {
+			if err := undos[i](ctx); err != nil {
+				log.Error().Err(err).Str("schema", table.Schema).Str("table", table.Table).
+					Msg("Failed to restore target session, closing connection")
+				conn.Close(ctx)
+				return
+			}
+		}
+	}
+
+	if table.DisableTriggers {
+		undo, err := disableTriggers(ctx, conn, table)
+		if err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to disable triggers: %w", err)
+		}
+		undos = append(undos, undo)
+	}
+
+	settingUndos, err := applySessionSettings(ctx, conn, table)
+	undos = append(undos, settingUndos...)
+	if err != nil {
+		restore()
+		return nil, fmt.Errorf("failed to apply load settings: %w", err)
+	}
+
+	if table.LoadSettings.Unlogged {
+		undo, err := setUnlogged(ctx, conn, table)
+		if err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to set table unlogged: %w", err)
+		}
+		if undo != nil {
+			undos = append(undos, undo)
+		}
+	}
+
+	return restore, nil
+}
+
+// prepareSourceSession stores the dictionaries of a table's lookups in settings of the
+// connection running the source query, which reads them there instead of inlining the
+// values in the statement. The returned function clears them and must always be called;
+// if they cannot be cleared the connection is closed.
+func prepareSourceSession(ctx context.Context, conn *pgx.Conn, table schema.TableInfo) (func(), error) {
+	var settings []string
+
+	restore := func() {
+		ctx := context.WithoutCancel(ctx)
+		for _, setting := range settings {
+			if _, err := conn.Exec(ctx, "SELECT set_config($1, '', false)", setting); err != nil {
+				log.Error().Err(err).Str("schema", table.Schema).Str("table", table.Table).
+					Msg("Failed to restore source session, closing connection")
+				conn.Close(ctx)
+				return
+			}
+		}
+	}
+
+	for name, lookup := range table.Lookups {
+		values := lookup.Values
+		if values == nil {
+			values = map[string]string{}
+		}
+		dictionary, err := json.Marshal(values)
+		if err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to encode lookup '%s': %w", name, err)
+		}
+
+		setting := lookupSetting(name)
+		if _, err := conn.Exec(ctx, "SELECT set_config($1, $2, false)", setting, string(dictionary)); err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to set lookup '%s': %w", name, err)
+		}
+		settings = append(settings, setting)
+	}
+
+	return restore, nil
+}
+
+// disableTriggers stops triggers from firing during the load. It prefers
+// session_replication_role=replica, which also skips FK enforcement and only affects
+// this session; without the privilege to set it, user triggers are disabled on the
+// table instead, which affects every session until they are re-enabled.
+func disableTriggers(ctx context.Context, conn *pgx.Conn, table schema.TableInfo) (undoFunc, error) {
+	_, err := conn.Exec(ctx, "SET session_replication_role = replica")
+	if err == nil {
+		log.Info().Str("schema", table.Schema).Str("table", table.Table).Msg("Triggers disabled with session_replication_role")
+		return func(ctx context.Context) error {
+			_, err := conn.Exec(ctx, "RESET session_replication_role")
+			return err
+		}, nil
+	}
+	if !isInsufficientPrivilege(err) {
+		return nil, err
+	}
+
+	log.Warn().Str("schema", table.Schema).Str("table", table.Table).
+		Msg("Not allowed to set session_replication_role, disabling user triggers on the table instead")
+
+	if _, err := conn.Exec(ctx, fmt.Sprintf("ALTER TABLE %s.%s DISABLE TRIGGER USER", table.Schema, table.Table)); err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context) error {
+		_, err := conn.Exec(ctx, fmt.Sprintf("ALTER TABLE %s.%s ENABLE TRIGGER USER", table.Schema, table.Table))
+		if err == nil {
+			log.Info().Str("schema", table.Schema).Str("table", table.Table).Msg("User triggers re-enabled")
+		}
+		return err
+	}, nil
+}
+
+// isInsufficientPrivilege reports whether err is a PostgreSQL permission error
+func isInsufficientPrivilege(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == insufficientPrivilege
+}
@@ -0,0 +1,19 @@
+package copy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsInsufficientPrivilege(t *testing.T) {
+	denied := &pgconn.PgError{Code: "42501", Message: "permission denied to set parameter \"session_replication_role\""}
+	other := &pgconn.PgError{Code: "42P01", Message: "relation does not exist"}
+
+	assert.True(t, isInsufficientPrivilege(denied))
+	assert.True(t, isInsufficientPrivilege(fmt.Errorf("wrapped: %w", denied)))
+	assert.False(t, isInsufficientPrivilege(other))
+	assert.False(t, isInsufficientPrivilege(assert.AnError))
+}
@@ -0,0 +1,278 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/trace"
+
+	"pgcopy/internal/log"
+	"pgcopy/internal/schema"
+	"pgcopy/internal/tracing"
+)
+
+// Checks reported in Problem.Check
+const (
+	CheckTable      = "table"
+	CheckColumn     = "column"
+	CheckSQL        = "sql"
+	CheckSchema     = "schema"
+	CheckPermission = "permission"
+	CheckPolicy     = "policy"
+)
+
+// Problem is a reason the copy of a table would fail or is not allowed
+type Problem struct {
+	Schema  string `json:"schema"`
+	Table   string `json:"table"`
+	Column  string `json:"column,omitempty"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// ValidationReport holds the problems found for all configured tables
+type ValidationReport struct {
+	Problems []Problem `json:"problems"`
+}
+
+// tablePrivilegesQuery reports the privileges of the current user on a table. The owner
+// check covers statements that need ownership, such as disabling triggers.
+const tablePrivilegesQuery = `
+	SELECT has_table_privilege($1::text, 'SELECT'),
+	       has_table_privilege($1::text, 'INSERT'),
+	       has_table_privilege($1::text, 'TRUNCATE'),
+	       pg_has_role((SELECT relowner FROM pg_class WHERE oid = $1::text::regclass), 'USAGE')
+`
+
+// tablePrivileges are the privileges of the current user on a table
+type tablePrivileges struct {
+	Select, Insert, Truncate, Owner bool
+}
+
+// Validate checks every configured table against the source and target databases and
+// reports all problems at once: missing tables and columns, rules naming columns that do
+// not exist, filters and transformations that do not compile, target columns that cannot
+// take the copied values, missing privileges and masking policy violations
+func (e *Engine) Validate(ctx context.Context, config *schema.Config) (report *ValidationReport, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.validate")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	report = &ValidationReport{Problems: []Problem{}}
+	for _, table := range config.GetAllTables() {
+		problems, err := e.validateTable(ctx, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to validate table %s.%s: %w", table.Schema, table.Table, err)
+		}
+		report.Problems = append(report.Problems, problems...)
+	}
+
+	log.Info().Int("problems", len(report.Problems)).Msg("Validation completed")
+	return report, nil
+}
+
+// validateTable checks one table, returning an error only when a database cannot be queried
+func (e *Engine) validateTable(ctx context.Context, table schema.TableInfo) ([]Problem, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "copy.validate_table", trace.WithAttributes(tableAttributes(table)...))
+	defer span.End()
+
+	var problems []Problem
+	add := func(column, check, format string, args ...any) {
+		problems = append(problems, Problem{
+			Schema: table.Schema, Table: table.Table, Column: column, Check: check,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	source, err := e.getSourceColumnInfo(ctx, table)
+	if err != nil {
+		if table.Query == "" {
+			return nil, fmt.Errorf("failed to read source columns: %w", err)
+		}
+		add("", CheckSQL, "source query does not compile: %v", err)
+	} else if len(source) == 0 {
+		add("", CheckTable, "table does not exist in source")
+	}
+
+	target, err := getColumnInfo(ctx, e.targetConn.GetPool(), table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target columns: %w", err)
+	}
+	if len(target) == 0 {
+		add("", CheckTable, "table does not exist in target")
+	}
+
+	if len(source) == 0 {
+		return problems, nil
+	}
+
+	// Rules naming columns the source does not have are most likely typos
+	sourceNames := make([]string, len(source))
+	for i, col := range source {
+		sourceNames[i] = col.Name
+	}
+	for _, rule := range []struct {
+		name    string
+		columns []string
+	}{
+		{"ignored", table.Ignore},
+		{"transformed", sortedKeys(table.Transform)},
+		{"cast", sortedKeys(table.Cast)},
+	} {
+		for _, col := range rule.columns {
+			if !slices.Contains(sourceNames, col) {
+				add(col, CheckColumn, "%s column does not exist in source", rule.name)
+			}
+		}
+	}
+
+	if len(target) > 0 {
+		mode := schemaCheckMode(table)
+		for _, d := range compareColumns(table, source, target) {
+			if d.Kind == DiffTypeMismatch {
+				table = resolveCast(table, &d)
+			}
+			if !d.Blocking || resolvedBySchemaCheck(mode, d) {
+				continue
+			}
+			add(d.Column, CheckSchema, "%s", d.Message)
+		}
+	}
+
+	if err := e.explainSource(ctx, table); err != nil {
+		add("", CheckSQL, "source select does not compile: %v", err)
+	}
+
+	privilegeProblems, err := e.checkPrivileges(ctx, table, len(target) > 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, message := range privilegeProblems {
+		add("", CheckPermission, "%s", message)
+	}
+
+	if hasPolicy(table) {
+		var copied []string
+		for _, col := range sourceNames {
+			if !slices.Contains(table.Ignore, col) {
+				copied = append(copied, col)
+			}
+		}
+		origins, err := e.columnOrigins(ctx, table, copied)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve source columns: %w", err)
+		}
+		for _, col := range origins {
+			if problem := policyProblem(table, col); problem != "" {
+				add(col.Name, CheckPolicy, "column %s", problem)
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// resolvedBySchemaCheck reports whether the schema check mode resolves a blocking
+// difference when copying, by leaving the column out or altering the target
+func resolvedBySchemaCheck(mode string, d Difference) bool {
+	switch mode {
+	case schema.SchemaCheckSkip:
+		return d.Kind == DiffMissingColumn || d.Kind == DiffTypeMismatch
+	case schema.SchemaCheckAlter:
+		return alterStatement(d) != ""
+	}
+	return false
+}
+
+// explainSource plans the source query of a table, which fails if a filter, transformation
+// or cast does not compile
+func (e *Engine) explainSource(ctx context.Context, table schema.TableInfo) error {
+	columns, err := e.getTableColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+	query, err := e.buildSourceSelectQuery(table, columns)
+	if err != nil {
+		return err
+	}
+
+	rows, err := e.sourceConn.GetPool().Query(ctx, "EXPLAIN "+query)
+	if err != nil {
+		return err
+	}
+	rows.Close()
+	return rows.Err()
+}
+
+// checkPrivileges returns the privileges missing to read the source table and load the
+// target table with the table's settings
+func (e *Engine) checkPrivileges(ctx context.Context, table schema.TableInfo, targetExists bool) ([]string, error) {
+	var missing []string
+
+	// Query sources need no table privilege, the query is checked when it is planned
+	if table.Query == "" {
+		source, err := getTablePrivileges(ctx, e.sourceConn.GetPool(), table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read source privileges: %w", err)
+		}
+		if !source.Select {
+			missing = append(missing, "SELECT privilege missing on source table")
+		}
+	}
+
+	if !targetExists {
+		return missing, nil
+	}
+
+	target, err := getTablePrivileges(ctx, e.targetConn.GetPool(), table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target privileges: %w", err)
+	}
+	if !target.Insert {
+		missing = append(missing, "INSERT privilege missing on target table")
+	}
+	if table.Truncate && !target.Truncate {
+		missing = append(missing, "TRUNCATE privilege missing on target table, required by truncate")
+	}
+	if !target.Owner {
+		for _, setting := range []struct {
+			name    string
+			enabled bool
+		}{
+			{"disable_triggers", table.DisableTriggers},
+			{"rebuild_indexes", table.RebuildIndexes},
+			{"load_settings.unlogged", table.LoadSettings.Unlogged},
+		} {
+			if setting.enabled {
+				missing = append(missing, fmt.Sprintf("target table must be owned by the current user, required by %s", setting.name))
+			}
+		}
+	}
+
+	return missing, nil
+}
+
+// getTablePrivileges reads the privileges of the current user on a table
+func getTablePrivileges(ctx context.Context, pool *pgxpool.Pool, table schema.TableInfo) (tablePrivileges, error) {
+	var privileges tablePrivileges
+	name := pgx.Identifier{table.Schema, table.Table}.Sanitize()
+	err := pool.QueryRow(ctx, tablePrivilegesQuery, name).
+		Scan(&privileges.Select, &privileges.Insert, &privileges.Truncate, &privileges.Owner)
+	return privileges, err
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,41 @@
+package copy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pgcopy/internal/schema"
+)
+
+func TestResolvedBySchemaCheck(t *testing.T) {
+	missing := Difference{Schema: "public", Table: "users", Column: "nickname", Kind: DiffMissingColumn, SourceType: "text"}
+	mismatch := Difference{Schema: "public", Table: "users", Column: "age", Kind: DiffTypeMismatch, SourceType: "bigint", TargetType: "integer"}
+	required := Difference{Schema: "public", Table: "users", Column: "tenant_id", Kind: DiffExtraColumn, TargetType: "integer"}
+
+	tests := []struct {
+		mode       string
+		difference Difference
+		resolved   bool
+	}{
+		{mode: schema.SchemaCheckFail, difference: missing, resolved: false},
+		{mode: schema.SchemaCheckOff, difference: mismatch, resolved: false},
+		{mode: schema.SchemaCheckSkip, difference: missing, resolved: true},
+		{mode: schema.SchemaCheckSkip, difference: mismatch, resolved: true},
+		{mode: schema.SchemaCheckSkip, difference: required, resolved: false},
+		{mode: schema.SchemaCheckAlter, difference: missing, resolved: true},
+		{mode: schema.SchemaCheckAlter, difference: mismatch, resolved: true},
+		{mode: schema.SchemaCheckAlter, difference: required, resolved: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+tt.difference.Kind, func(t *testing.T) {
+			assert.Equal(t, tt.resolved, resolvedBySchemaCheck(tt.mode, tt.difference))
+		})
+	}
+}
+
+func TestSortedKeys(t *testing.T) {
+	assert.Empty(t, sortedKeys(nil))
+	assert.Equal(t, []string{"a", "b", "c"}, sortedKeys(map[string]string{"c": "", "a": "", "b": ""}))
+}
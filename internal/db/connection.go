@@ -6,52 +6,128 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+
+	"pgcopy/internal/log"
+	"pgcopy/internal/tracing"
+)
+
+// Default pool sizing used when the options do not size the pool
+const (
+	defaultMaxConns = 10
+	defaultMinConns = 2
 )
 
 // Connection represents a database connection
 type Connection struct {
-	pool *pgxpool.Pool
-	url  string
+	pool   *pgxpool.Pool
+	url    string
+	tunnel *Tunnel
+}
+
+// Options holds connection settings that cannot be expressed in a connection string
+type Options struct {
+	// Tunnel routes every connection through an SSH bastion when set
+	Tunnel *TunnelConfig
+	// MaxConns and MinConns size the pool, the defaults apply when zero
+	MaxConns int32
+	MinConns int32
 }
 
 // NewConnection creates a new database connection
 func NewConnection(ctx context.Context, url string) (*Connection, error) {
+	return NewConnectionWithOptions(ctx, url, Options{})
+}
+
+// NewConnectionWithOptions creates a new database connection using the given options
+func NewConnectionWithOptions(ctx context.Context, url string, opts Options) (conn *Connection, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "db.connect")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
 	config, err := pgxpool.ParseConfig(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse connection string: %w", err)
 	}
 
-	// Set reasonable defaults
-	config.MaxConns = 10
-	config.MinConns = 2
+	span.SetAttributes(
+		attribute.String("server.address", config.ConnConfig.Host),
+		attribute.Int("server.port", int(config.ConnConfig.Port)),
+		attribute.String("db.name", config.ConnConfig.Database),
+	)
+
+	applyPoolSize(config, opts)
 	config.MaxConnLifetime = 30 * time.Minute
 	config.MaxConnIdleTime = 5 * time.Minute
 
+	var tunnel *Tunnel
+	if opts.Tunnel != nil {
+		tunnel, err = OpenTunnel(ctx, *opts.Tunnel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open ssh tunnel: %w", err)
+		}
+		span.SetAttributes(attribute.String("pgcopy.ssh_tunnel", tunnel.addr))
+
+		// Hostnames are resolved by the bastion, which may see private DNS
+		config.ConnConfig.DialFunc = tunnel.DialContext
+		config.ConnConfig.LookupFunc = func(ctx context.Context, host string) ([]string, error) {
+			return []string{host}, nil
+		}
+		log.Info().Str("ssh_host", tunnel.addr).Msg("SSH tunnel established")
+	}
+
 	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
+		closeTunnel(tunnel)
 		return nil, fmt.Errorf("failed to create connection pool: %w", err)
 	}
 
 	// Test the connection
 	if err := pool.Ping(ctx); err != nil {
 		pool.Close()
+		closeTunnel(tunnel)
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Info().Str("url", maskPassword(url)).Msg("Database connection established")
+	log.Info().Str("url", log.MaskConnectionString(url)).Msg("Database connection established")
 
 	return &Connection{
-		pool: pool,
-		url:  url,
+		pool:   pool,
+		url:    url,
+		tunnel: tunnel,
 	}, nil
 }
 
+// applyPoolSize sizes the pool from the options, with reasonable defaults
+func applyPoolSize(config *pgxpool.Config, opts Options) {
+	config.MaxConns = defaultMaxConns
+	if opts.MaxConns > 0 {
+		config.MaxConns = opts.MaxConns
+	}
+	config.MinConns = min(defaultMinConns, config.MaxConns)
+	if opts.MinConns > 0 {
+		config.MinConns = opts.MinConns
+	}
+}
+
 // Close closes the database connection
 func (c *Connection) Close() {
 	if c.pool != nil {
 		c.pool.Close()
-		log.Info().Str("url", maskPassword(c.url)).Msg("Database connection closed")
+		log.Info().Str("url", log.MaskConnectionString(c.url)).Msg("Database connection closed")
+	}
+	closeTunnel(c.tunnel)
+}
+
+// closeTunnel closes an SSH tunnel if one was opened
+func closeTunnel(tunnel *Tunnel) {
+	if tunnel == nil {
+		return
+	}
+	if err := tunnel.Close(); err != nil {
+		log.Warn().Err(err).Str("ssh_host", tunnel.addr).Msg("Failed to close SSH tunnel")
 	}
 }
 
@@ -60,15 +136,6 @@ func (c *Connection) GetPool() *pgxpool.Pool {
 	return c.pool
 }
 
-// maskPassword masks the password in the connection string for logging
-func maskPassword(url string) string {
-	// Simple masking - in production you might want more sophisticated masking
-	if len(url) > 10 {
-		return url[:10] + "***"
-	}
-	return "***"
-}
-
 // TestConnection tests if the connection is still valid
 func (c *Connection) TestConnection(ctx context.Context) error {
 	return c.pool.Ping(ctx)
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyPoolSize(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		opts        Options
+		expectedMax int32
+		expectedMin int32
+	}{
+		{
+			name:        "defaults",
+			url:         "postgres://app@localhost/app",
+			expectedMax: defaultMaxConns,
+			expectedMin: defaultMinConns,
+		},
+		{
+			name:        "sized by options",
+			url:         "postgres://app@localhost/app",
+			opts:        Options{MaxConns: 4, MinConns: 1},
+			expectedMax: 4,
+			expectedMin: 1,
+		},
+		{
+			name:        "minimum capped by a smaller maximum",
+			url:         "postgres://app@localhost/app",
+			opts:        Options{MaxConns: 1},
+			expectedMax: 1,
+			expectedMin: 1,
+		},
+		{
+			name:        "setting names in other values are not sizing",
+			url:         "host=localhost dbname=app user=app password=pool_max_conns application_name=pool_min_conns",
+			expectedMax: defaultMaxConns,
+			expectedMin: defaultMinConns,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := pgxpool.ParseConfig(tt.url)
+			require.NoError(t, err)
+
+			applyPoolSize(config, tt.opts)
+			assert.Equal(t, tt.expectedMax, config.MaxConns)
+			assert.Equal(t, tt.expectedMin, config.MinConns)
+		})
+	}
+}
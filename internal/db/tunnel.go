@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"pgcopy/internal/secret"
+)
+
+// defaultSSHPort is used when the tunnel configuration does not set a port
+const defaultSSHPort = 22
+
+// sshDialTimeout bounds the TCP connection and handshake with the bastion
+const sshDialTimeout = 30 * time.Second
+
+// TunnelConfig describes an SSH bastion that database connections are dialed through
+type TunnelConfig struct {
+	Host           string
+	Port           int
+	User           string
+	KeyFile        string
+	KeyPassphrase  string
+	KnownHostsFile string
+}
+
+// Tunnel is an established SSH client used to dial the database
+type Tunnel struct {
+	client *ssh.Client
+	addr   string
+}
+
+// OpenTunnel connects and authenticates to the SSH bastion. The server host key is
+// always verified against the known_hosts file (default ~/.ssh/known_hosts).
+func OpenTunnel(ctx context.Context, cfg TunnelConfig) (*Tunnel, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("ssh tunnel host is required")
+	}
+	if cfg.User == "" {
+		return nil, fmt.Errorf("ssh tunnel user is required")
+	}
+
+	signer, err := loadSigner(cfg.KeyFile, cfg.KeyPassphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	knownHostsFile := cfg.KnownHostsFile
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate known_hosts: %w", err)
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(secret.ExpandHome(knownHostsFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts file: %w", err)
+	}
+
+	port := cfg.Port
+	if port == 0 {
+		port = defaultSSHPort
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+
+	clientConfig := &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshDialTimeout,
+	}
+
+	dialer := net.Dialer{Timeout: sshDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ssh host %s: %w", addr, err)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssh handshake with %s failed: %w", addr, err)
+	}
+
+	return &Tunnel{
+		client: ssh.NewClient(sshConn, chans, reqs),
+		addr:   addr,
+	}, nil
+}
+
+// DialContext opens a connection to addr from the bastion host
+func (t *Tunnel) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := t.client.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s through ssh tunnel %s: %w", addr, t.addr, err)
+	}
+	return conn, nil
+}
+
+// Close closes the SSH connection and every connection dialed through it
+func (t *Tunnel) Close() error {
+	return t.client.Close()
+}
+
+// loadSigner reads a private key, decrypting it when a passphrase is given
+func loadSigner(keyFile, passphrase string) (ssh.Signer, error) {
+	if keyFile == "" {
+		return nil, fmt.Errorf("ssh tunnel key_file is required")
+	}
+
+	key, err := os.ReadFile(secret.ExpandHome(keyFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ssh key file: %w", err)
+	}
+
+	var signer ssh.Signer
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh key file: %w", err)
+	}
+
+	return signer, nil
+}
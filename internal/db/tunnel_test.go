@@ -0,0 +1,253 @@
+package db
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer is an in-process SSH server that supports direct-tcpip forwarding
+type testSSHServer struct {
+	listener  net.Listener
+	hostKey   ssh.Signer
+	clientKey ssh.PublicKey
+	forwarded chan string
+}
+
+// startTestSSHServer starts an SSH server accepting only the given client key
+func startTestSSHServer(t *testing.T, clientKey ssh.PublicKey) *testSSHServer {
+	t.Helper()
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostKey, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &testSSHServer{
+		listener:  listener,
+		hostKey:   hostKey,
+		clientKey: clientKey,
+		forwarded: make(chan string, 10),
+	}
+	go server.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return server
+}
+
+func (s *testSSHServer) serve() {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(s.clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+	config.AddHostKey(s.hostKey)
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn, config)
+	}
+}
+
+func (s *testSSHServer) handle(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "only direct-tcpip is supported")
+			continue
+		}
+
+		var payload struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+
+		addr := net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port)))
+		target, err := net.Dial("tcp", addr)
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		s.forwarded <- addr
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			defer channel.Close()
+			defer target.Close()
+			go io.Copy(target, channel)
+			io.Copy(channel, target)
+		}()
+	}
+}
+
+// writeClientKey generates a client key pair and writes the private key to dir
+func writeClientKey(t *testing.T, dir string) (string, ssh.PublicKey) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.NoError(t, err)
+
+	keyFile := filepath.Join(dir, "id_ed25519")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600))
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+
+	return keyFile, sshPub
+}
+
+// writeKnownHosts writes a known_hosts file trusting the server's host key
+func writeKnownHosts(t *testing.T, dir string, server *testSSHServer) string {
+	t.Helper()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(server.listener.Addr().String())}, server.hostKey.PublicKey())
+	knownHosts := filepath.Join(dir, "known_hosts")
+	require.NoError(t, os.WriteFile(knownHosts, []byte(line+"\n"), 0o600))
+	return knownHosts
+}
+
+// startEchoServer starts a TCP server that echoes everything it receives
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestOpenTunnel_DialsThroughBastion(t *testing.T) {
+	dir := t.TempDir()
+	keyFile, clientKey := writeClientKey(t, dir)
+	server := startTestSSHServer(t, clientKey)
+	knownHosts := writeKnownHosts(t, dir, server)
+	echoAddr := startEchoServer(t)
+
+	host, port, err := net.SplitHostPort(server.listener.Addr().String())
+	require.NoError(t, err)
+	sshPort, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	tunnel, err := OpenTunnel(ctx, TunnelConfig{
+		Host:           host,
+		Port:           sshPort,
+		User:           "pgcopy",
+		KeyFile:        keyFile,
+		KnownHostsFile: knownHosts,
+	})
+	require.NoError(t, err)
+	defer tunnel.Close()
+
+	conn, err := tunnel.DialContext(ctx, "tcp", echoAddr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	reply := make([]byte, 4)
+	_, err = io.ReadFull(conn, reply)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(reply))
+	assert.Equal(t, echoAddr, <-server.forwarded)
+}
+
+func TestOpenTunnel_RejectsUnknownHostKey(t *testing.T) {
+	dir := t.TempDir()
+	keyFile, clientKey := writeClientKey(t, dir)
+	server := startTestSSHServer(t, clientKey)
+
+	// Trust a different server's key
+	otherServer := startTestSSHServer(t, clientKey)
+	line := knownhosts.Line([]string{knownhosts.Normalize(server.listener.Addr().String())}, otherServer.hostKey.PublicKey())
+	knownHosts := filepath.Join(dir, "known_hosts")
+	require.NoError(t, os.WriteFile(knownHosts, []byte(line+"\n"), 0o600))
+
+	host, port, err := net.SplitHostPort(server.listener.Addr().String())
+	require.NoError(t, err)
+	sshPort, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	_, err = OpenTunnel(context.Background(), TunnelConfig{
+		Host:           host,
+		Port:           sshPort,
+		User:           "pgcopy",
+		KeyFile:        keyFile,
+		KnownHostsFile: knownHosts,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ssh handshake")
+}
+
+func TestOpenTunnel_InvalidConfig(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := OpenTunnel(ctx, TunnelConfig{User: "pgcopy", KeyFile: "id_ed25519"})
+	assert.ErrorContains(t, err, "host is required")
+
+	_, err = OpenTunnel(ctx, TunnelConfig{Host: "bastion", KeyFile: "id_ed25519"})
+	assert.ErrorContains(t, err, "user is required")
+
+	_, err = OpenTunnel(ctx, TunnelConfig{Host: "bastion", User: "pgcopy"})
+	assert.ErrorContains(t, err, "key_file is required")
+
+	_, err = OpenTunnel(ctx, TunnelConfig{Host: "bastion", User: "pgcopy", KeyFile: "/nonexistent/id_ed25519"})
+	assert.ErrorContains(t, err, "failed to read ssh key file")
+}
@@ -1,19 +1,128 @@
 package log
 
 import (
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+// Supported output formats
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+// Options controls how the global logger is configured
+type Options struct {
+	// Level is the minimum level to emit (trace, debug, info, warn, error)
+	Level string
+	// Format is either "console" or "json"
+	Format string
+	// File is an optional path to write logs to instead of stderr
+	File string
+}
+
+// logFile is the currently opened log file, if any
+var logFile *os.File
+
 // Setup configures the global logger
-func Setup() {
+func Setup(opts Options) error {
+	level := zerolog.InfoLevel
+	if opts.Level != "" {
+		parsed, err := zerolog.ParseLevel(strings.ToLower(opts.Level))
+		if err != nil {
+			return fmt.Errorf("invalid log level %q: %w", opts.Level, err)
+		}
+		level = parsed
+	}
+
+	var out io.Writer = os.Stderr
+	if opts.File != "" {
+		file, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		if err := Close(); err != nil {
+			file.Close()
+			return err
+		}
+		logFile = file
+		out = file
+	}
+
+	switch strings.ToLower(opts.Format) {
+	case "", FormatConsole:
+		out = zerolog.ConsoleWriter{Out: out, NoColor: opts.File != ""}
+	case FormatJSON:
+	default:
+		return fmt.Errorf("invalid log format %q: must be %q or %q", opts.Format, FormatConsole, FormatJSON)
+	}
+
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	zerolog.SetGlobalLevel(level)
+	log.Logger = zerolog.New(out).With().Timestamp().Logger()
+
+	return nil
+}
+
+// Close closes the log file opened by Setup, if any
+func Close() error {
+	if logFile == nil {
+		return nil
+	}
+	err := logFile.Close()
+	logFile = nil
+	return err
 }
 
 // GetLogger returns the global logger
 func GetLogger() zerolog.Logger {
 	return log.Logger
 }
+
+// Debug starts a new message with debug level
+func Debug() *zerolog.Event {
+	return log.Logger.Debug()
+}
+
+// Info starts a new message with info level
+func Info() *zerolog.Event {
+	return log.Logger.Info()
+}
+
+// Warn starts a new message with warn level
+func Warn() *zerolog.Event {
+	return log.Logger.Warn()
+}
+
+// Error starts a new message with error level
+func Error() *zerolog.Event {
+	return log.Logger.Error()
+}
+
+// passwordParam matches password=... in key/value connection strings
+var passwordParam = regexp.MustCompile(`(?i)(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// passwordQueryParam matches password=... in URL query strings
+var passwordQueryParam = regexp.MustCompile(`(?i)((?:^|&)password=)[^&]*`)
+
+// MaskConnectionString removes passwords from a connection string so it can be logged
+func MaskConnectionString(connStr string) string {
+	if strings.HasPrefix(connStr, "postgres://") || strings.HasPrefix(connStr, "postgresql://") {
+		parsed, err := url.Parse(connStr)
+		if err != nil {
+			return "***"
+		}
+		parsed.RawQuery = passwordQueryParam.ReplaceAllString(parsed.RawQuery, "${1}***")
+		// Redacted replaces the userinfo password with "xxxxx"
+		return strings.Replace(parsed.Redacted(), ":xxxxx@", ":***@", 1)
+	}
+
+	return passwordParam.ReplaceAllString(connStr, "${1}***")
+}
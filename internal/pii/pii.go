@@ -0,0 +1,198 @@
+// Package pii detects columns that probably hold personally identifiable information,
+// from their names and from sampled values.
+package pii
+
+import (
+	"math/big"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Category is a kind of personal data
+type Category string
+
+// Detected categories
+const (
+	Email      Category = "email"
+	Phone      Category = "phone"
+	CreditCard Category = "credit_card"
+	IBAN       Category = "iban"
+	IPAddress  Category = "ip_address"
+	PersonName Category = "person_name"
+	Address    Category = "address"
+	BirthDate  Category = "birth_date"
+	NationalID Category = "national_id"
+	Credential Category = "credential"
+)
+
+// namePatterns match normalized column names, checked in order
+var namePatterns = []struct {
+	category Category
+	pattern  *regexp.Regexp
+}{
+	{Credential, regexp.MustCompile(`(^|_)(password|passwd|pwd|secret|api_?key|access_?token|refresh_?token|auth_?token)(_|$)`)},
+	{Email, regexp.MustCompile(`(^|_)e_?mail(_?address)?(_|$)`)},
+	{Phone, regexp.MustCompile(`(^|_)(phone|telephone|tel|mobile|cell|fax|msisdn)(_?(number|no))?(_|$)`)},
+	{CreditCard, regexp.MustCompile(`(^|_)(credit_?card|card_?(number|no|num)|cc_?(number|no|num)|pan)(_|$)`)},
+	{IBAN, regexp.MustCompile(`(^|_)(iban|bank_?account|account_?(number|no))(_|$)`)},
+	{IPAddress, regexp.MustCompile(`(^|_)(ip|ip_?addr(ess)?|remote_?addr(ess)?|client_?ip)(_|$)`)},
+	{NationalID, regexp.MustCompile(`(^|_)(ssn|social_?security(_?number)?|national_?id|tax_?id|tin|passport(_?(number|no))?|driver_?licen[cs]e)(_|$)`)},
+	{BirthDate, regexp.MustCompile(`(^|_)(dob|birth_?date|date_?of_?birth|birthday)(_|$)`)},
+	{PersonName, regexp.MustCompile(`(^|_)(first_?name|last_?name|full_?name|middle_?name|given_?name|family_?name|surname|maiden_?name)(_|$)`)},
+	{Address, regexp.MustCompile(`(^|_)((street|home|billing|shipping|postal|mailing)_?address|address(_?line)?_?[12]?|street|zip(_?code)?|post_?code|postal_?code)(_|$)`)},
+}
+
+var (
+	emailPattern = regexp.MustCompile(`^[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}$`)
+	phonePattern = regexp.MustCompile(`^\+?\(?[0-9]{1,4}\)?([ .\-]?\(?[0-9]{1,5}\)?){2,6}$`)
+	cardPattern  = regexp.MustCompile(`^[0-9]{4}([ \-]?[0-9]{3,4}){2,4}$`)
+	ibanPattern  = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$`)
+	nonAlnum     = regexp.MustCompile(`[^a-z0-9]+`)
+	digitGroup   = regexp.MustCompile(`[0-9]+`)
+)
+
+// dateLayouts are the numeric date formats that phone number patterns would also match
+var dateLayouts = []string{
+	"2006-01-02", "2006-1-2", "2006/01/02", "2006/1/2", "2006.01.02", "2006.1.2",
+	"02.01.2006", "2.1.2006", "02-01-2006", "2-1-2006", "02/01/2006", "2/1/2006",
+	"01/02/2006", "1/2/2006", "01-02-2006", "1-2-2006",
+}
+
+// MatchName returns the category a column name suggests
+func MatchName(column string) (Category, bool) {
+	name := strings.Trim(nonAlnum.ReplaceAllString(strings.ToLower(column), "_"), "_")
+	for _, p := range namePatterns {
+		if p.pattern.MatchString(name) {
+			return p.category, true
+		}
+	}
+	return "", false
+}
+
+// MatchValue returns the category a value looks like. Only formats that can be
+// recognized reliably are checked: emails, phone numbers, credit card numbers (with
+// a valid Luhn checksum), IBANs (with a valid checksum) and IP addresses.
+func MatchValue(value string) (Category, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", false
+	}
+
+	switch {
+	case emailPattern.MatchString(value):
+		return Email, true
+	case isIPAddress(value):
+		return IPAddress, true
+	case cardPattern.MatchString(value) && luhnValid(digits(value)):
+		return CreditCard, true
+	case isIBAN(value):
+		return IBAN, true
+	case isPhone(value):
+		return Phone, true
+	}
+	return "", false
+}
+
+// Transform returns the transformation suggested for a category. Emails are hashed so
+// they stay unique and joinable, values without analytical use are removed.
+func Transform(category Category) string {
+	switch category {
+	case Email:
+		return "hash"
+	case Credential, BirthDate, IPAddress:
+		return "nullify"
+	default:
+		return "redact"
+	}
+}
+
+// isIPAddress reports whether a value is an IPv4 or IPv6 address or network
+func isIPAddress(value string) bool {
+	if _, err := netip.ParseAddr(value); err == nil {
+		return strings.Count(value, ".") == 3 || strings.Contains(value, ":")
+	}
+	_, err := netip.ParsePrefix(value)
+	return err == nil
+}
+
+// isPhone reports whether a value is formatted like a phone number. Plain digit strings,
+// dates and codes such as 123-4567 are too ambiguous, so an international prefix or at
+// least three digit groups are required.
+func isPhone(value string) bool {
+	if !phonePattern.MatchString(value) || isDate(value) {
+		return false
+	}
+	n := len(digits(value))
+	if n < 7 || n > 15 {
+		return false
+	}
+	return strings.HasPrefix(value, "+") || len(digitGroup.FindAllString(value, -1)) >= 3
+}
+
+// isDate reports whether a value is a numeric date
+func isDate(value string) bool {
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, value); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isIBAN reports whether a value is an IBAN with a valid mod-97 checksum
+func isIBAN(value string) bool {
+	compact := strings.ToUpper(strings.ReplaceAll(value, " ", ""))
+	if !ibanPattern.MatchString(compact) {
+		return false
+	}
+
+	// Move the country code and check digits to the end and convert letters to numbers
+	rearranged := compact[4:] + compact[:4]
+	var numeric strings.Builder
+	for _, r := range rearranged {
+		if r >= 'A' && r <= 'Z' {
+			numeric.WriteString(strconv.Itoa(int(r-'A') + 10))
+		} else {
+			numeric.WriteRune(r)
+		}
+	}
+
+	n, ok := new(big.Int).SetString(numeric.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// luhnValid reports whether a digit string has a valid Luhn checksum
+func luhnValid(number string) bool {
+	if len(number) < 13 || len(number) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// digits returns the digits of a value
+func digits(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package pii
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchName(t *testing.T) {
+	tests := []struct {
+		column   string
+		category Category
+		found    bool
+	}{
+		{column: "email", category: Email, found: true},
+		{column: "contact_e_mail", category: Email, found: true},
+		{column: "EmailAddress", category: Email, found: true},
+		{column: "mobile_number", category: Phone, found: true},
+		{column: "card_number", category: CreditCard, found: true},
+		{column: "iban", category: IBAN, found: true},
+		{column: "ip_address", category: IPAddress, found: true},
+		{column: "client_ip", category: IPAddress, found: true},
+		{column: "ssn", category: NationalID, found: true},
+		{column: "date_of_birth", category: BirthDate, found: true},
+		{column: "first_name", category: PersonName, found: true},
+		{column: "LastName", category: PersonName, found: true},
+		{column: "shipping_address", category: Address, found: true},
+		{column: "zip_code", category: Address, found: true},
+		{column: "password_hash", category: Credential, found: true},
+		{column: "name", found: false},
+		{column: "product_name", found: false},
+		{column: "hotel", found: false},
+		{column: "mailbox_size", found: false},
+		{column: "created_at", found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.column, func(t *testing.T) {
+			category, found := MatchName(tt.column)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.category, category)
+		})
+	}
+}
+
+func TestMatchValue(t *testing.T) {
+	tests := []struct {
+		value    string
+		category Category
+		found    bool
+	}{
+		{value: "john.doe+test@example.co.uk", category: Email, found: true},
+		{value: "+1 415 555 2671", category: Phone, found: true},
+		{value: "(020) 7946-0958", category: Phone, found: true},
+		{value: "415-555-2671", category: Phone, found: true},
+		{value: "+4930123456", category: Phone, found: true},
+		{value: "2024-01-15", found: false},
+		{value: "15.01.2024", found: false},
+		{value: "01/15/2024", found: false},
+		{value: "2024/1/5", found: false},
+		{value: "123-4567", found: false},
+		{value: "555 1234", found: false},
+		{value: "4111 1111 1111 1111", category: CreditCard, found: true},
+		{value: "4111-1111-1111-1112", found: false},
+		{value: "GB82 WEST 1234 5698 7654 32", category: IBAN, found: true},
+		{value: "DE89370400440532013000", category: IBAN, found: true},
+		{value: "DE89370400440532013001", found: false},
+		{value: "192.168.1.10", category: IPAddress, found: true},
+		{value: "10.0.0.0/8", category: IPAddress, found: true},
+		{value: "2001:db8::1", category: IPAddress, found: true},
+		{value: "20240101", found: false},
+		{value: "1.5", found: false},
+		{value: "ORD-001", found: false},
+		{value: "hello world", found: false},
+		{value: "", found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			category, found := MatchValue(tt.value)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.category, category)
+		})
+	}
+}
+
+func TestTransform(t *testing.T) {
+	assert.Equal(t, "hash", Transform(Email))
+	assert.Equal(t, "nullify", Transform(Credential))
+	assert.Equal(t, "redact", Transform(Phone))
+}
@@ -2,7 +2,11 @@ package schema
 
 import (
 	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -16,13 +20,62 @@ type DatabaseConfig struct {
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
 	SSLMode  string `yaml:"ssl_mode,omitempty"`
+	Service  string `yaml:"service,omitempty"`
+
+	// TLS settings
+	SSLRootCert string `yaml:"ssl_root_cert,omitempty"`
+	SSLCert     string `yaml:"ssl_cert,omitempty"`
+	SSLKey      string `yaml:"ssl_key,omitempty"`
+
+	// Session settings
+	ApplicationName  string `yaml:"application_name,omitempty"`
+	ConnectTimeout   int    `yaml:"connect_timeout,omitempty"`
+	StatementTimeout string `yaml:"statement_timeout,omitempty"`
+	LockTimeout      string `yaml:"lock_timeout,omitempty"`
+	SearchPath       string `yaml:"search_path,omitempty"`
+
+	// Options holds any additional connection parameters or server settings
+	Options map[string]string `yaml:"options,omitempty"`
+
+	// Pool sizing
+	MaxConns int `yaml:"max_conns,omitempty"`
+	MinConns int `yaml:"min_conns,omitempty"`
+
+	// SSHTunnel reaches the database through an SSH bastion host
+	SSHTunnel *SSHTunnelConfig `yaml:"ssh_tunnel,omitempty"`
+}
+
+// SSHTunnelConfig represents an SSH bastion used to reach a database
+type SSHTunnelConfig struct {
+	Host          string `yaml:"host"`
+	Port          int    `yaml:"port,omitempty"`
+	User          string `yaml:"user"`
+	KeyFile       string `yaml:"key_file"`
+	KeyPassphrase string `yaml:"key_passphrase,omitempty"`
+	KnownHosts    string `yaml:"known_hosts,omitempty"`
 }
 
 // Config represents the YAML configuration structure
 type Config struct {
-	Source  DatabaseConfig `yaml:"source,omitempty"`
-	Target  DatabaseConfig `yaml:"target,omitempty"`
-	Schemas []Schema       `yaml:"schemas"`
+	Source       DatabaseConfig `yaml:"source,omitempty"`
+	Target       DatabaseConfig `yaml:"target,omitempty"`
+	LoadSettings *LoadSettings  `yaml:"load_settings,omitempty"`
+	SchemaCheck  string         `yaml:"schema_check,omitempty"`
+	AutoCast     bool           `yaml:"auto_cast,omitempty"`
+	// Lookups are named dictionaries used by "lookup:<name>" transformations
+	Lookups map[string]Lookup `yaml:"lookups,omitempty"`
+	// Policy lists sensitive columns that must never be copied unmasked
+	Policy  *Policy  `yaml:"policy,omitempty"`
+	Schemas []Schema `yaml:"schemas"`
+}
+
+// LoadSettings tunes the target session and table for bulk loading
+type LoadSettings struct {
+	SynchronousCommit  string            `yaml:"synchronous_commit,omitempty" json:"synchronous_commit,omitempty"`
+	MaintenanceWorkMem string            `yaml:"maintenance_work_mem,omitempty" json:"maintenance_work_mem,omitempty"`
+	Settings           map[string]string `yaml:"settings,omitempty" json:"settings,omitempty"`
+	Unlogged           bool              `yaml:"unlogged,omitempty" json:"unlogged,omitempty"`
+	Analyze            *bool             `yaml:"analyze,omitempty" json:"analyze,omitempty"`
 }
 
 // Schema represents a database schema
@@ -33,11 +86,65 @@ type Schema struct {
 
 // Table represents a database table
 type Table struct {
-	Name      string            `yaml:"name"`
+	Name string `yaml:"name"`
+	// Query is a SELECT read instead of the source table, its result columns are
+	// copied into the target table's columns of the same name
+	Query     string            `yaml:"query,omitempty"`
 	Ignore    []string          `yaml:"ignore,omitempty"`
 	Transform map[string]string `yaml:"transform,omitempty"`
+	Cast      map[string]string `yaml:"cast,omitempty"`
 	Filter    string            `yaml:"filter,omitempty"`
 	Truncate  bool              `yaml:"truncate,omitempty"`
+	Sequences string            `yaml:"sequences,omitempty"`
+
+	// RebuildIndexes drops secondary indexes and FK/CHECK constraints before the copy and recreates them afterwards
+	RebuildIndexes      bool `yaml:"rebuild_indexes,omitempty"`
+	RebuildConcurrently bool `yaml:"rebuild_concurrently,omitempty"`
+	RebuildParallelism  int  `yaml:"rebuild_parallelism,omitempty"`
+
+	// DisableTriggers suppresses user triggers and FK enforcement on the target while loading
+	DisableTriggers bool `yaml:"disable_triggers,omitempty"`
+
+	// LoadSettings overrides the top-level load settings for this table
+	LoadSettings *LoadSettings `yaml:"load_settings,omitempty"`
+
+	// AutoCast overrides the top-level auto_cast setting for this table
+	AutoCast *bool `yaml:"auto_cast,omitempty"`
+}
+
+// Sequence synchronization modes for Table.Sequences
+const (
+	// SequencesMax sets owned sequences and identity columns to the column's maximum value (default)
+	SequencesMax = "max"
+	// SequencesSource mirrors the current value of the matching source sequence
+	SequencesSource = "source"
+	// SequencesSkip leaves target sequences untouched
+	SequencesSkip = "skip"
+)
+
+// Pre-flight schema check modes for Config.SchemaCheck
+const (
+	// SchemaCheckWarn aborts the copy only when it would certainly fail, type differences that
+	// may lose values are reported as warnings (default)
+	SchemaCheckWarn = "warn"
+	// SchemaCheckFail also aborts the copy when a target type may not hold every source value
+	SchemaCheckFail = "fail"
+	// SchemaCheckSkip leaves missing or incompatible columns out of the copy
+	SchemaCheckSkip = "skip"
+	// SchemaCheckAlter alters the target to add missing columns and change incompatible types
+	SchemaCheckAlter = "alter"
+	// SchemaCheckOff disables the pre-flight check
+	SchemaCheckOff = "off"
+)
+
+// ValidateSchemaCheck returns an error if mode is not a known schema check mode
+func ValidateSchemaCheck(mode string) error {
+	switch mode {
+	case "", SchemaCheckWarn, SchemaCheckFail, SchemaCheckSkip, SchemaCheckAlter, SchemaCheckOff:
+		return nil
+	}
+	return fmt.Errorf("invalid schema_check mode '%s' (expected %s, %s, %s, %s or %s)",
+		mode, SchemaCheckWarn, SchemaCheckFail, SchemaCheckSkip, SchemaCheckAlter, SchemaCheckOff)
 }
 
 // LoadConfig loads configuration from a YAML file
@@ -52,36 +159,24 @@ func LoadConfig(filename string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse YAML config: %w", err)
 	}
 
-	// Expand environment variables in passwords
-	expandEnvironmentVariables(&config)
-
-	if err := validateConfig(&config); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+	// Resolve secret references, services and environment variables
+	if err := resolveSecrets(&config); err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets: %w", err)
 	}
 
-	return &config, nil
-}
-
-// expandEnvironmentVariables expands environment variables in database passwords
-func expandEnvironmentVariables(config *Config) {
-	if config.Source.Password != "" {
-		config.Source.Password = expandEnvVar(config.Source.Password)
+	if err := loadPolicy(&config, filepath.Dir(filename)); err != nil {
+		return nil, fmt.Errorf("failed to load policy: %w", err)
 	}
-	if config.Target.Password != "" {
-		config.Target.Password = expandEnvVar(config.Target.Password)
+
+	if err := validateConfig(&config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
-	fmt.Println(config.Source.Password)
-	fmt.Println(config.Target.Password)
-}
 
-// expandEnvVar expands environment variables in a string
-func expandEnvVar(value string) string {
-	if !strings.Contains(value, "${") {
-		return value
+	if err := loadLookups(&config, filepath.Dir(filename)); err != nil {
+		return nil, fmt.Errorf("failed to load lookups: %w", err)
 	}
 
-	// Simple environment variable expansion for ${VAR_NAME} format
-	return os.ExpandEnv(value)
+	return &config, nil
 }
 
 // validateConfig validates the configuration
@@ -94,10 +189,22 @@ func validateConfig(config *Config) error {
 		return err
 	}
 
+	if err := validateLoadSettings(config.LoadSettings); err != nil {
+		return fmt.Errorf("load_settings: %w", err)
+	}
+
+	if err := ValidateSchemaCheck(config.SchemaCheck); err != nil {
+		return err
+	}
+
 	if len(config.Schemas) == 0 {
 		return fmt.Errorf("no schemas defined")
 	}
 
+	if err := validateLookups(config); err != nil {
+		return err
+	}
+
 	for i, schema := range config.Schemas {
 		if schema.Name == "" {
 			return fmt.Errorf("schema %d has no name", i)
@@ -112,16 +219,67 @@ func validateConfig(config *Config) error {
 				return fmt.Errorf("table %d in schema '%s' has no name", j, schema.Name)
 			}
 
-			// Validate that a column is not both ignored and transformed
+			switch table.Sequences {
+			case "", SequencesMax, SequencesSource, SequencesSkip:
+			default:
+				return fmt.Errorf("table '%s' in schema '%s': invalid sequences mode '%s' (expected %s, %s or %s)",
+					table.Name, schema.Name, table.Sequences, SequencesMax, SequencesSource, SequencesSkip)
+			}
+
+			if table.Query != "" && table.Sequences == SequencesSource {
+				return fmt.Errorf("table '%s' in schema '%s': sequences mode '%s' needs a source table and cannot be used with query",
+					table.Name, schema.Name, SequencesSource)
+			}
+
+			if table.RebuildParallelism < 0 {
+				return fmt.Errorf("table '%s' in schema '%s': rebuild_parallelism cannot be negative", table.Name, schema.Name)
+			}
+
+			if err := validateLoadSettings(table.LoadSettings); err != nil {
+				return fmt.Errorf("table '%s' in schema '%s': load_settings: %w", table.Name, schema.Name, err)
+			}
+
+			// Validate that a column is not both ignored and transformed or cast
 			for _, ignoredCol := range table.Ignore {
 				if _, exists := table.Transform[ignoredCol]; exists {
 					return fmt.Errorf("table '%s' in schema '%s': column '%s' cannot be both ignored and transformed",
 						table.Name, schema.Name, ignoredCol)
 				}
+				if _, exists := table.Cast[ignoredCol]; exists {
+					return fmt.Errorf("table '%s' in schema '%s': column '%s' cannot be both ignored and cast",
+						table.Name, schema.Name, ignoredCol)
+				}
+			}
+
+			for col, castType := range table.Cast {
+				if strings.TrimSpace(castType) == "" {
+					return fmt.Errorf("table '%s' in schema '%s': cast of column '%s' has no type", table.Name, schema.Name, col)
+				}
 			}
 		}
 	}
 
+	return validatePolicy(config)
+}
+
+// validateLoadSettings validates a load_settings block, which may be nil
+func validateLoadSettings(settings *LoadSettings) error {
+	if settings == nil {
+		return nil
+	}
+
+	switch settings.SynchronousCommit {
+	case "", "on", "off", "local", "remote_write", "remote_apply":
+	default:
+		return fmt.Errorf("invalid synchronous_commit '%s'", settings.SynchronousCommit)
+	}
+
+	for name := range settings.Settings {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("setting name cannot be empty")
+		}
+	}
+
 	return nil
 }
 
@@ -142,6 +300,31 @@ func validateDatabaseConfig(db *DatabaseConfig, name string) error {
 		return fmt.Errorf("%s database: username is required", name)
 	}
 
+	if (db.SSLCert == "") != (db.SSLKey == "") {
+		return fmt.Errorf("%s database: ssl_cert and ssl_key must be set together", name)
+	}
+	if db.ConnectTimeout < 0 {
+		return fmt.Errorf("%s database: connect_timeout cannot be negative", name)
+	}
+	if db.MaxConns < 0 || db.MinConns < 0 {
+		return fmt.Errorf("%s database: max_conns and min_conns cannot be negative", name)
+	}
+	if db.MaxConns > 0 && db.MinConns > db.MaxConns {
+		return fmt.Errorf("%s database: min_conns (%d) cannot exceed max_conns (%d)", name, db.MinConns, db.MaxConns)
+	}
+
+	if tunnel := db.SSHTunnel; tunnel != nil {
+		if tunnel.Host == "" {
+			return fmt.Errorf("%s database: ssh_tunnel host is required", name)
+		}
+		if tunnel.User == "" {
+			return fmt.Errorf("%s database: ssh_tunnel user is required", name)
+		}
+		if tunnel.KeyFile == "" {
+			return fmt.Errorf("%s database: ssh_tunnel key_file is required", name)
+		}
+	}
+
 	// Set default port if not specified
 	if db.Port == 0 {
 		db.Port = 5432
@@ -165,16 +348,61 @@ func (db *DatabaseConfig) BuildConnectionString() string {
 		db.Host, db.Port, db.Database, db.Username)
 
 	if db.Password != "" {
-		connStr += fmt.Sprintf(" password=%s", db.Password)
+		connStr += fmt.Sprintf(" password=%s", quoteConnValue(db.Password))
 	}
 
 	if db.SSLMode != "" {
 		connStr += fmt.Sprintf(" sslmode=%s", db.SSLMode)
 	}
 
+	connectTimeout := ""
+	if db.ConnectTimeout > 0 {
+		connectTimeout = strconv.Itoa(db.ConnectTimeout)
+	}
+
+	params := []struct {
+		key   string
+		value string
+	}{
+		{"sslrootcert", db.SSLRootCert},
+		{"sslcert", db.SSLCert},
+		{"sslkey", db.SSLKey},
+		{"application_name", db.ApplicationName},
+		{"connect_timeout", connectTimeout},
+		{"statement_timeout", db.StatementTimeout},
+		{"lock_timeout", db.LockTimeout},
+		{"search_path", db.SearchPath},
+	}
+	for _, param := range params {
+		if param.value != "" {
+			connStr += fmt.Sprintf(" %s=%s", param.key, quoteConnValue(param.value))
+		}
+	}
+
+	// Additional options in a stable order
+	keys := make([]string, 0, len(db.Options))
+	for key := range db.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		connStr += fmt.Sprintf(" %s=%s", key, quoteConnValue(db.Options[key]))
+	}
+
 	return connStr
 }
 
+// quoteConnValue quotes a key/value connection string value when needed
+func quoteConnValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n'\\") {
+		return value
+	}
+
+	escaped := strings.ReplaceAll(value, `\`, `\\`)
+	escaped = strings.ReplaceAll(escaped, `'`, `\'`)
+	return "'" + escaped + "'"
+}
+
 // GetAllTables returns all tables from all schemas
 func (c *Config) GetAllTables() []TableInfo {
 	var tables []TableInfo
@@ -183,22 +411,137 @@ func (c *Config) GetAllTables() []TableInfo {
 			tables = append(tables, TableInfo{
 				Schema:    schema.Name,
 				Table:     table.Name,
+				Query:     strings.TrimRight(strings.TrimSpace(table.Query), "; \n\t"),
 				Ignore:    table.Ignore,
 				Transform: table.Transform,
+				Cast:      table.Cast,
 				Filter:    table.Filter,
 				Truncate:  table.Truncate,
+				Sequences: table.Sequences,
+
+				RebuildIndexes:      table.RebuildIndexes,
+				RebuildConcurrently: table.RebuildConcurrently,
+				RebuildParallelism:  table.RebuildParallelism,
+
+				DisableTriggers: table.DisableTriggers,
+				LoadSettings:    c.LoadSettings.Merge(table.LoadSettings),
+				SchemaCheck:     c.SchemaCheck,
+				AutoCast:        c.autoCast(table),
+				Lookups:         usedLookups(c.Lookups, table.Transform),
+				Policy:          c.Policy,
 			})
 		}
 	}
 	return tables
 }
 
+// FindTable returns a configured table by its schema-qualified name
+func (c *Config) FindTable(name string) (TableInfo, error) {
+	schemaName, tableName, err := ParseTableName(name)
+	if err != nil {
+		return TableInfo{}, err
+	}
+	for _, table := range c.GetAllTables() {
+		if table.Schema == schemaName && table.Table == tableName {
+			return table, nil
+		}
+	}
+	return TableInfo{}, fmt.Errorf("table %s is not in the configuration", name)
+}
+
+// ParseTableName splits a schema-qualified table name
+func ParseTableName(name string) (string, string, error) {
+	schemaName, tableName, ok := strings.Cut(name, ".")
+	if !ok || schemaName == "" || tableName == "" || strings.Contains(tableName, ".") {
+		return "", "", fmt.Errorf("invalid table name '%s' (expected schema.table)", name)
+	}
+	return schemaName, tableName, nil
+}
+
 // TableInfo represents table information for copying
 type TableInfo struct {
 	Schema    string
 	Table     string
+	Query     string
 	Ignore    []string
 	Transform map[string]string
+	Cast      map[string]string
 	Filter    string
 	Truncate  bool
+	Sequences string
+
+	RebuildIndexes      bool
+	RebuildConcurrently bool
+	RebuildParallelism  int
+
+	DisableTriggers bool
+	LoadSettings    LoadSettings
+	SchemaCheck     string
+	AutoCast        bool
+	// Lookups are the lookups used by the table's transformations
+	Lookups map[string]Lookup
+	Policy  *Policy
+}
+
+// autoCast returns whether mismatched column types of a table are cast automatically
+func (c *Config) autoCast(table Table) bool {
+	if table.AutoCast != nil {
+		return *table.AutoCast
+	}
+	return c.AutoCast
+}
+
+// Merge returns the settings with every field set in override taking precedence.
+// Either side may be nil.
+func (s *LoadSettings) Merge(override *LoadSettings) LoadSettings {
+	var merged LoadSettings
+	if s != nil {
+		merged = *s
+		merged.Settings = maps.Clone(s.Settings)
+	}
+	if override == nil {
+		return merged
+	}
+
+	if override.SynchronousCommit != "" {
+		merged.SynchronousCommit = override.SynchronousCommit
+	}
+	if override.MaintenanceWorkMem != "" {
+		merged.MaintenanceWorkMem = override.MaintenanceWorkMem
+	}
+	for name, value := range override.Settings {
+		if merged.Settings == nil {
+			merged.Settings = make(map[string]string)
+		}
+		merged.Settings[name] = value
+	}
+	if override.Unlogged {
+		merged.Unlogged = true
+	}
+	if override.Analyze != nil {
+		merged.Analyze = override.Analyze
+	}
+
+	return merged
+}
+
+// AnalyzeEnabled reports whether tables are analyzed after loading (default true)
+func (s LoadSettings) AnalyzeEnabled() bool {
+	return s.Analyze == nil || *s.Analyze
+}
+
+// SessionSettings returns the server settings applied to the target session, including
+// synchronous_commit and maintenance_work_mem
+func (s LoadSettings) SessionSettings() map[string]string {
+	settings := maps.Clone(s.Settings)
+	if settings == nil {
+		settings = make(map[string]string)
+	}
+	if s.SynchronousCommit != "" {
+		settings["synchronous_commit"] = s.SynchronousCommit
+	}
+	if s.MaintenanceWorkMem != "" {
+		settings["maintenance_work_mem"] = s.MaintenanceWorkMem
+	}
+	return settings
 }
@@ -2,6 +2,7 @@ package schema
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -67,6 +68,65 @@ schemas:
 schemas:
   - name: public
     tables: []
+`,
+			expectError: true,
+		},
+		{
+			name: "invalid sequences mode",
+			yamlContent: `
+schemas:
+  - name: public
+    tables:
+      - name: users
+        sequences: restart
+`,
+			expectError: true,
+		},
+		{
+			name: "invalid synchronous_commit",
+			yamlContent: `
+load_settings:
+  synchronous_commit: sometimes
+schemas:
+  - name: public
+    tables:
+      - name: users
+`,
+			expectError: true,
+		},
+		{
+			name: "invalid schema_check mode",
+			yamlContent: `
+schema_check: ignore
+schemas:
+  - name: public
+    tables:
+      - name: users
+`,
+			expectError: true,
+		},
+		{
+			name: "ignored column is cast",
+			yamlContent: `
+schemas:
+  - name: public
+    tables:
+      - name: users
+        ignore: [id]
+        cast:
+          id: bigint
+`,
+			expectError: true,
+		},
+		{
+			name: "cast without type",
+			yamlContent: `
+schemas:
+  - name: public
+    tables:
+      - name: users
+        cast:
+          id: ""
 `,
 			expectError: true,
 		},
@@ -407,6 +467,46 @@ func TestDatabaseConfig_BuildConnectionString(t *testing.T) {
 			},
 			expected: "host=localhost port=5432 dbname=testdb user=testuser password=testpass",
 		},
+		{
+			name: "config with tls and session settings",
+			config: DatabaseConfig{
+				Host:             "localhost",
+				Port:             5432,
+				Database:         "testdb",
+				Username:         "testuser",
+				SSLMode:          "verify-full",
+				SSLRootCert:      "/etc/ssl/internal-ca.pem",
+				SSLCert:          "/etc/ssl/client.crt",
+				SSLKey:           "/etc/ssl/client.key",
+				ApplicationName:  "pgcopy",
+				ConnectTimeout:   10,
+				StatementTimeout: "5min",
+				LockTimeout:      "10s",
+				SearchPath:       "public, analytics",
+			},
+			expected: "host=localhost port=5432 dbname=testdb user=testuser sslmode=verify-full " +
+				"sslrootcert=/etc/ssl/internal-ca.pem sslcert=/etc/ssl/client.crt sslkey=/etc/ssl/client.key " +
+				"application_name=pgcopy connect_timeout=10 statement_timeout=5min lock_timeout=10s " +
+				"search_path='public, analytics'",
+		},
+		{
+			name: "config with options and pool sizing",
+			config: DatabaseConfig{
+				Host:     "localhost",
+				Port:     5432,
+				Database: "testdb",
+				Username: "testuser",
+				Password: "it's secret",
+				Options: map[string]string{
+					"work_mem":             "64MB",
+					"target_session_attrs": "read-write",
+				},
+				MaxConns: 4,
+				MinConns: 1,
+			},
+			expected: `host=localhost port=5432 dbname=testdb user=testuser password='it\'s secret' ` +
+				"target_session_attrs=read-write work_mem=64MB",
+		},
 		{
 			name:     "empty config",
 			config:   DatabaseConfig{},
@@ -466,6 +566,57 @@ func TestValidateDatabaseConfig(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "client certificate without key",
+			config: DatabaseConfig{
+				Host:     "localhost",
+				Database: "testdb",
+				Username: "testuser",
+				SSLCert:  "/etc/ssl/client.crt",
+			},
+			expectError: true,
+		},
+		{
+			name: "min conns above max conns",
+			config: DatabaseConfig{
+				Host:     "localhost",
+				Database: "testdb",
+				Username: "testuser",
+				MaxConns: 2,
+				MinConns: 5,
+			},
+			expectError: true,
+		},
+		{
+			name: "ssh tunnel without key file",
+			config: DatabaseConfig{
+				Host:      "localhost",
+				Database:  "testdb",
+				Username:  "testuser",
+				SSHTunnel: &SSHTunnelConfig{Host: "bastion", User: "jump"},
+			},
+			expectError: true,
+		},
+		{
+			name: "valid ssh tunnel",
+			config: DatabaseConfig{
+				Host:      "localhost",
+				Database:  "testdb",
+				Username:  "testuser",
+				SSHTunnel: &SSHTunnelConfig{Host: "bastion", User: "jump", KeyFile: "id_ed25519"},
+			},
+			expectError: false,
+		},
+		{
+			name: "negative connect timeout",
+			config: DatabaseConfig{
+				Host:           "localhost",
+				Database:       "testdb",
+				Username:       "testuser",
+				ConnectTimeout: -1,
+			},
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -479,3 +630,340 @@ func TestValidateDatabaseConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadConfigWithConnectionTuning(t *testing.T) {
+	yamlContent := `
+source:
+  host: "source-db.example.com"
+  database: "source_db"
+  username: "source_user"
+  ssl_mode: "verify-full"
+  ssl_root_cert: "/etc/ssl/internal-ca.pem"
+  ssl_cert: "/etc/ssl/client.crt"
+  ssl_key: "/etc/ssl/client.key"
+  application_name: "pgcopy"
+  connect_timeout: 15
+  statement_timeout: "30min"
+  lock_timeout: "5s"
+  search_path: "public"
+  options:
+    work_mem: "256MB"
+  max_conns: 8
+  min_conns: 2
+  ssh_tunnel:
+    host: "bastion.example.com"
+    port: 2222
+    user: "jump"
+    key_file: "~/.ssh/id_ed25519"
+    known_hosts: "~/.ssh/known_hosts"
+
+schemas:
+  - name: public
+    tables:
+      - name: users
+`
+
+	// Create temporary file
+	tmpFile, err := os.CreateTemp("", "config-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	// Write YAML content
+	_, err = tmpFile.WriteString(yamlContent)
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	// Load config
+	config, err := LoadConfig(tmpFile.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, "/etc/ssl/internal-ca.pem", config.Source.SSLRootCert)
+	assert.Equal(t, "/etc/ssl/client.crt", config.Source.SSLCert)
+	assert.Equal(t, "/etc/ssl/client.key", config.Source.SSLKey)
+	assert.Equal(t, "pgcopy", config.Source.ApplicationName)
+	assert.Equal(t, 15, config.Source.ConnectTimeout)
+	assert.Equal(t, "30min", config.Source.StatementTimeout)
+	assert.Equal(t, "5s", config.Source.LockTimeout)
+	assert.Equal(t, "public", config.Source.SearchPath)
+	assert.Equal(t, map[string]string{"work_mem": "256MB"}, config.Source.Options)
+	assert.Equal(t, 8, config.Source.MaxConns)
+	assert.Equal(t, 2, config.Source.MinConns)
+	assert.Equal(t, &SSHTunnelConfig{
+		Host:       "bastion.example.com",
+		Port:       2222,
+		User:       "jump",
+		KeyFile:    "~/.ssh/id_ed25519",
+		KnownHosts: "~/.ssh/known_hosts",
+	}, config.Source.SSHTunnel)
+}
+
+func TestLoadConfigWithLoadSettings(t *testing.T) {
+	yamlContent := `
+load_settings:
+  synchronous_commit: "off"
+  maintenance_work_mem: "1GB"
+  settings:
+    work_mem: "64MB"
+
+schemas:
+  - name: public
+    tables:
+      - name: users
+      - name: events
+        load_settings:
+          maintenance_work_mem: "2GB"
+          unlogged: true
+          analyze: false
+`
+
+	tmpFile, err := os.CreateTemp("", "config-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(yamlContent)
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	config, err := LoadConfig(tmpFile.Name())
+	require.NoError(t, err)
+
+	tables := config.GetAllTables()
+	require.Len(t, tables, 2)
+
+	users := tables[0].LoadSettings
+	assert.Equal(t, map[string]string{
+		"synchronous_commit":   "off",
+		"maintenance_work_mem": "1GB",
+		"work_mem":             "64MB",
+	}, users.SessionSettings())
+	assert.False(t, users.Unlogged)
+	assert.True(t, users.AnalyzeEnabled())
+
+	events := tables[1].LoadSettings
+	assert.Equal(t, map[string]string{
+		"synchronous_commit":   "off",
+		"maintenance_work_mem": "2GB",
+		"work_mem":             "64MB",
+	}, events.SessionSettings())
+	assert.True(t, events.Unlogged)
+	assert.False(t, events.AnalyzeEnabled())
+
+	// The table override must not leak into the top-level settings
+	assert.Equal(t, "1GB", config.LoadSettings.MaintenanceWorkMem)
+}
+
+func TestLoadSettings_Merge(t *testing.T) {
+	var none *LoadSettings
+	merged := none.Merge(nil)
+	assert.Empty(t, merged.SessionSettings())
+	assert.True(t, merged.AnalyzeEnabled())
+
+	base := &LoadSettings{Settings: map[string]string{"work_mem": "64MB"}}
+	merged = base.Merge(&LoadSettings{Settings: map[string]string{"work_mem": "128MB"}})
+	assert.Equal(t, "128MB", merged.Settings["work_mem"])
+	assert.Equal(t, "64MB", base.Settings["work_mem"])
+}
+
+func TestConfig_GetAllTablesAutoCast(t *testing.T) {
+	disabled := false
+	config := &Config{
+		AutoCast: true,
+		Schemas: []Schema{
+			{
+				Name: "public",
+				Tables: []Table{
+					{Name: "users"},
+					{Name: "events", AutoCast: &disabled},
+				},
+			},
+		},
+	}
+
+	tables := config.GetAllTables()
+	require.Len(t, tables, 2)
+	assert.True(t, tables[0].AutoCast)
+	assert.False(t, tables[1].AutoCast)
+}
+
+func TestParseTableName(t *testing.T) {
+	schemaName, tableName, err := ParseTableName("analytics.page_views")
+	require.NoError(t, err)
+	assert.Equal(t, "analytics", schemaName)
+	assert.Equal(t, "page_views", tableName)
+
+	for _, name := range []string{"users", ".users", "public.", "a.b.c"} {
+		_, _, err := ParseTableName(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestConfig_FindTable(t *testing.T) {
+	config := &Config{
+		Schemas: []Schema{
+			{
+				Name: "public",
+				Tables: []Table{
+					{Name: "users", Ignore: []string{"password_hash"}, Transform: map[string]string{"email": "hash"}},
+				},
+			},
+		},
+	}
+
+	table, err := config.FindTable("public.users")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"password_hash"}, table.Ignore)
+	assert.Equal(t, "hash", table.Transform["email"])
+
+	_, err = config.FindTable("public.orders")
+	assert.ErrorContains(t, err, "not in the configuration")
+
+	_, err = config.FindTable("users")
+	assert.Error(t, err)
+}
+
+func TestLoadConfigWithQuery(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "test-config-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(`
+schemas:
+  - name: staging
+    tables:
+      - name: order_summaries
+        query: |
+          SELECT o.id, u.email FROM public.orders o JOIN public.users u ON u.id = o.user_id;
+`)
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	config, err := LoadConfig(tmpFile.Name())
+	require.NoError(t, err)
+
+	tables := config.GetAllTables()
+	require.Len(t, tables, 1)
+	assert.Equal(t, "SELECT o.id, u.email FROM public.orders o JOIN public.users u ON u.id = o.user_id", tables[0].Query)
+}
+
+func TestValidateConfigQueryWithSourceSequences(t *testing.T) {
+	config := &Config{
+		Schemas: []Schema{
+			{
+				Name: "staging",
+				Tables: []Table{
+					{Name: "order_summaries", Query: "SELECT id FROM public.orders", Sequences: SequencesSource},
+				},
+			},
+		},
+	}
+
+	err := validateConfig(config)
+	assert.ErrorContains(t, err, "cannot be used with query")
+}
+
+func TestLoadConfigWithLookups(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "codes.csv"), []byte("code,name\nC-1,Acme\nC-2,\"Globex, Inc\"\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "regions.yaml"), []byte("1: north\n2: south\n"), 0o600))
+
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+lookups:
+  codes:
+    file: codes.csv
+    header: true
+    default: UNKNOWN
+  regions:
+    file: regions.yaml
+  unused:
+    file: regions.yaml
+schemas:
+  - name: public
+    tables:
+      - name: customers
+        transform:
+          code: "lookup:codes"
+          region: "lookup:regions"
+`), 0o600))
+
+	config, err := LoadConfig(configFile)
+	require.NoError(t, err)
+
+	tables := config.GetAllTables()
+	require.Len(t, tables, 1)
+
+	codes := tables[0].Lookups["codes"]
+	assert.Equal(t, map[string]string{"C-1": "Acme", "C-2": "Globex, Inc"}, codes.Values)
+	require.NotNil(t, codes.Default)
+	assert.Equal(t, "UNKNOWN", *codes.Default)
+
+	regions := tables[0].Lookups["regions"]
+	assert.Equal(t, map[string]string{"1": "north", "2": "south"}, regions.Values)
+	assert.Nil(t, regions.Default)
+
+	// Tables only carry the lookups their transformations use
+	assert.NotContains(t, tables[0].Lookups, "unused")
+}
+
+func TestLoadConfigWithInvalidLookups(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		lookups string
+		wantErr string
+	}{
+		{
+			name:    "undefined lookup",
+			lookups: "{}",
+			wantErr: "undefined lookup 'codes'",
+		},
+		{
+			name:    "missing file setting",
+			lookups: "{codes: {default: x}}",
+			wantErr: "file is required",
+		},
+		{
+			name:    "missing file",
+			lookups: "{codes: {file: missing.csv}}",
+			wantErr: "failed to read lookup file",
+		},
+		{
+			name:    "duplicate key",
+			file:    "codes.csv",
+			content: "C-1,Acme\nC-1,Globex\n",
+			lookups: "{codes: {file: codes.csv}}",
+			wantErr: "line 2: duplicate key 'C-1'",
+		},
+		{
+			name:    "extra column",
+			file:    "codes.csv",
+			content: "C-1,Acme,extra\n",
+			lookups: "{codes: {file: codes.csv}}",
+			wantErr: "wrong number of fields",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.file != "" {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, tt.file), []byte(tt.content), 0o600))
+			}
+
+			configFile := filepath.Join(dir, "config.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(`
+lookups: `+tt.lookups+`
+schemas:
+  - name: public
+    tables:
+      - name: customers
+        transform:
+          code: "lookup:codes"
+`), 0o600))
+
+			_, err := LoadConfig(configFile)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
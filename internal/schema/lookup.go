@@ -0,0 +1,149 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LookupPrefix marks a transformation that replaces values from a named lookup,
+// e.g. "lookup:customer_codes"
+const LookupPrefix = "lookup:"
+
+// Lookup is a dictionary replacing column values, loaded from a CSV or YAML file
+type Lookup struct {
+	// File is a CSV file of key,value rows or a YAML mapping of keys to values.
+	// Relative paths are resolved from the configuration file's directory.
+	File string `yaml:"file"`
+	// Header skips the first row of a CSV file
+	Header bool `yaml:"header,omitempty"`
+	// Default replaces values missing from the dictionary, which become NULL if unset
+	Default *string `yaml:"default,omitempty"`
+
+	// Values maps keys to their replacement, loaded from File
+	Values map[string]string `yaml:"-"`
+}
+
+// LookupName returns the lookup a transformation refers to
+func LookupName(transformation string) (string, bool) {
+	return strings.CutPrefix(transformation, LookupPrefix)
+}
+
+// usedLookups returns the lookups referred to by a table's transformations
+func usedLookups(lookups map[string]Lookup, transform map[string]string) map[string]Lookup {
+	var used map[string]Lookup
+	for _, transformation := range transform {
+		name, ok := LookupName(transformation)
+		if !ok {
+			continue
+		}
+		if lookup, exists := lookups[name]; exists {
+			if used == nil {
+				used = make(map[string]Lookup)
+			}
+			used[name] = lookup
+		}
+	}
+	return used
+}
+
+// validateLookups validates the lookup definitions and the transformations referring to them
+func validateLookups(config *Config) error {
+	for name, lookup := range config.Lookups {
+		if strings.TrimSpace(lookup.File) == "" {
+			return fmt.Errorf("lookup '%s': file is required", name)
+		}
+	}
+
+	for _, schema := range config.Schemas {
+		for _, table := range schema.Tables {
+			for col, transformation := range table.Transform {
+				name, ok := LookupName(transformation)
+				if !ok {
+					continue
+				}
+				if _, exists := config.Lookups[name]; !exists {
+					return fmt.Errorf("table '%s' in schema '%s': column '%s' uses undefined lookup '%s'",
+						table.Name, schema.Name, col, name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadLookups reads the dictionary of every lookup, resolving relative files from dir
+func loadLookups(config *Config, dir string) error {
+	for name, lookup := range config.Lookups {
+		file := lookup.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+
+		values, err := readLookupFile(file, lookup.Header)
+		if err != nil {
+			return fmt.Errorf("lookup '%s': %w", name, err)
+		}
+		lookup.Values = values
+		config.Lookups[name] = lookup
+	}
+	return nil
+}
+
+// readLookupFile reads a dictionary from a YAML file (.yaml or .yml) or a CSV file
+func readLookupFile(file string, header bool) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lookup file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		values := make(map[string]string)
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("failed to parse lookup file %s: %w", file, err)
+		}
+		return values, nil
+	default:
+		values, err := parseLookupCSV(bytes.NewReader(data), header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse lookup file %s: %w", file, err)
+		}
+		return values, nil
+	}
+}
+
+// parseLookupCSV reads key,value rows. Duplicate keys are rejected since the
+// replacement would be ambiguous.
+func parseLookupCSV(r io.Reader, header bool) (map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+
+	values := make(map[string]string)
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header && first {
+			continue
+		}
+
+		if _, exists := values[record[0]]; exists {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("line %d: duplicate key '%s'", line, record[0])
+		}
+		values[record[0]] = record[1]
+	}
+}
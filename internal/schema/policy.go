@@ -0,0 +1,175 @@
+package schema
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy lists sensitive columns that must be ignored or transformed whenever they are
+// copied, exported or dumped
+type Policy struct {
+	// File is a YAML file with a columns list, merged with Columns. Relative paths are
+	// resolved from the configuration file's directory.
+	File string `yaml:"file,omitempty"`
+	// Columns are patterns of sensitive columns: column, table.column or
+	// schema.table.column, where each part may use *, ? and [...] wildcards
+	Columns []string `yaml:"columns,omitempty"`
+	// Allow are patterns, in the same form, of columns computed by source queries that
+	// are known to hold no sensitive data and may be copied without a transformation
+	Allow []string `yaml:"allow,omitempty"`
+}
+
+// policyFile is the format of a policy file
+type policyFile struct {
+	Columns []string `yaml:"columns"`
+	Allow   []string `yaml:"allow"`
+}
+
+// Sensitive returns the first pattern matching a column
+func (p *Policy) Sensitive(schemaName, tableName, column string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	return matchPattern(p.Columns, schemaName, tableName, column)
+}
+
+// Allowed reports whether a computed column is declared free of sensitive data
+func (p *Policy) Allowed(schemaName, tableName, column string) bool {
+	if p == nil {
+		return false
+	}
+	_, ok := matchPattern(p.Allow, schemaName, tableName, column)
+	return ok
+}
+
+// matchPattern returns the first pattern matching a column
+func matchPattern(patterns []string, schemaName, tableName, column string) (string, bool) {
+	name := []string{schemaName, tableName, column}
+	for _, pattern := range patterns {
+		parts := strings.Split(pattern, ".")
+		if len(parts) > len(name) {
+			continue
+		}
+		// Shorter patterns match the trailing parts of the name
+		target := name[len(name)-len(parts):]
+		if matchParts(parts, target) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// Masks reports whether a table's rules keep a column's values from being copied as is.
+// The default transformation and expressions that only name the column keep the value,
+// so they do not mask.
+func Masks(table TableInfo, column string) bool {
+	transformation, ok := table.Transform[column]
+	return ok && transformation != "default" && !identityTransformation(transformation, column)
+}
+
+// identityTransformation reports whether a transformation is just the column itself, e.g.
+// "email", "\"email\"", "$1" or "(email)"
+func identityTransformation(transformation, column string) bool {
+	expr := strings.TrimSpace(transformation)
+	for strings.HasPrefix(expr, "(") && strings.HasSuffix(expr, ")") {
+		expr = strings.TrimSpace(expr[1 : len(expr)-1])
+	}
+	if expr == "$1" || expr == `"`+strings.ReplaceAll(column, `"`, `""`)+`"` {
+		return true
+	}
+	// Unquoted identifiers are case-insensitive
+	return strings.EqualFold(expr, column)
+}
+
+// matchParts matches each part of a name against its pattern
+func matchParts(patterns, names []string) bool {
+	for i, pattern := range patterns {
+		if ok, _ := path.Match(pattern, names[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// validatePolicy checks the column patterns and that every column the policy names
+// exactly is ignored or masked by the tables it belongs to
+func validatePolicy(config *Config) error {
+	policy := config.Policy
+	if policy == nil {
+		return nil
+	}
+
+	for _, pattern := range slices.Concat(policy.Columns, policy.Allow) {
+		if err := validatePolicyPattern(pattern); err != nil {
+			return fmt.Errorf("policy: %w", err)
+		}
+	}
+
+	// Wildcard patterns can only be checked against the source columns when copying
+	for _, table := range config.GetAllTables() {
+		for _, pattern := range policy.Columns {
+			parts := strings.Split(pattern, ".")
+			if len(parts) != 3 || strings.ContainsAny(pattern, "*?[\\") {
+				continue
+			}
+			if parts[0] != table.Schema || parts[1] != table.Table {
+				continue
+			}
+			if !slices.Contains(table.Ignore, parts[2]) && !Masks(table, parts[2]) {
+				return fmt.Errorf("table '%s' in schema '%s': column '%s' is sensitive by policy and must be ignored or transformed",
+					table.Table, table.Schema, parts[2])
+			}
+		}
+	}
+
+	return nil
+}
+
+// validatePolicyPattern checks that a pattern has one to three valid parts
+func validatePolicyPattern(pattern string) error {
+	parts := strings.Split(pattern, ".")
+	if len(parts) > 3 {
+		return fmt.Errorf("invalid column pattern '%s' (expected column, table.column or schema.table.column)", pattern)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return fmt.Errorf("invalid column pattern '%s': empty name", pattern)
+		}
+		if _, err := path.Match(part, ""); err != nil {
+			return fmt.Errorf("invalid column pattern '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// loadPolicy merges the columns and allowed columns of the policy file, resolving it from dir
+func loadPolicy(config *Config, dir string) error {
+	policy := config.Policy
+	if policy == nil || policy.File == "" {
+		return nil
+	}
+
+	file := policy.File
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read policy file: %w", err)
+	}
+	var parsed policyFile
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return fmt.Errorf("failed to parse policy file %s: %w", file, err)
+	}
+
+	policy.Columns = append(policy.Columns, parsed.Columns...)
+	policy.Allow = append(policy.Allow, parsed.Allow...)
+	return nil
+}
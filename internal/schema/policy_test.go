@@ -0,0 +1,176 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Sensitive(t *testing.T) {
+	policy := &Policy{Columns: []string{"email", "users.phone_*", "billing.*.card_number", "public.users.notes"}}
+
+	tests := []struct {
+		schema  string
+		table   string
+		column  string
+		pattern string
+	}{
+		{schema: "public", table: "users", column: "email", pattern: "email"},
+		{schema: "crm", table: "contacts", column: "email", pattern: "email"},
+		{schema: "public", table: "users", column: "phone_mobile", pattern: "users.phone_*"},
+		{schema: "public", table: "accounts", column: "phone_mobile"},
+		{schema: "billing", table: "payments", column: "card_number", pattern: "billing.*.card_number"},
+		{schema: "public", table: "payments", column: "card_number"},
+		{schema: "public", table: "users", column: "notes", pattern: "public.users.notes"},
+		{schema: "public", table: "orders", column: "notes"},
+		{schema: "public", table: "users", column: "Email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schema+"."+tt.table+"."+tt.column, func(t *testing.T) {
+			pattern, sensitive := policy.Sensitive(tt.schema, tt.table, tt.column)
+			assert.Equal(t, tt.pattern != "", sensitive)
+			assert.Equal(t, tt.pattern, pattern)
+		})
+	}
+
+	var none *Policy
+	_, sensitive := none.Sensitive("public", "users", "email")
+	assert.False(t, sensitive)
+}
+
+func TestPolicy_Allowed(t *testing.T) {
+	policy := &Policy{Columns: []string{"email"}, Allow: []string{"order_stats.*", "public.users.order_count"}}
+	assert.True(t, policy.Allowed("public", "order_stats", "total"))
+	assert.True(t, policy.Allowed("public", "users", "order_count"))
+	assert.False(t, policy.Allowed("crm", "users", "order_count"))
+	assert.False(t, policy.Allowed("public", "users", "email"))
+
+	var none *Policy
+	assert.False(t, none.Allowed("public", "order_stats", "total"))
+}
+
+func TestMasks(t *testing.T) {
+	table := TableInfo{Transform: map[string]string{
+		"email":   "hash",
+		"name":    "default",
+		"phone":   "phone",
+		"notes":   " ( Notes ) ",
+		"ssn":     `"ssn"`,
+		"token":   "$1",
+		"address": "left($1, 3)",
+	}}
+	assert.True(t, Masks(table, "email"))
+	assert.False(t, Masks(table, "name"))
+	assert.False(t, Masks(table, "phone"))
+	assert.False(t, Masks(table, "notes"))
+	assert.False(t, Masks(table, "ssn"))
+	assert.False(t, Masks(table, "token"))
+	assert.True(t, Masks(table, "address"))
+	assert.False(t, Masks(table, "city"))
+}
+
+func TestValidateConfigPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *Policy
+		table   Table
+		wantErr string
+	}{
+		{
+			name:   "exact column ignored",
+			policy: &Policy{Columns: []string{"public.users.ssn"}},
+			table:  Table{Name: "users", Ignore: []string{"ssn"}},
+		},
+		{
+			name:   "exact column transformed",
+			policy: &Policy{Columns: []string{"public.users.ssn"}},
+			table:  Table{Name: "users", Transform: map[string]string{"ssn": "redact"}},
+		},
+		{
+			name:    "exact column copied as is",
+			policy:  &Policy{Columns: []string{"public.users.ssn"}},
+			table:   Table{Name: "users"},
+			wantErr: "column 'ssn' is sensitive by policy",
+		},
+		{
+			name:    "default transformation does not mask",
+			policy:  &Policy{Columns: []string{"public.users.ssn"}},
+			table:   Table{Name: "users", Transform: map[string]string{"ssn": "default"}},
+			wantErr: "column 'ssn' is sensitive by policy",
+		},
+		{
+			name:   "wildcards are checked when copying",
+			policy: &Policy{Columns: []string{"ssn", "public.*.ssn"}},
+			table:  Table{Name: "users"},
+		},
+		{
+			name:    "too many parts",
+			policy:  &Policy{Columns: []string{"db.public.users.ssn"}},
+			table:   Table{Name: "users"},
+			wantErr: "invalid column pattern",
+		},
+		{
+			name:    "empty part",
+			policy:  &Policy{Columns: []string{"users..ssn"}},
+			table:   Table{Name: "users"},
+			wantErr: "empty name",
+		},
+		{
+			name:    "malformed wildcard",
+			policy:  &Policy{Columns: []string{"ssn_[a"}},
+			table:   Table{Name: "users"},
+			wantErr: "invalid column pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				Policy:  tt.policy,
+				Schemas: []Schema{{Name: "public", Tables: []Table{tt.table}}},
+			}
+
+			err := validateConfig(config)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigWithPolicyFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policy.yaml"), []byte("columns:\n  - public.users.ssn\n  - \"*_token\"\n"), 0o600))
+
+	configFile := filepath.Join(dir, "config.yaml")
+	writeConfig := func(table string) {
+		require.NoError(t, os.WriteFile(configFile, []byte(`
+policy:
+  file: policy.yaml
+  columns: [email]
+schemas:
+  - name: public
+    tables:
+`+table), 0o600))
+	}
+
+	writeConfig("      - name: users\n        ignore: [ssn]\n")
+	config, err := LoadConfig(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"email", "public.users.ssn", "*_token"}, config.Policy.Columns)
+
+	tables := config.GetAllTables()
+	require.Len(t, tables, 1)
+	assert.Same(t, config.Policy, tables[0].Policy)
+
+	// Columns named by the policy file are checked like inline ones
+	writeConfig("      - name: users\n")
+	_, err = LoadConfig(configFile)
+	assert.ErrorContains(t, err, "column 'ssn' is sensitive by policy")
+}
@@ -0,0 +1,139 @@
+package schema
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"pgcopy/internal/secret"
+)
+
+// pgpassScheme marks a password that is looked up in a .pgpass file. An optional
+// path may follow the colon; otherwise $PGPASSFILE or ~/.pgpass is used.
+const pgpassScheme = "pgpass:"
+
+// resolveSecrets resolves secret references in the source and target database configurations
+func resolveSecrets(config *Config) error {
+	if err := config.Source.resolveSecrets("source"); err != nil {
+		return err
+	}
+	if err := config.Target.resolveSecrets("target"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// resolveSecrets resolves secret references in every field, applies the
+// pg_service.conf service if one is named and finally resolves the password
+func (db *DatabaseConfig) resolveSecrets(name string) error {
+	for _, field := range db.secretFields() {
+		resolved, err := secret.Resolve(*field.value)
+		if err != nil {
+			return fmt.Errorf("%s database: %s: %w", name, field.name, err)
+		}
+		*field.value = resolved
+	}
+
+	for key, value := range db.Options {
+		resolved, err := secret.Resolve(value)
+		if err != nil {
+			return fmt.Errorf("%s database: options.%s: %w", name, key, err)
+		}
+		db.Options[key] = resolved
+	}
+
+	if db.Service != "" {
+		if err := db.applyService(); err != nil {
+			return fmt.Errorf("%s database: service: %w", name, err)
+		}
+	}
+
+	// The password is resolved last so pgpass lookups see the final connection fields
+	if path, ok := strings.CutPrefix(db.Password, pgpassScheme); ok {
+		port := db.Port
+		if port == 0 {
+			port = 5432
+		}
+		password, err := secret.LookupPgpass(path, db.Host, port, db.Database, db.Username)
+		if err != nil {
+			return fmt.Errorf("%s database: password: %w", name, err)
+		}
+		db.Password = password
+		return nil
+	}
+
+	password, err := secret.Resolve(db.Password)
+	if err != nil {
+		return fmt.Errorf("%s database: password: %w", name, err)
+	}
+	db.Password = password
+
+	return nil
+}
+
+// secretField is a string field of DatabaseConfig that may hold a secret reference
+type secretField struct {
+	name  string
+	value *string
+}
+
+// secretFields returns the fields resolved before the service and password
+func (db *DatabaseConfig) secretFields() []secretField {
+	fields := []secretField{
+		{name: "host", value: &db.Host},
+		{name: "database", value: &db.Database},
+		{name: "username", value: &db.Username},
+		{name: "ssl_mode", value: &db.SSLMode},
+		{name: "service", value: &db.Service},
+		{name: "ssl_root_cert", value: &db.SSLRootCert},
+		{name: "ssl_cert", value: &db.SSLCert},
+		{name: "ssl_key", value: &db.SSLKey},
+		{name: "application_name", value: &db.ApplicationName},
+		{name: "statement_timeout", value: &db.StatementTimeout},
+		{name: "lock_timeout", value: &db.LockTimeout},
+		{name: "search_path", value: &db.SearchPath},
+	}
+	if tunnel := db.SSHTunnel; tunnel != nil {
+		fields = append(fields,
+			secretField{name: "ssh_tunnel.host", value: &tunnel.Host},
+			secretField{name: "ssh_tunnel.user", value: &tunnel.User},
+			secretField{name: "ssh_tunnel.key_file", value: &tunnel.KeyFile},
+			secretField{name: "ssh_tunnel.key_passphrase", value: &tunnel.KeyPassphrase},
+			secretField{name: "ssh_tunnel.known_hosts", value: &tunnel.KnownHosts},
+		)
+	}
+	return fields
+}
+
+// applyService fills fields that are not set explicitly from pg_service.conf
+func (db *DatabaseConfig) applyService() error {
+	settings, err := secret.LookupService(db.Service)
+	if err != nil {
+		return err
+	}
+
+	setIfEmpty := func(field *string, key string) {
+		if *field == "" {
+			*field = settings[key]
+		}
+	}
+	setIfEmpty(&db.Host, "host")
+	setIfEmpty(&db.Database, "dbname")
+	setIfEmpty(&db.Username, "user")
+	setIfEmpty(&db.Password, "password")
+	setIfEmpty(&db.SSLMode, "sslmode")
+	setIfEmpty(&db.SSLRootCert, "sslrootcert")
+	setIfEmpty(&db.SSLCert, "sslcert")
+	setIfEmpty(&db.SSLKey, "sslkey")
+	setIfEmpty(&db.ApplicationName, "application_name")
+
+	if db.Port == 0 && settings["port"] != "" {
+		port, err := strconv.Atoi(settings["port"])
+		if err != nil {
+			return fmt.Errorf("invalid port %q in service %q", settings["port"], db.Service)
+		}
+		db.Port = port
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigWithSecretReferences(t *testing.T) {
+	dir := t.TempDir()
+
+	secretFile := filepath.Join(dir, "pg_pass")
+	require.NoError(t, os.WriteFile(secretFile, []byte("file_pass\n"), 0o600))
+
+	passfile := filepath.Join(dir, "pgpass")
+	require.NoError(t, os.WriteFile(passfile, []byte("target-db.example.com:5433:target_db:target_user:pgpass_pass\n"), 0o600))
+
+	t.Setenv("SOURCE_HOST", "source-db.example.com")
+
+	yamlContent := `
+source:
+  host: "env:SOURCE_HOST"
+  database: "source_db"
+  username: "exec:echo source_user"
+  password: "file:` + secretFile + `"
+
+target:
+  host: "target-db.example.com"
+  port: 5433
+  database: "target_db"
+  username: "target_user"
+  password: "pgpass:` + passfile + `"
+
+schemas:
+  - name: public
+    tables:
+      - name: users
+`
+
+	config, err := LoadConfig(writeConfigFile(t, yamlContent))
+	require.NoError(t, err)
+
+	assert.Equal(t, "source-db.example.com", config.Source.Host)
+	assert.Equal(t, "source_user", config.Source.Username)
+	assert.Equal(t, "file_pass", config.Source.Password)
+	assert.Equal(t, "pgpass_pass", config.Target.Password)
+}
+
+func TestLoadConfigWithService(t *testing.T) {
+	serviceFile := filepath.Join(t.TempDir(), "pg_service.conf")
+	content := "[prod]\nhost=prod-db.example.com\nport=5433\ndbname=production\nuser=prod_user\npassword=service_pass\nsslmode=require\n"
+	require.NoError(t, os.WriteFile(serviceFile, []byte(content), 0o600))
+	t.Setenv("PGSERVICEFILE", serviceFile)
+
+	yamlContent := `
+source:
+  service: prod
+  username: "override_user"
+
+schemas:
+  - name: public
+    tables:
+      - name: users
+`
+
+	config, err := LoadConfig(writeConfigFile(t, yamlContent))
+	require.NoError(t, err)
+
+	assert.Equal(t, "prod-db.example.com", config.Source.Host)
+	assert.Equal(t, 5433, config.Source.Port)
+	assert.Equal(t, "production", config.Source.Database)
+	assert.Equal(t, "override_user", config.Source.Username)
+	assert.Equal(t, "service_pass", config.Source.Password)
+	assert.Equal(t, "require", config.Source.SSLMode)
+}
+
+func TestLoadConfigWithUnresolvableSecret(t *testing.T) {
+	yamlContent := `
+source:
+  host: "source-db.example.com"
+  database: "source_db"
+  username: "source_user"
+  password: "file:/nonexistent/pg_pass"
+
+schemas:
+  - name: public
+    tables:
+      - name: users
+`
+
+	_, err := LoadConfig(writeConfigFile(t, yamlContent))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "source database: password")
+	assert.Contains(t, err.Error(), "failed to read secret file")
+}
+
+// writeConfigFile writes YAML content to a temporary config file
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
@@ -0,0 +1,84 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jackc/pgpassfile"
+	"github.com/jackc/pgservicefile"
+)
+
+// LookupPgpass finds the password for a connection in a .pgpass file. An empty
+// path uses $PGPASSFILE or ~/.pgpass, like libpq.
+func LookupPgpass(path, host string, port int, database, username string) (string, error) {
+	if path == "" {
+		path = defaultPgpassPath()
+	}
+
+	passfile, err := pgpassfile.ReadPassfile(ExpandHome(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to read pgpass file %s: %w", path, err)
+	}
+
+	password := passfile.FindPassword(host, strconv.Itoa(port), database, username)
+	if password == "" {
+		return "", fmt.Errorf("no pgpass entry in %s matches %s:%d/%s as %s", path, host, port, database, username)
+	}
+
+	return password, nil
+}
+
+// LookupService returns the settings of a pg_service.conf service. The file is
+// located through $PGSERVICEFILE, ~/.pg_service.conf or $PGSYSCONFDIR/pg_service.conf.
+func LookupService(name string) (map[string]string, error) {
+	var lastErr error
+	for _, path := range serviceFilePaths() {
+		servicefile, err := pgservicefile.ReadServicefile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read service file %s: %w", path, err)
+		}
+
+		service, err := servicefile.GetService(name)
+		if err != nil {
+			lastErr = fmt.Errorf("service %q not found in %s", name, path)
+			continue
+		}
+
+		return service.Settings, nil
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("service %q requested but no pg_service.conf file was found", name)
+}
+
+// defaultPgpassPath returns the pgpass location used by libpq
+func defaultPgpassPath() string {
+	if path := os.Getenv("PGPASSFILE"); path != "" {
+		return path
+	}
+	return "~/.pgpass"
+}
+
+// serviceFilePaths returns the candidate pg_service.conf locations in lookup order
+func serviceFilePaths() []string {
+	if path := os.Getenv("PGSERVICEFILE"); path != "" {
+		return []string{path}
+	}
+
+	var paths []string
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".pg_service.conf"))
+	}
+	if dir := os.Getenv("PGSYSCONFDIR"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "pg_service.conf"))
+	}
+	return paths
+}
@@ -0,0 +1,160 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// execTimeout bounds how long an exec: reference may run
+const execTimeout = 30 * time.Second
+
+// Provider resolves the part of a secret reference that follows its scheme
+type Provider interface {
+	Resolve(ref string) (string, error)
+}
+
+// ProviderFunc adapts a function to the Provider interface
+type ProviderFunc func(ref string) (string, error)
+
+// Resolve calls f(ref)
+func (f ProviderFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Provider{
+		"env":  ProviderFunc(resolveEnv),
+		"file": ProviderFunc(resolveFile),
+		"exec": ProviderFunc(resolveExec),
+	}
+)
+
+// Register makes a provider available for references of the form "<scheme>:<ref>"
+func Register(scheme string, provider Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[scheme] = provider
+}
+
+// Schemes returns the registered schemes in sorted order
+func Schemes() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	schemes := make([]string, 0, len(providers))
+	for scheme := range providers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Resolve resolves a configuration value. Values of the form "<scheme>:<ref>" are
+// passed to the provider registered for scheme, ${VAR} placeholders are expanded
+// from the environment, and anything else is returned unchanged.
+func Resolve(value string) (string, error) {
+	if provider, ref, ok := lookup(value); ok {
+		resolved, err := provider.Resolve(ref)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve secret reference %q: %w", scheme(value), err)
+		}
+		return resolved, nil
+	}
+
+	if strings.Contains(value, "${") {
+		return os.ExpandEnv(value), nil
+	}
+
+	return value, nil
+}
+
+// IsReference reports whether value uses a registered scheme
+func IsReference(value string) bool {
+	_, _, ok := lookup(value)
+	return ok
+}
+
+// lookup finds the provider for a "<scheme>:<ref>" value
+func lookup(value string) (Provider, string, bool) {
+	name, ref, found := strings.Cut(value, ":")
+	if !found {
+		return nil, "", false
+	}
+
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	provider, ok := providers[name]
+	return provider, ref, ok
+}
+
+// scheme returns the scheme prefix of a reference for error messages. The rest of
+// the reference is left out since exec: commands may embed credentials.
+func scheme(value string) string {
+	name, _, _ := strings.Cut(value, ":")
+	return name + ":"
+}
+
+// resolveEnv reads an environment variable that must be set
+func resolveEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// resolveFile reads a secret from a file, trimming the trailing newline
+func resolveFile(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("file path is empty")
+	}
+
+	data, err := os.ReadFile(ExpandHome(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveExec runs a shell command and uses its standard output as the secret
+func resolveExec(command string) (string, error) {
+	if strings.TrimSpace(command) == "" {
+		return "", fmt.Errorf("command is empty")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stderr = os.Stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("secret command failed: %w", err)
+	}
+
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
+
+// ExpandHome replaces a leading ~ with the user's home directory
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return home + strings.TrimPrefix(path, "~")
+}
@@ -0,0 +1,132 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "pg_pass")
+	require.NoError(t, os.WriteFile(secretFile, []byte("file_secret\n"), 0o600))
+
+	t.Setenv("PGCOPY_TEST_SECRET", "env_secret")
+
+	tests := []struct {
+		name        string
+		value       string
+		expected    string
+		expectError string
+	}{
+		{
+			name:     "plain value",
+			value:    "plain",
+			expected: "plain",
+		},
+		{
+			name:     "unknown scheme is kept",
+			value:    "vault:secret/data/pg",
+			expected: "vault:secret/data/pg",
+		},
+		{
+			name:     "environment placeholder",
+			value:    "${PGCOPY_TEST_SECRET}",
+			expected: "env_secret",
+		},
+		{
+			name:     "env reference",
+			value:    "env:PGCOPY_TEST_SECRET",
+			expected: "env_secret",
+		},
+		{
+			name:        "missing env reference",
+			value:       "env:PGCOPY_TEST_MISSING",
+			expectError: "environment variable PGCOPY_TEST_MISSING is not set",
+		},
+		{
+			name:     "file reference",
+			value:    "file:" + secretFile,
+			expected: "file_secret",
+		},
+		{
+			name:        "missing file reference",
+			value:       "file:/nonexistent/pg_pass",
+			expectError: `failed to resolve secret reference "file:"`,
+		},
+		{
+			name:     "exec reference",
+			value:    "exec:echo exec_secret",
+			expected: "exec_secret",
+		},
+		{
+			name:        "failing exec reference",
+			value:       "exec:exit 3",
+			expectError: "secret command failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, err := Resolve(tt.value)
+			if tt.expectError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, resolved)
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("static", ProviderFunc(func(ref string) (string, error) {
+		return "static-" + ref, nil
+	}))
+
+	assert.Contains(t, Schemes(), "static")
+	assert.True(t, IsReference("static:value"))
+
+	resolved, err := Resolve("static:value")
+	require.NoError(t, err)
+	assert.Equal(t, "static-value", resolved)
+}
+
+func TestLookupPgpass(t *testing.T) {
+	passfile := filepath.Join(t.TempDir(), "pgpass")
+	content := "db.example.com:5432:app:reader:reader_pass\n*:*:*:admin:admin_pass\n"
+	require.NoError(t, os.WriteFile(passfile, []byte(content), 0o600))
+
+	password, err := LookupPgpass(passfile, "db.example.com", 5432, "app", "reader")
+	require.NoError(t, err)
+	assert.Equal(t, "reader_pass", password)
+
+	password, err = LookupPgpass(passfile, "other.example.com", 5433, "other", "admin")
+	require.NoError(t, err)
+	assert.Equal(t, "admin_pass", password)
+
+	_, err = LookupPgpass(passfile, "db.example.com", 5432, "app", "nobody")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no pgpass entry")
+}
+
+func TestLookupService(t *testing.T) {
+	serviceFile := filepath.Join(t.TempDir(), "pg_service.conf")
+	content := "[prod]\nhost=prod-db.example.com\nport=5433\ndbname=production\nuser=prod_user\n"
+	require.NoError(t, os.WriteFile(serviceFile, []byte(content), 0o600))
+	t.Setenv("PGSERVICEFILE", serviceFile)
+
+	settings, err := LookupService("prod")
+	require.NoError(t, err)
+	assert.Equal(t, "prod-db.example.com", settings["host"])
+	assert.Equal(t, "5433", settings["port"])
+	assert.Equal(t, "production", settings["dbname"])
+	assert.Equal(t, "prod_user", settings["user"])
+
+	_, err = LookupService("staging")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `service "staging" not found`)
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms for files and streams
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// Magic bytes at the start of compressed streams
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ValidateCompression returns an error if compression is not a known algorithm
+func ValidateCompression(compression string) error {
+	switch compression {
+	case "", CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	}
+	return fmt.Errorf("invalid compression '%s' (expected %s, %s or %s)",
+		compression, CompressionNone, CompressionGzip, CompressionZstd)
+}
+
+// Extension returns the file name extension of a compression algorithm, including the dot
+func Extension(compression string) string {
+	switch compression {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// NewWriter compresses everything written to w. Level 0 selects the algorithm's default.
+// Closing the returned writer flushes the compressed stream and closes w.
+func NewWriter(w io.WriteCloser, compression string, level int) (io.WriteCloser, error) {
+	switch compression {
+	case "", CompressionNone:
+		return w, nil
+	case CompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		gz, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip level %d: %w", level, err)
+		}
+		return &compressWriter{Writer: gz, closer: gz, underlying: w}, nil
+	case CompressionZstd:
+		opts := []zstd.EOption{}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		enc, err := zstd.NewWriter(w, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		return &compressWriter{Writer: enc, closer: enc, underlying: w}, nil
+	}
+	return nil, ValidateCompression(compression)
+}
+
+// NewReader decompresses r when the file name has a compression extension or the stream
+// starts with gzip or zstd magic bytes. Closing the returned reader closes r.
+func NewReader(r io.ReadCloser, name string) (io.ReadCloser, error) {
+	compression := detectCompression(name)
+
+	buffered := bufio.NewReader(r)
+	if compression == "" {
+		// Peek errors mean a stream too short to be compressed
+		header, _ := buffered.Peek(len(zstdMagic))
+		switch {
+		case bytes.HasPrefix(header, gzipMagic):
+			compression = CompressionGzip
+		case bytes.HasPrefix(header, zstdMagic):
+			compression = CompressionZstd
+		}
+	}
+
+	switch compression {
+	case CompressionGzip:
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip stream: %w", err)
+		}
+		return &decompressReader{Reader: gz, closer: gz, underlying: r}, nil
+	case CompressionZstd:
+		dec, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd stream: %w", err)
+		}
+		return &decompressReader{Reader: dec, closer: dec.IOReadCloser(), underlying: r}, nil
+	}
+
+	return &decompressReader{Reader: buffered, underlying: r}, nil
+}
+
+// detectCompression returns the compression indicated by a file name extension
+func detectCompression(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		return CompressionGzip
+	case strings.HasSuffix(name, ".zst"):
+		return CompressionZstd
+	}
+	return ""
+}
+
+// compressWriter closes the compressor before the underlying writer
+type compressWriter struct {
+	io.Writer
+	closer     io.Closer
+	underlying io.Closer
+}
+
+func (w *compressWriter) Close() error {
+	err := w.closer.Close()
+	// A file missing the end of its compressed stream is discarded rather than completed
+	if file, ok := w.underlying.(File); ok && err != nil {
+		file.Abort(err)
+		return err
+	}
+	if closeErr := w.underlying.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// decompressReader closes the decompressor and the underlying reader
+type decompressReader struct {
+	io.Reader
+	closer     io.Closer
+	underlying io.Closer
+}
+
+func (r *decompressReader) Close() error {
+	if r.closer != nil {
+		r.closer.Close()
+	}
+	return r.underlying.Close()
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nopWriteCloser records whether it was closed
+type nopWriteCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *nopWriteCloser) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	data := strings.Repeat("1\talice\talice@example.com\n", 1000)
+
+	for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			var buf nopWriteCloser
+			w, err := NewWriter(&buf, compression, 0)
+			require.NoError(t, err)
+			_, err = io.WriteString(w, data)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+			assert.True(t, buf.closed)
+
+			if compression != CompressionNone {
+				assert.Less(t, buf.Len(), len(data))
+			}
+
+			// Detected from the content alone
+			r, err := NewReader(io.NopCloser(bytes.NewReader(buf.Bytes())), "users.csv")
+			require.NoError(t, err)
+			decompressed, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+			assert.Equal(t, data, string(decompressed))
+		})
+	}
+}
+
+func TestNewWriter_Levels(t *testing.T) {
+	var buf nopWriteCloser
+	w, err := NewWriter(&buf, CompressionGzip, 9)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	_, err = NewWriter(&buf, CompressionGzip, 42)
+	assert.Error(t, err)
+
+	w, err = NewWriter(&buf, CompressionZstd, 19)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	_, err = NewWriter(&buf, "lz4", 0)
+	assert.Error(t, err)
+}
+
+func TestNewReader_ExtensionMismatch(t *testing.T) {
+	// A .gz extension on plain data is an error rather than silently passing it through
+	_, err := NewReader(io.NopCloser(strings.NewReader("id,name\n")), "users.csv.gz")
+	assert.Error(t, err)
+
+	r, err := NewReader(io.NopCloser(strings.NewReader("")), "empty.csv")
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+func TestExtension(t *testing.T) {
+	assert.Equal(t, ".gz", Extension(CompressionGzip))
+	assert.Equal(t, ".zst", Extension(CompressionZstd))
+	assert.Equal(t, "", Extension(CompressionNone))
+	assert.NoError(t, ValidateCompression(""))
+	assert.Error(t, ValidateCompression("brotli"))
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3Scheme is the prefix of S3 storage locations
+const s3Scheme = "s3://"
+
+// defaultS3Endpoint is used when no endpoint is configured in the environment
+const defaultS3Endpoint = "https://s3.amazonaws.com"
+
+// s3PartSize is the size of the parts files are uploaded in. Only one part is held in
+// memory at a time, and S3's limit of 10,000 parts allows files of up to ~312 GiB.
+const s3PartSize = 32 << 20
+
+// S3 stores files under a prefix of a bucket in S3 or an S3-compatible object store.
+// The endpoint, region and credentials are taken from the standard AWS environment:
+// AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL, AWS_REGION or AWS_DEFAULT_REGION,
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, the AWS_PROFILE of the shared
+// credentials file, or the instance role.
+type S3 struct {
+	client   *minio.Client
+	bucket   string
+	prefix   string
+	partSize uint64
+}
+
+// NewS3 creates an S3 storage for an s3://bucket/prefix location
+func NewS3(location string) (*S3, error) {
+	bucket, prefix, err := ParseS3Location(location)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = defaultS3Endpoint
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || endpointURL.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+	}
+
+	client, err := minio.New(endpointURL.Host, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+		}),
+		Secure: endpointURL.Scheme != "http",
+		Region: firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	return &S3{client: client, bucket: bucket, prefix: prefix, partSize: s3PartSize}, nil
+}
+
+// ParseS3Location splits an s3://bucket/prefix location into its bucket and prefix
+func ParseS3Location(location string) (bucket, prefix string, err error) {
+	if !strings.HasPrefix(location, s3Scheme) {
+		return "", "", fmt.Errorf("invalid S3 location %q (expected s3://bucket/prefix)", location)
+	}
+
+	bucket, prefix, _ = strings.Cut(strings.TrimPrefix(location, s3Scheme), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("invalid S3 location %q: bucket is required", location)
+	}
+	return bucket, strings.Trim(prefix, "/"), nil
+}
+
+// Create starts a multipart upload of a file. Data is uploaded in parts while it is
+// written, and the object is completed when the writer is closed or the upload aborted
+// when the writer is aborted.
+func (s *S3) Create(ctx context.Context, name string) (File, error) {
+	key, err := s.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	w := &s3Writer{pw: pw, done: make(chan error, 1)}
+	go func() {
+		_, err := s.client.PutObject(ctx, s.bucket, key, pr, -1, minio.PutObjectOptions{PartSize: s.partSize})
+		if err != nil {
+			err = fmt.Errorf("failed to upload %s: %w", key, err)
+		}
+		// Unblock the writer if the upload stopped early
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w, nil
+}
+
+// Open opens a file for reading, streaming it from the bucket
+func (s *S3) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	key, err := s.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// Requests are lazy, so stat the object to report missing files on open
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	return object, nil
+}
+
+// String returns the s3:// location
+func (s *S3) String() string {
+	if s.prefix == "" {
+		return s3Scheme + s.bucket
+	}
+	return s3Scheme + s.bucket + "/" + s.prefix
+}
+
+// key returns the object key of a file
+func (s *S3) key(name string) (string, error) {
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+	return path.Join(s.prefix, name), nil
+}
+
+// errAborted fails an upload aborted without a reason
+var errAborted = errors.New("upload aborted")
+
+// s3Writer feeds an upload running in the background
+type s3Writer struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// Write passes data to the upload
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close ends the data and waits for the upload to complete
+func (w *s3Writer) Close() error {
+	w.pw.Close()
+	return <-w.done
+}
+
+// Abort fails the upload with err, so the multipart upload is aborted instead of being
+// completed with partial data, and waits for it to stop
+func (w *s3Writer) Abort(err error) {
+	if err == nil {
+		err = errAborted
+	}
+	w.pw.CloseWithError(err)
+	<-w.done
+}
+
+// firstEnv returns the value of the first environment variable that is set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is a minimal S3-compatible server holding objects in memory. It supports the
+// requests made by S3 storage: multipart uploads, stat and get.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	parts   int
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	fake := &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_ENDPOINT_URL", server.URL)
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret")
+	return fake
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := r.URL.Path
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		uploadID := strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[uploadID] = map[int][]byte{}
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, uploadID)
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		body, err := readPayload(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		f.uploads[query.Get("uploadId")][partNumber] = body
+		f.parts++
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, partNumber))
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts := f.uploads[query.Get("uploadId")]
+		numbers := make([]int, 0, len(parts))
+		for number := range parts {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		var object []byte
+		for _, number := range numbers {
+			object = append(object, parts[number]...)
+		}
+		f.objects[key] = object
+		delete(f.uploads, query.Get("uploadId"))
+		bucket, objectKey, _ := strings.Cut(strings.TrimPrefix(key, "/"), "/")
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>"object"</ETag></CompleteMultipartUploadResult>`, bucket, objectKey)
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		object, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			}
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(object)))
+		w.Header().Set("ETag", `"object"`)
+		w.Header().Set("Last-Modified", "Mon, 01 Jan 2024 00:00:00 GMT")
+		if r.Method == http.MethodGet {
+			w.Write(object)
+		}
+
+	default:
+		http.Error(w, "unsupported request", http.StatusNotImplemented)
+	}
+}
+
+// readPayload reads a request body, decoding the aws-chunked encoding of streaming signatures
+func readPayload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	var payload bytes.Buffer
+	reader := bufio.NewReader(r.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return payload.Bytes(), nil
+		}
+		if _, err := io.CopyN(&payload, reader, size); err != nil {
+			return nil, err
+		}
+		if _, err := reader.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func TestParseS3Location(t *testing.T) {
+	tests := []struct {
+		location string
+		bucket   string
+		prefix   string
+		wantErr  bool
+	}{
+		{location: "s3://snapshots", bucket: "snapshots"},
+		{location: "s3://snapshots/nightly/2024-01-01/", bucket: "snapshots", prefix: "nightly/2024-01-01"},
+		{location: "s3:///nightly", wantErr: true},
+		{location: "/tmp/snapshot", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			bucket, prefix, err := ParseS3Location(tt.location)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.bucket, bucket)
+			assert.Equal(t, tt.prefix, prefix)
+		})
+	}
+}
+
+func TestNewSelectsS3(t *testing.T) {
+	newFakeS3(t)
+
+	store, err := New("s3://snapshots/nightly")
+	require.NoError(t, err)
+	assert.IsType(t, &S3{}, store)
+	assert.Equal(t, "s3://snapshots/nightly", store.String())
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	fake := newFakeS3(t)
+	ctx := context.Background()
+
+	store, err := NewS3("s3://snapshots/nightly")
+	require.NoError(t, err)
+	// Use the smallest part size S3 allows so the file is uploaded in several parts
+	store.partSize = 5 << 20
+
+	data := bytes.Repeat([]byte("id,name\n1,alice\n"), 800000)
+	w, err := store.Create(ctx, "public.users.csv")
+	require.NoError(t, err)
+	// Write in small chunks as a COPY stream does
+	for offset := 0; offset < len(data); offset += 64 << 10 {
+		end := min(offset+64<<10, len(data))
+		_, err := w.Write(data[offset:end])
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	assert.Equal(t, 3, fake.parts)
+	assert.Contains(t, fake.objects, "/snapshots/nightly/public.users.csv")
+
+	r, err := store.Open(ctx, "public.users.csv")
+	require.NoError(t, err)
+	defer r.Close()
+	read, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, read)
+
+	_, err = store.Open(ctx, "missing.csv")
+	assert.Error(t, err)
+
+	_, err = store.Create(ctx, "../escape.csv")
+	assert.Error(t, err)
+}
+
+func TestS3CompressedRoundTrip(t *testing.T) {
+	newFakeS3(t)
+	ctx := context.Background()
+
+	store, err := New("s3://snapshots")
+	require.NoError(t, err)
+
+	file, err := store.Create(ctx, "public.users.csv.zst")
+	require.NoError(t, err)
+	w, err := NewWriter(file, CompressionZstd, 0)
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "1,alice\n2,bob\n")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	object, err := store.Open(ctx, "public.users.csv.zst")
+	require.NoError(t, err)
+	r, err := NewReader(object, "public.users.csv.zst")
+	require.NoError(t, err)
+	defer r.Close()
+	read, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "1,alice\n2,bob\n", string(read))
+}
+
+func TestS3AbortLeavesNoObject(t *testing.T) {
+	fake := newFakeS3(t)
+	ctx := context.Background()
+
+	store, err := NewS3("s3://snapshots/nightly")
+	require.NoError(t, err)
+	store.partSize = 5 << 20
+
+	// An export failing after a part was uploaded
+	w, err := store.Create(ctx, "public.users.csv")
+	require.NoError(t, err)
+	_, err = w.Write(bytes.Repeat([]byte("1,alice\n"), 800000))
+	require.NoError(t, err)
+	w.Abort(errors.New("copy failed"))
+
+	assert.NotContains(t, fake.objects, "/snapshots/nightly/public.users.csv")
+	assert.Empty(t, fake.uploads)
+
+	// A failed write does not replace the previous object
+	w, err = store.Create(ctx, "public.orders.csv")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "1,42\n")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	w, err = store.Create(ctx, "public.orders.csv")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "2,4")
+	require.NoError(t, err)
+	w.Abort(errors.New("copy failed"))
+
+	assert.Equal(t, "1,42\n", string(fake.objects["/snapshots/nightly/public.orders.csv"]))
+	assert.Empty(t, fake.uploads)
+}
+
+func TestS3CompressedAbort(t *testing.T) {
+	fake := newFakeS3(t)
+	ctx := context.Background()
+
+	store, err := New("s3://snapshots")
+	require.NoError(t, err)
+
+	file, err := store.Create(ctx, "public.users.csv.zst")
+	require.NoError(t, err)
+	w, err := NewWriter(file, CompressionZstd, 0)
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "1,alice\n")
+	require.NoError(t, err)
+	file.Abort(errors.New("copy failed"))
+
+	assert.Empty(t, fake.objects)
+	assert.Empty(t, fake.uploads)
+}
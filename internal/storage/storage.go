@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Storage is a location that exported table files are written to and read from
+type Storage interface {
+	// Create opens a named file for writing. The file replaces any existing file once it
+	// is closed, and is discarded if it is aborted.
+	Create(ctx context.Context, name string) (File, error)
+	// Open opens a named file for reading
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// String returns the location for logging
+	String() string
+}
+
+// File is a file being written. Close completes it, Abort discards what was written so a
+// failed write never replaces an existing file with a partial one.
+type File interface {
+	io.WriteCloser
+	// Abort discards the file, err is the reason the write failed
+	Abort(err error)
+}
+
+// New returns the storage for a location, an s3://bucket/prefix URL or a local directory
+func New(location string) (Storage, error) {
+	if location == "" {
+		return nil, fmt.Errorf("storage location is required")
+	}
+	if strings.HasPrefix(location, s3Scheme) {
+		return NewS3(location)
+	}
+	return NewLocal(location)
+}
+
+// Local stores files in a directory on the local filesystem
+type Local struct {
+	dir string
+}
+
+// NewLocal creates a local storage, creating the directory if needed
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	return &Local{dir: dir}, nil
+}
+
+// Create opens a file in the directory for writing. Data is written to a temporary file
+// in the same directory, which is renamed over the file when it is closed.
+func (l *Local) Create(ctx context.Context, name string) (File, error) {
+	path, err := l.path(name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(l.dir, "."+name+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &localFile{File: file, path: path}, nil
+}
+
+// Open opens a file in the directory for reading
+func (l *Local) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	path, err := l.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// String returns the directory
+func (l *Local) String() string {
+	return l.dir
+}
+
+// path returns the path of a file, rejecting names that escape the directory
+func (l *Local) path(name string) (string, error) {
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.dir, name), nil
+}
+
+// validateName rejects file names that are empty or contain a path
+func validateName(name string) error {
+	if name == "" || filepath.IsAbs(name) || strings.Contains(name, "..") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+	return nil
+}
+
+// localFile is a temporary file that becomes the named file when it is closed
+type localFile struct {
+	*os.File
+	path string
+}
+
+// Close completes the file, replacing any existing file
+func (f *localFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	if err := os.Rename(f.File.Name(), f.path); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort removes the temporary file, leaving any existing file in place
+func (f *localFile) Abort(err error) {
+	f.File.Close()
+	os.Remove(f.File.Name())
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocal_CreateAndOpen(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "snapshot")
+
+	store, err := New(dir)
+	require.NoError(t, err)
+	assert.Equal(t, dir, store.String())
+
+	w, err := store.Create(ctx, "public.users.csv")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "id,name\n1,alice\n")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r, err := store.Open(ctx, "public.users.csv")
+	require.NoError(t, err)
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "id,name\n1,alice\n", string(data))
+}
+
+func TestLocal_Abort(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewLocal(dir)
+	require.NoError(t, err)
+
+	w, err := store.Create(ctx, "public.users.csv")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "id,name\n1,alice\n")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// A failed write leaves the previous file in place and no partial file behind
+	w, err = store.Create(ctx, "public.users.csv")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "id,name\n2,b")
+	require.NoError(t, err)
+	w.Abort(errors.New("copy failed"))
+
+	data, err := os.ReadFile(filepath.Join(dir, "public.users.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "id,name\n1,alice\n", string(data))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestLocal_InvalidNames(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocal(t.TempDir())
+	require.NoError(t, err)
+
+	for _, name := range []string{"", "../users.csv", "nested/users.csv", "/etc/passwd"} {
+		_, err := store.Create(ctx, name)
+		assert.Error(t, err, name)
+		_, err = store.Open(ctx, name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestNew_EmptyLocation(t *testing.T) {
+	_, err := New("")
+	assert.Error(t, err)
+}
@@ -3,10 +3,13 @@ package testutil
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/docker/go-connections/nat"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
 )
@@ -122,3 +125,72 @@ func (pc *PostgresContainer) WaitForReady(ctx context.Context, timeout time.Dura
 		}
 	}
 }
+
+// MinIOContainer represents a MinIO container serving an S3-compatible API
+type MinIOContainer struct {
+	Container testcontainers.Container
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+}
+
+// StartMinIOContainer starts a MinIO container
+func StartMinIOContainer(ctx context.Context) (*MinIOContainer, error) {
+	req := testcontainers.ContainerRequest{
+		Image:        "minio/minio:latest",
+		ExposedPorts: []string{"9000/tcp"},
+		Env: map[string]string{
+			"MINIO_ROOT_USER":     "minioadmin",
+			"MINIO_ROOT_PASSWORD": "minioadmin",
+		},
+		Cmd:        []string{"server", "/data"},
+		WaitingFor: wait.ForHTTP("/minio/health/ready").WithPort("9000/tcp"),
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start container: %w", err)
+	}
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		container.Terminate(ctx)
+		return nil, fmt.Errorf("failed to get container host: %w", err)
+	}
+
+	mappedPort, err := container.MappedPort(ctx, "9000/tcp")
+	if err != nil {
+		container.Terminate(ctx)
+		return nil, fmt.Errorf("failed to get mapped port: %w", err)
+	}
+
+	return &MinIOContainer{
+		Container: container,
+		Endpoint:  fmt.Sprintf("http://%s:%s", host, mappedPort.Port()),
+		AccessKey: "minioadmin",
+		SecretKey: "minioadmin",
+	}, nil
+}
+
+// Stop stops and removes the MinIO container
+func (mc *MinIOContainer) Stop(ctx context.Context) error {
+	return mc.Container.Terminate(ctx)
+}
+
+// CreateBucket creates a bucket in the MinIO container
+func (mc *MinIOContainer) CreateBucket(ctx context.Context, bucket string) error {
+	endpoint, err := url.Parse(mc.Endpoint)
+	if err != nil {
+		return err
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds: credentials.NewStaticV4(mc.AccessKey, mc.SecretKey, ""),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	return client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{})
+}
@@ -1,13 +1,24 @@
 package testutil
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"pgcopy/internal/copy"
+	"pgcopy/internal/db"
+	"pgcopy/internal/pii"
 	"pgcopy/internal/schema"
+	"pgcopy/internal/storage"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/parquet-go/parquet-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -94,6 +105,7 @@ func TestCopyWithTestData(t *testing.T) {
 
 	// Create copy engine
 	engine, err := copy.NewEngine(
+		ctx,
 		sourceContainer.GetConnectionString(),
 		targetContainer.GetConnectionString(),
 	)
@@ -171,6 +183,7 @@ func TestCopyWithFilters(t *testing.T) {
 
 	// Create copy engine
 	engine, err := copy.NewEngine(
+		ctx,
 		sourceContainer.GetConnectionString(),
 		targetContainer.GetConnectionString(),
 	)
@@ -262,6 +275,7 @@ func TestCopyWithIgnoredColumns(t *testing.T) {
 
 	// Create copy engine
 	engine, err := copy.NewEngine(
+		ctx,
 		sourceContainer.GetConnectionString(),
 		targetContainer.GetConnectionString(),
 	)
@@ -348,6 +362,7 @@ func TestCopyComplexDataTypes(t *testing.T) {
 
 	// Create copy engine
 	engine, err := copy.NewEngine(
+		ctx,
 		sourceContainer.GetConnectionString(),
 		targetContainer.GetConnectionString(),
 	)
@@ -466,6 +481,7 @@ func TestCopyWithTruncate(t *testing.T) {
 
 	// Create copy engine
 	engine, err := copy.NewEngine(
+		ctx,
 		sourceContainer.GetConnectionString(),
 		targetContainer.GetConnectionString(),
 	)
@@ -515,3 +531,1610 @@ func TestCopyWithTruncate(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, expectedComplexDataCount, targetComplexDataCount)
 }
+
+func TestCopySynchronizesSequences(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	// Start containers
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	// Wait for containers to be ready
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	// Create test schema in both source and target, data only in source
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, targetContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+
+	sourcePool, err := pgxpool.New(ctx, sourceContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer sourcePool.Close()
+
+	// Advance the source sequence beyond the max id to tell both modes apart
+	_, err = sourcePool.Exec(ctx, "SELECT setval(pg_get_serial_sequence('public.products', 'id'), 500)")
+	require.NoError(t, err)
+
+	config := &schema.Config{
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{Name: "users"},
+					{Name: "products", Sequences: schema.SequencesSource},
+					{Name: "complex_data", Sequences: schema.SequencesSkip},
+				},
+			},
+		},
+	}
+
+	engine, err := copy.NewEngine(
+		ctx,
+		sourceContainer.GetConnectionString(),
+		targetContainer.GetConnectionString(),
+	)
+	require.NoError(t, err)
+	defer engine.Close()
+
+	err = engine.Copy(ctx, config)
+	require.NoError(t, err)
+
+	targetPool, err := pgxpool.New(ctx, targetContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer targetPool.Close()
+
+	// Default mode: next id follows the copied maximum
+	var maxUserID, nextUserID int64
+	err = targetPool.QueryRow(ctx, "SELECT MAX(id) FROM public.users").Scan(&maxUserID)
+	require.NoError(t, err)
+	err = targetPool.QueryRow(ctx, "SELECT nextval(pg_get_serial_sequence('public.users', 'id'))").Scan(&nextUserID)
+	require.NoError(t, err)
+	assert.Equal(t, maxUserID+1, nextUserID)
+
+	// Source mode: the source sequence value is mirrored
+	var nextProductID int64
+	err = targetPool.QueryRow(ctx, "SELECT nextval(pg_get_serial_sequence('public.products', 'id'))").Scan(&nextProductID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(501), nextProductID)
+
+	// Skip mode: the sequence is untouched
+	var nextComplexID int64
+	err = targetPool.QueryRow(ctx, "SELECT nextval(pg_get_serial_sequence('public.complex_data', 'id'))").Scan(&nextComplexID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), nextComplexID)
+}
+
+func TestCopyWithRebuildIndexes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	// Start containers
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	// Wait for containers to be ready
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	// Create test schema in both source and target, data only in source
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, targetContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+
+	targetPool, err := pgxpool.New(ctx, targetContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer targetPool.Close()
+
+	// Capture index and constraint definitions before the copy
+	definitionsQuery := `
+		SELECT string_agg(def, E'\n' ORDER BY def) FROM (
+			SELECT pg_get_indexdef(indexrelid) AS def FROM pg_index WHERE indrelid = 'public.orders'::regclass
+			UNION ALL
+			SELECT pg_get_constraintdef(oid) FROM pg_constraint WHERE conrelid = 'public.orders'::regclass
+		) defs
+	`
+	var before string
+	err = targetPool.QueryRow(ctx, definitionsQuery).Scan(&before)
+	require.NoError(t, err)
+
+	config := &schema.Config{
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{Name: "users"},
+					{
+						Name:                "orders",
+						RebuildIndexes:      true,
+						RebuildConcurrently: true,
+						RebuildParallelism:  2,
+					},
+				},
+			},
+		},
+	}
+
+	engine, err := copy.NewEngine(
+		ctx,
+		sourceContainer.GetConnectionString(),
+		targetContainer.GetConnectionString(),
+	)
+	require.NoError(t, err)
+	defer engine.Close()
+
+	err = engine.Copy(ctx, config)
+	require.NoError(t, err)
+
+	// Every index and constraint is back after the load
+	var after string
+	err = targetPool.QueryRow(ctx, definitionsQuery).Scan(&after)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	var orderCount int
+	err = targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM public.orders").Scan(&orderCount)
+	require.NoError(t, err)
+	assert.Greater(t, orderCount, 0)
+}
+
+func TestCopyWithDisabledTriggers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	// Start containers
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	// Wait for containers to be ready
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	// Create test schema in both source and target, data only in source
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, targetContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+
+	targetPool, err := pgxpool.New(ctx, targetContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer targetPool.Close()
+
+	// Audit trigger that records every inserted product
+	_, err = targetPool.Exec(ctx, `
+		CREATE TABLE public.audit_log (table_name TEXT, row_id INTEGER);
+		CREATE FUNCTION public.audit_insert() RETURNS trigger AS $$
+		BEGIN
+			INSERT INTO public.audit_log VALUES (TG_TABLE_NAME, NEW.id);
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+		CREATE TRIGGER products_audit AFTER INSERT ON public.products
+			FOR EACH ROW EXECUTE FUNCTION public.audit_insert();
+	`)
+	require.NoError(t, err)
+
+	config := &schema.Config{
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{Name: "products", DisableTriggers: true},
+					// Orders reference users that are not copied: FK checks must be skipped too
+					{Name: "orders", DisableTriggers: true},
+				},
+			},
+		},
+	}
+
+	engine, err := copy.NewEngine(
+		ctx,
+		sourceContainer.GetConnectionString(),
+		targetContainer.GetConnectionString(),
+	)
+	require.NoError(t, err)
+	defer engine.Close()
+
+	err = engine.Copy(ctx, config)
+	require.NoError(t, err)
+
+	var productCount, orderCount, auditCount int
+	err = targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM public.products").Scan(&productCount)
+	require.NoError(t, err)
+	err = targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM public.orders").Scan(&orderCount)
+	require.NoError(t, err)
+	err = targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM public.audit_log").Scan(&auditCount)
+	require.NoError(t, err)
+
+	assert.Greater(t, productCount, 0)
+	assert.Greater(t, orderCount, 0)
+	assert.Equal(t, 0, auditCount, "audit trigger must not fire during the load")
+
+	// The trigger fires again for normal sessions after the copy
+	_, err = targetPool.Exec(ctx, "INSERT INTO public.products (name, price) VALUES ('After Copy', 1.00)")
+	require.NoError(t, err)
+	err = targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM public.audit_log").Scan(&auditCount)
+	require.NoError(t, err)
+	assert.Equal(t, 1, auditCount)
+}
+
+func TestCopyWithLoadSettings(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	// Start containers
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	// Wait for containers to be ready
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	// Create test schema in both source and target, data only in source
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, targetContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+
+	config := &schema.Config{
+		LoadSettings: &schema.LoadSettings{
+			SynchronousCommit:  "off",
+			MaintenanceWorkMem: "128MB",
+		},
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{Name: "products", LoadSettings: &schema.LoadSettings{Unlogged: true}},
+				},
+			},
+		},
+	}
+
+	engine, err := copy.NewEngine(
+		ctx,
+		sourceContainer.GetConnectionString(),
+		targetContainer.GetConnectionString(),
+	)
+	require.NoError(t, err)
+	defer engine.Close()
+
+	err = engine.Copy(ctx, config)
+	require.NoError(t, err)
+
+	targetPool, err := pgxpool.New(ctx, targetContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer targetPool.Close()
+
+	var productCount int
+	err = targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM public.products").Scan(&productCount)
+	require.NoError(t, err)
+	assert.Greater(t, productCount, 0)
+
+	// The table is switched back to LOGGED after the load
+	var persistence string
+	err = targetPool.QueryRow(ctx,
+		"SELECT relpersistence FROM pg_class WHERE oid = 'public.products'::regclass").Scan(&persistence)
+	require.NoError(t, err)
+	assert.Equal(t, "p", persistence)
+
+	// Statistics were refreshed after the load
+	var analyzed bool
+	err = targetPool.QueryRow(ctx,
+		"SELECT last_analyze IS NOT NULL FROM pg_stat_user_tables WHERE relid = 'public.products'::regclass").Scan(&analyzed)
+	require.NoError(t, err)
+	assert.True(t, analyzed)
+}
+
+func TestSchemaCheck(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	// Start containers
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	// Wait for containers to be ready
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	// Create test schema in both source and target, data only in source
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, targetContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+
+	// A column added in the source but not yet in the target
+	sourcePool, err := pgxpool.New(ctx, sourceContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer sourcePool.Close()
+	_, err = sourcePool.Exec(ctx, "ALTER TABLE public.products ADD COLUMN sku TEXT DEFAULT 'SKU'")
+	require.NoError(t, err)
+
+	targetPool, err := pgxpool.New(ctx, targetContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer targetPool.Close()
+
+	newConfig := func(mode string) *schema.Config {
+		return &schema.Config{
+			SchemaCheck: mode,
+			Schemas: []schema.Schema{
+				{
+					Name:   "public",
+					Tables: []schema.Table{{Name: "products", Truncate: true}},
+				},
+			},
+		}
+	}
+
+	engine, err := copy.NewEngine(
+		ctx,
+		sourceContainer.GetConnectionString(),
+		targetContainer.GetConnectionString(),
+	)
+	require.NoError(t, err)
+	defer engine.Close()
+
+	diff, err := engine.Diff(ctx, newConfig(""))
+	require.NoError(t, err)
+	require.Len(t, diff.Differences, 1)
+	assert.Equal(t, copy.DiffMissingColumn, diff.Differences[0].Kind)
+	assert.Equal(t, "sku", diff.Differences[0].Column)
+	assert.True(t, diff.HasBlocking())
+
+	countProducts := func() int {
+		var count int
+		err := targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM public.products").Scan(&count)
+		require.NoError(t, err)
+		return count
+	}
+
+	// fail: the table is not touched
+	require.NoError(t, engine.Copy(ctx, newConfig(schema.SchemaCheckFail)))
+	assert.Equal(t, 0, countProducts())
+
+	// skip: the table is copied without the new column
+	require.NoError(t, engine.Copy(ctx, newConfig(schema.SchemaCheckSkip)))
+	assert.Greater(t, countProducts(), 0)
+
+	// alter: the column is added to the target and copied
+	require.NoError(t, engine.Copy(ctx, newConfig(schema.SchemaCheckAlter)))
+	var sku string
+	err = targetPool.QueryRow(ctx, "SELECT sku FROM public.products LIMIT 1").Scan(&sku)
+	require.NoError(t, err)
+	assert.Equal(t, "SKU", sku)
+
+	diff, err = engine.Diff(ctx, newConfig(""))
+	require.NoError(t, err)
+	assert.Empty(t, diff.Differences)
+}
+
+func TestCopyWithAutoCast(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	// Start containers
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	// Wait for containers to be ready
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	sourcePool, err := pgxpool.New(ctx, sourceContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer sourcePool.Close()
+
+	targetPool, err := pgxpool.New(ctx, targetContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer targetPool.Close()
+
+	// Older source types, wider target types
+	_, err = sourcePool.Exec(ctx, `
+		CREATE TABLE public.events (id INTEGER PRIMARY KEY, happened_at TIMESTAMP, score NUMERIC(6,3));
+		SET TIME ZONE 'UTC';
+		INSERT INTO public.events VALUES (1, '2024-03-01 12:00:00', 12.345), (2, '2024-03-02 08:30:00', 1.5);
+	`)
+	require.NoError(t, err)
+	_, err = targetPool.Exec(ctx, `
+		CREATE TABLE public.events (id BIGINT PRIMARY KEY, happened_at TIMESTAMPTZ, score NUMERIC(6,1));
+	`)
+	require.NoError(t, err)
+
+	config := &schema.Config{
+		AutoCast: true,
+		Schemas: []schema.Schema{
+			{
+				Name:   "public",
+				Tables: []schema.Table{{Name: "events"}},
+			},
+		},
+	}
+
+	engine, err := copy.NewEngine(
+		ctx,
+		sourceContainer.GetConnectionString(),
+		targetContainer.GetConnectionString(),
+	)
+	require.NoError(t, err)
+	defer engine.Close()
+
+	err = engine.Copy(ctx, config)
+	require.NoError(t, err)
+
+	var count int
+	err = targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM public.events").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// The lossy numeric cast rounds on the source side
+	var score string
+	err = targetPool.QueryRow(ctx, "SELECT score::text FROM public.events WHERE id = 1").Scan(&score)
+	require.NoError(t, err)
+	assert.Equal(t, "12.3", score)
+}
+
+func TestExportToFiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	// Start container
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	// Create test schema and data in source
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+
+	config := &schema.Config{
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{
+						Name:      "users",
+						Ignore:    []string{"password_hash"},
+						Transform: map[string]string{"email": "hash"},
+					},
+				},
+			},
+		},
+	}
+
+	engine, err := copy.NewSourceEngine(ctx, sourceContainer.GetConnectionString(), db.Options{})
+	require.NoError(t, err)
+	defer engine.Close()
+
+	for _, format := range []string{copy.FormatCSV, copy.FormatTSV, copy.FormatJSONL} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := storage.New(dir)
+			require.NoError(t, err)
+
+			err = engine.Export(ctx, config, store, copy.ExportOptions{Format: format, Header: true})
+			require.NoError(t, err)
+
+			manifestData, err := os.ReadFile(filepath.Join(dir, copy.ManifestFile))
+			require.NoError(t, err)
+			var manifest copy.Manifest
+			require.NoError(t, json.Unmarshal(manifestData, &manifest))
+			require.Len(t, manifest.Tables, 1)
+
+			entry := manifest.Tables[0]
+			assert.Equal(t, "public.users."+format, entry.File)
+			assert.Greater(t, entry.Rows, int64(0))
+			for _, col := range entry.Columns {
+				assert.NotEqual(t, "password_hash", col.Name)
+				if col.Name == "email" {
+					assert.Equal(t, "text", col.Type)
+				}
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, entry.File))
+			require.NoError(t, err)
+
+			switch format {
+			case copy.FormatJSONL:
+				lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+				assert.Len(t, lines, int(entry.Rows))
+				var row map[string]any
+				require.NoError(t, json.Unmarshal([]byte(lines[0]), &row))
+				assert.Contains(t, row, "email")
+			default:
+				reader := csv.NewReader(strings.NewReader(string(data)))
+				if format == copy.FormatTSV {
+					reader.Comma = '\t'
+				}
+				records, err := reader.ReadAll()
+				require.NoError(t, err)
+				assert.Len(t, records, int(entry.Rows)+1)
+				assert.Contains(t, records[0], "email")
+			}
+		})
+	}
+}
+
+func TestExportToParquet(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	// Start container
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	sourcePool, err := pgxpool.New(ctx, sourceContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer sourcePool.Close()
+
+	_, err = sourcePool.Exec(ctx, `
+		CREATE TABLE public.measurements (
+			id uuid PRIMARY KEY,
+			amount numeric(12,2),
+			taken_at timestamptz,
+			readings float8[],
+			details jsonb,
+			secret text
+		);
+		INSERT INTO public.measurements
+		SELECT gen_random_uuid(), i * 1.25, now(), ARRAY[i, NULL, i * 2]::float8[], jsonb_build_object('i', i), 'secret'
+		FROM generate_series(1, 250) i;
+	`)
+	require.NoError(t, err)
+
+	config := &schema.Config{
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{Name: "measurements", Ignore: []string{"secret"}},
+				},
+			},
+		},
+	}
+
+	engine, err := copy.NewSourceEngine(ctx, sourceContainer.GetConnectionString(), db.Options{})
+	require.NoError(t, err)
+	defer engine.Close()
+
+	dir := t.TempDir()
+	store, err := storage.New(dir)
+	require.NoError(t, err)
+
+	err = engine.Export(ctx, config, store, copy.ExportOptions{
+		Format:       copy.FormatParquet,
+		Compression:  storage.CompressionZstd,
+		RowGroupSize: 100,
+	})
+	require.NoError(t, err)
+
+	f, err := os.Open(filepath.Join(dir, "public.measurements.parquet"))
+	require.NoError(t, err)
+	defer f.Close()
+	info, err := f.Stat()
+	require.NoError(t, err)
+
+	file, err := parquet.OpenFile(f, info.Size())
+	require.NoError(t, err)
+	assert.Equal(t, int64(250), file.NumRows())
+	assert.Len(t, file.RowGroups(), 3)
+
+	fields := map[string]string{}
+	for _, field := range file.Schema().Fields() {
+		fields[field.Name()] = field.Type().String()
+	}
+	assert.NotContains(t, fields, "secret")
+	assert.Equal(t, "UUID", fields["id"])
+	assert.Equal(t, "DECIMAL(12,2)", fields["amount"])
+	assert.Equal(t, "TIMESTAMP(isAdjustedToUTC=true,unit=MICROS)", fields["taken_at"])
+	assert.Equal(t, "LIST", fields["readings"])
+	assert.Equal(t, "JSON", fields["details"])
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	// Start containers
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	// Wait for containers to be ready
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	// Create test schema in both source and target, data only in source
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, targetContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+
+	// Orders are listed before the users they reference
+	config := &schema.Config{
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{Name: "orders"},
+					{Name: "users"},
+					{Name: "complex_data"},
+				},
+			},
+		},
+	}
+
+	exporter, err := copy.NewSourceEngine(ctx, sourceContainer.GetConnectionString(), db.Options{})
+	require.NoError(t, err)
+	defer exporter.Close()
+
+	importer, err := copy.NewTargetEngine(ctx, targetContainer.GetConnectionString(), db.Options{})
+	require.NoError(t, err)
+	defer importer.Close()
+
+	sourcePool, err := pgxpool.New(ctx, sourceContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer sourcePool.Close()
+
+	targetPool, err := pgxpool.New(ctx, targetContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer targetPool.Close()
+
+	tests := []struct {
+		format      string
+		compression string
+	}{
+		{copy.FormatCSV, storage.CompressionNone},
+		{copy.FormatTSV, storage.CompressionNone},
+		{copy.FormatJSONL, storage.CompressionNone},
+		{copy.FormatCSV, storage.CompressionGzip},
+		{copy.FormatJSONL, storage.CompressionZstd},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+"/"+tt.compression, func(t *testing.T) {
+			store, err := storage.New(t.TempDir())
+			require.NoError(t, err)
+
+			err = exporter.Export(ctx, config, store, copy.ExportOptions{
+				Format:      tt.format,
+				Header:      true,
+				Compression: tt.compression,
+			})
+			require.NoError(t, err)
+
+			manifest, err := copy.ReadManifest(ctx, store)
+			require.NoError(t, err)
+			require.Len(t, manifest.Tables, 3)
+
+			err = importer.Import(ctx, manifest, store, nil, copy.ImportOptions{Truncate: true})
+			require.NoError(t, err)
+
+			for _, table := range []string{"public.users", "public.orders", "public.complex_data"} {
+				var sourceCount, targetCount int
+				err = sourcePool.QueryRow(ctx, "SELECT COUNT(*) FROM "+table).Scan(&sourceCount)
+				require.NoError(t, err)
+				err = targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM "+table).Scan(&targetCount)
+				require.NoError(t, err)
+				assert.Equal(t, sourceCount, targetCount, table)
+			}
+
+			// Values survive the round trip unchanged
+			var sourceData, targetData string
+			query := "SELECT md5(string_agg(c::text, '' ORDER BY c.id)) FROM public.complex_data c"
+			err = sourcePool.QueryRow(ctx, query).Scan(&sourceData)
+			require.NoError(t, err)
+			err = targetPool.QueryRow(ctx, query).Scan(&targetData)
+			require.NoError(t, err)
+			assert.Equal(t, sourceData, targetData)
+		})
+	}
+}
+
+func TestExportImportS3(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	// Start containers
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	minioContainer, err := StartMinIOContainer(ctx)
+	require.NoError(t, err)
+	defer minioContainer.Stop(ctx)
+
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, targetContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+
+	require.NoError(t, minioContainer.CreateBucket(ctx, "snapshots"))
+	t.Setenv("AWS_ENDPOINT_URL", minioContainer.Endpoint)
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", minioContainer.AccessKey)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", minioContainer.SecretKey)
+
+	config := &schema.Config{
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{Name: "users", Ignore: []string{"password_hash"}},
+				},
+			},
+		},
+	}
+
+	exporter, err := copy.NewSourceEngine(ctx, sourceContainer.GetConnectionString(), db.Options{})
+	require.NoError(t, err)
+	defer exporter.Close()
+
+	importer, err := copy.NewTargetEngine(ctx, targetContainer.GetConnectionString(), db.Options{})
+	require.NoError(t, err)
+	defer importer.Close()
+
+	store, err := storage.New("s3://snapshots/nightly")
+	require.NoError(t, err)
+
+	err = exporter.Export(ctx, config, store, copy.ExportOptions{Format: copy.FormatCSV, Header: true, Compression: storage.CompressionZstd})
+	require.NoError(t, err)
+
+	// A new storage reads the snapshot back, as a developer pulling it would
+	store, err = storage.New("s3://snapshots/nightly")
+	require.NoError(t, err)
+	manifest, err := copy.ReadManifest(ctx, store)
+	require.NoError(t, err)
+	require.Len(t, manifest.Tables, 1)
+
+	err = importer.Import(ctx, manifest, store, nil, copy.ImportOptions{Truncate: true})
+	require.NoError(t, err)
+
+	sourcePool, err := pgxpool.New(ctx, sourceContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer sourcePool.Close()
+
+	targetPool, err := pgxpool.New(ctx, targetContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer targetPool.Close()
+
+	var sourceCount, targetCount int
+	err = sourcePool.QueryRow(ctx, "SELECT COUNT(*) FROM public.users").Scan(&sourceCount)
+	require.NoError(t, err)
+	err = targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM public.users").Scan(&targetCount)
+	require.NoError(t, err)
+	assert.Equal(t, sourceCount, targetCount)
+	assert.Equal(t, int64(sourceCount), manifest.Tables[0].Rows)
+}
+
+func TestDumpAndLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	// Start containers
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, targetContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+
+	config := &schema.Config{
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{
+						Name:      "users",
+						Ignore:    []string{"last_login"},
+						Transform: map[string]string{"email": "hash"},
+						Truncate:  true,
+					},
+				},
+			},
+		},
+	}
+	table, err := config.FindTable("public.users")
+	require.NoError(t, err)
+
+	dumper, err := copy.NewSourceEngine(ctx, sourceContainer.GetConnectionString(), db.Options{})
+	require.NoError(t, err)
+	defer dumper.Close()
+
+	loader, err := copy.NewTargetEngine(ctx, targetContainer.GetConnectionString(), db.Options{})
+	require.NoError(t, err)
+	defer loader.Close()
+
+	sourcePool, err := pgxpool.New(ctx, sourceContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer sourcePool.Close()
+
+	targetPool, err := pgxpool.New(ctx, targetContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer targetPool.Close()
+
+	var sourceCount int
+	err = sourcePool.QueryRow(ctx, "SELECT COUNT(*) FROM public.users").Scan(&sourceCount)
+	require.NoError(t, err)
+
+	for _, format := range []string{copy.FormatCSV, copy.FormatJSONL} {
+		t.Run(format, func(t *testing.T) {
+			var stream bytes.Buffer
+			err := dumper.Dump(ctx, table, &stream, copy.ExportOptions{Format: format, Header: true, Compression: storage.CompressionGzip})
+			require.NoError(t, err)
+
+			err = loader.Load(ctx, table, &stream, copy.LoadOptions{Format: format, Header: true})
+			require.NoError(t, err)
+
+			var targetCount, plainEmails int
+			err = targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM public.users").Scan(&targetCount)
+			require.NoError(t, err)
+			assert.Equal(t, sourceCount, targetCount)
+
+			// Masking rules applied on the way out
+			err = targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM public.users WHERE email LIKE '%@%' OR last_login IS NOT NULL").Scan(&plainEmails)
+			require.NoError(t, err)
+			assert.Equal(t, 0, plainEmails)
+		})
+	}
+}
+
+func TestCopyFromQuery(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	// Start containers
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+
+	sourcePool, err := pgxpool.New(ctx, sourceContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer sourcePool.Close()
+
+	targetPool, err := pgxpool.New(ctx, targetContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer targetPool.Close()
+
+	// The target table only exists in the target, derived from a join in the source
+	_, err = targetPool.Exec(ctx, `
+		CREATE TABLE public.user_order_totals (
+			user_id INTEGER PRIMARY KEY,
+			email VARCHAR(255) NOT NULL,
+			order_count BIGINT NOT NULL,
+			total NUMERIC,
+			refreshed_at TIMESTAMPTZ DEFAULT now()
+		);
+	`)
+	require.NoError(t, err)
+
+	config := &schema.Config{
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{
+						Name: "user_order_totals",
+						Query: `SELECT u.id AS user_id, u.email, count(o.id) AS order_count, sum(o.total_amount) AS total
+							FROM public.users u JOIN public.orders o ON o.user_id = u.id
+							GROUP BY u.id, u.email`,
+						Transform: map[string]string{"email": "hash"},
+						Filter:    "order_count > 0",
+					},
+				},
+			},
+		},
+	}
+
+	engine, err := copy.NewEngine(
+		ctx,
+		sourceContainer.GetConnectionString(),
+		targetContainer.GetConnectionString(),
+	)
+	require.NoError(t, err)
+	defer engine.Close()
+
+	err = engine.Copy(ctx, config)
+	require.NoError(t, err)
+
+	var expected, count int
+	err = sourcePool.QueryRow(ctx, "SELECT COUNT(DISTINCT user_id) FROM public.orders WHERE user_id IS NOT NULL").Scan(&expected)
+	require.NoError(t, err)
+	err = targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM public.user_order_totals").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, expected, count)
+
+	var plainEmails int
+	err = targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM public.user_order_totals WHERE email LIKE '%@%'").Scan(&plainEmails)
+	require.NoError(t, err)
+	assert.Equal(t, 0, plainEmails)
+}
+
+func TestCopyWithLookup(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	// Start containers
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, targetContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+
+	other := "OTHER"
+	config := &schema.Config{
+		Lookups: map[string]schema.Lookup{
+			"categories": {Values: map[string]string{"Electronics": "ELEC"}, Default: &other},
+		},
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{
+						Name:      "products",
+						Transform: map[string]string{"category": "lookup:categories"},
+					},
+				},
+			},
+		},
+	}
+
+	engine, err := copy.NewEngine(
+		ctx,
+		sourceContainer.GetConnectionString(),
+		targetContainer.GetConnectionString(),
+	)
+	require.NoError(t, err)
+	defer engine.Close()
+
+	err = engine.Copy(ctx, config)
+	require.NoError(t, err)
+
+	targetPool, err := pgxpool.New(ctx, targetContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer targetPool.Close()
+
+	rows, err := targetPool.Query(ctx, "SELECT name, category FROM public.products ORDER BY id")
+	require.NoError(t, err)
+	categories := map[string]string{}
+	for rows.Next() {
+		var name, category string
+		require.NoError(t, rows.Scan(&name, &category))
+		categories[name] = category
+	}
+	require.NoError(t, rows.Err())
+
+	assert.Equal(t, map[string]string{
+		"Laptop Pro":     "ELEC",
+		"Wireless Mouse": "ELEC",
+		"Coffee Mug":     "OTHER",
+	}, categories)
+}
+
+func TestScanDetectsPII(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+
+	// A column whose name gives nothing away is found from its values
+	sourcePool, err := pgxpool.New(ctx, sourceContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer sourcePool.Close()
+	_, err = sourcePool.Exec(ctx, `
+		CREATE TABLE public.contacts (id SERIAL PRIMARY KEY, reference TEXT, note TEXT);
+		INSERT INTO public.contacts (reference, note) VALUES
+			('alice@example.com', 'called back'),
+			('bob@example.org', NULL),
+			('carol@example.net', 'no answer');
+	`)
+	require.NoError(t, err)
+
+	engine, err := copy.NewSourceEngine(ctx, sourceContainer.GetConnectionString(), db.Options{})
+	require.NoError(t, err)
+	defer engine.Close()
+
+	config := &schema.Config{
+		Schemas: []schema.Schema{
+			{
+				Name:   "public",
+				Tables: []schema.Table{{Name: "users", Ignore: []string{"password_hash"}}},
+			},
+		},
+	}
+
+	report, err := engine.Scan(ctx, copy.ScanOptions{Schemas: []string{"public"}, Config: config})
+	require.NoError(t, err)
+
+	findings := map[string]copy.PIIFinding{}
+	for _, finding := range report.Findings {
+		assert.Equal(t, "public", finding.Schema)
+		findings[finding.Table+"."+finding.Column] = finding
+	}
+
+	assert.Equal(t, pii.Email, findings["users.email"].Category)
+	assert.Equal(t, copy.DetectedByValues, findings["users.email"].DetectedBy)
+	assert.Equal(t, pii.PersonName, findings["users.first_name"].Category)
+	assert.Equal(t, pii.Credential, findings["users.password_hash"].Category)
+	assert.True(t, findings["users.password_hash"].Masked)
+	assert.Equal(t, pii.Address, findings["orders.shipping_address"].Category)
+
+	assert.Equal(t, pii.Email, findings["contacts.reference"].Category)
+	assert.Equal(t, 3, findings["contacts.reference"].Sampled)
+	assert.NotContains(t, findings, "contacts.note")
+	assert.NotContains(t, findings, "products.name")
+}
+
+func TestCopyRefusedByPolicy(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, targetContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+
+	config := &schema.Config{
+		Policy: &schema.Policy{Columns: []string{"email", "*_id_number"}},
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{Name: "products"},
+					{Name: "users", Transform: map[string]string{"email": "hash"}},
+				},
+			},
+		},
+	}
+
+	// A sensitive column is added to the source after the configuration was written
+	for _, url := range []string{sourceContainer.GetConnectionString(), targetContainer.GetConnectionString()} {
+		pool, err := pgxpool.New(ctx, url)
+		require.NoError(t, err)
+		_, err = pool.Exec(ctx, "ALTER TABLE public.users ADD COLUMN tax_id_number TEXT")
+		pool.Close()
+		require.NoError(t, err)
+	}
+
+	engine, err := copy.NewEngine(
+		ctx,
+		sourceContainer.GetConnectionString(),
+		targetContainer.GetConnectionString(),
+	)
+	require.NoError(t, err)
+	defer engine.Close()
+
+	err = engine.Copy(ctx, config)
+	assert.ErrorContains(t, err, "column public.users.tax_id_number matches sensitive pattern '*_id_number'")
+
+	targetPool, err := pgxpool.New(ctx, targetContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer targetPool.Close()
+
+	// No table was copied, not even the ones without violations
+	var count int
+	err = targetPool.QueryRow(ctx, "SELECT (SELECT COUNT(*) FROM public.users) + (SELECT COUNT(*) FROM public.products)").Scan(&count)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	config.Schemas[0].Tables[1].Ignore = []string{"tax_id_number"}
+	err = engine.Copy(ctx, config)
+	require.NoError(t, err)
+
+	err = targetPool.QueryRow(ctx, "SELECT COUNT(*) FROM public.users").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	// Query columns are checked against the columns they are read from, whatever their alias
+	queryConfig := &schema.Config{
+		Policy: config.Policy,
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{Name: "products", Query: "SELECT p.id, u.email AS name FROM public.products p JOIN public.users u ON u.id = p.id"},
+				},
+			},
+		},
+	}
+	err = engine.Copy(ctx, queryConfig)
+	assert.ErrorContains(t, err, "column public.products.name is read from public.users.email")
+}
+
+func TestDescribeTables(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+
+	sourcePool, err := pgxpool.New(ctx, sourceContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer sourcePool.Close()
+	_, err = sourcePool.Exec(ctx, "ANALYZE public.users")
+	require.NoError(t, err)
+
+	engine, err := copy.NewSourceEngine(ctx, sourceContainer.GetConnectionString(), db.Options{})
+	require.NoError(t, err)
+	defer engine.Close()
+
+	tables, err := engine.DescribeTables(ctx, []string{"public"})
+	require.NoError(t, err)
+
+	var users *copy.TableSummary
+	for i := range tables {
+		assert.Equal(t, "public", tables[i].Schema)
+		if tables[i].Table == "users" {
+			users = &tables[i]
+		}
+	}
+	require.NotNil(t, users)
+	assert.Equal(t, []string{"id"}, users.PrimaryKey)
+	assert.Equal(t, int64(3), users.EstimatedRows)
+	assert.Equal(t, "id", users.Columns[0].Name)
+	assert.True(t, users.Columns[0].NotNull)
+}
+
+func TestValidateReportsProblems(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, targetContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+
+	engine, err := copy.NewEngine(
+		ctx,
+		sourceContainer.GetConnectionString(),
+		targetContainer.GetConnectionString(),
+	)
+	require.NoError(t, err)
+	defer engine.Close()
+
+	valid := &schema.Config{
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{Name: "users", Transform: map[string]string{"email": "hash"}, Filter: "is_active = true", Truncate: true},
+				},
+			},
+		},
+	}
+	report, err := engine.Validate(ctx, valid)
+	require.NoError(t, err)
+	assert.Empty(t, report.Problems)
+
+	invalid := &schema.Config{
+		Policy: &schema.Policy{Columns: []string{"password_hash"}},
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{Name: "users", Transform: map[string]string{"emial": "hash"}, Filter: "is_actve = true"},
+					{Name: "missing_table"},
+					{Name: "order_totals", Query: "SELECT user_id, sum(total) AS total FROM public.orders GROUP BY user_id"},
+				},
+			},
+		},
+	}
+	report, err = engine.Validate(ctx, invalid)
+	require.NoError(t, err)
+
+	checks := map[string]string{}
+	for _, problem := range report.Problems {
+		checks[problem.Table+"."+problem.Column+":"+problem.Check] = problem.Message
+	}
+	assert.Contains(t, checks, "users.emial:column")
+	assert.Contains(t, checks["users.:sql"], "is_actve")
+	assert.Contains(t, checks, "users.password_hash:policy")
+	assert.Contains(t, report.Problems, copy.Problem{
+		Schema: "public", Table: "missing_table", Check: copy.CheckTable, Message: "table does not exist in source",
+	})
+	assert.Contains(t, checks["order_totals.:sql"], "total")
+}
+
+func TestDryRunPlan(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, targetContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+
+	engine, err := copy.NewEngine(
+		ctx,
+		sourceContainer.GetConnectionString(),
+		targetContainer.GetConnectionString(),
+	)
+	require.NoError(t, err)
+	defer engine.Close()
+
+	config := &schema.Config{
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{Name: "users", Ignore: []string{"password_hash"}, Filter: "is_active = true", Truncate: true},
+					{Name: "missing_table"},
+				},
+			},
+		},
+	}
+
+	plan, err := engine.DryRun(ctx, config)
+	require.NoError(t, err)
+	require.Len(t, plan.Tables, 2)
+
+	users := plan.Tables[0]
+	assert.Empty(t, users.Error)
+	assert.NotContains(t, users.Columns, "password_hash")
+	assert.Contains(t, users.SourceQuery, "WHERE is_active = true")
+	assert.Contains(t, users.TargetQuery, "COPY public.users (")
+	assert.GreaterOrEqual(t, users.EstimatedRows, int64(0))
+	assert.GreaterOrEqual(t, users.EstimatedBytes, int64(0))
+	assert.Equal(t, "TRUNCATE TABLE public.users CASCADE", users.Truncate)
+	assert.Equal(t, []string{"public.orders"}, users.TruncateCascade)
+	assert.NotEmpty(t, users.Sequences)
+
+	assert.Contains(t, plan.Tables[1].Error, "does not exist")
+
+	// Planning leaves the target untouched
+	targetPool, err := pgxpool.New(ctx, targetContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer targetPool.Close()
+
+	var count int
+	err = targetPool.QueryRow(ctx, "SELECT count(*) FROM public.users").Scan(&count)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestPlanAndApply(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	sourceContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer sourceContainer.Stop(ctx)
+
+	targetContainer, err := StartPostgresContainer(ctx, DefaultPostgresConfig())
+	require.NoError(t, err)
+	defer targetContainer.Stop(ctx)
+
+	err = sourceContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+	err = targetContainer.WaitForReady(ctx, 30*time.Second)
+	require.NoError(t, err)
+
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, targetContainer.GetConnectionString(), "schema/schema.sql")
+	require.NoError(t, err)
+	err = RunSqlScript(ctx, sourceContainer.GetConnectionString(), "schema/data.sql")
+	require.NoError(t, err)
+
+	engine, err := copy.NewEngine(
+		ctx,
+		sourceContainer.GetConnectionString(),
+		targetContainer.GetConnectionString(),
+	)
+	require.NoError(t, err)
+	defer engine.Close()
+
+	// Orders reference users, so the plan copies users first
+	config := &schema.Config{
+		Schemas: []schema.Schema{
+			{
+				Name: "public",
+				Tables: []schema.Table{
+					{Name: "orders"},
+					{Name: "users", Transform: map[string]string{"email": "hash"}, Truncate: true},
+				},
+			},
+		},
+	}
+
+	plan, err := engine.Plan(ctx, config)
+	require.NoError(t, err)
+	require.NoError(t, engine.OrderPlan(ctx, plan))
+	require.Len(t, plan.Tables, 2)
+	assert.Equal(t, "users", plan.Tables[0].Table)
+	assert.Equal(t, "orders", plan.Tables[1].Table)
+	assert.Equal(t, []string{"public.orders"}, plan.Tables[0].TruncateCascade)
+	assert.Empty(t, plan.Failed())
+
+	// The plan is applied from its file, without the configuration
+	var buf bytes.Buffer
+	require.NoError(t, json.NewEncoder(&buf).Encode(plan))
+	saved, err := copy.ReadPlan(&buf)
+	require.NoError(t, err)
+	require.NoError(t, engine.Apply(ctx, saved, nil))
+
+	sourcePool, err := pgxpool.New(ctx, sourceContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer sourcePool.Close()
+	targetPool, err := pgxpool.New(ctx, targetContainer.GetConnectionString())
+	require.NoError(t, err)
+	defer targetPool.Close()
+
+	var sourceCount, targetCount int
+	require.NoError(t, sourcePool.QueryRow(ctx, "SELECT count(*) FROM public.orders").Scan(&sourceCount))
+	require.NoError(t, targetPool.QueryRow(ctx, "SELECT count(*) FROM public.orders").Scan(&targetCount))
+	assert.Equal(t, sourceCount, targetCount)
+
+	var hashed int
+	require.NoError(t, targetPool.QueryRow(ctx, "SELECT count(*) FROM public.users WHERE email LIKE '%@%'").Scan(&hashed))
+	assert.Zero(t, hashed)
+
+	// A target change after planning makes the plan stale
+	_, err = targetPool.Exec(ctx, "ALTER TABLE public.orders ADD COLUMN note text")
+	require.NoError(t, err)
+	err = engine.Apply(ctx, saved, nil)
+	assert.ErrorContains(t, err, "schema changed since the plan was made")
+	assert.ErrorContains(t, err, "target table public.orders changed")
+
+	// Source and target swapped are other databases than planned
+	swapped, err := copy.NewEngine(
+		ctx,
+		targetContainer.GetConnectionString(),
+		sourceContainer.GetConnectionString(),
+	)
+	require.NoError(t, err)
+	defer swapped.Close()
+
+	err = swapped.Apply(ctx, saved, nil)
+	assert.ErrorContains(t, err, "plan was made against other databases")
+
+	// A statement edited after planning, such as a transformation removed, is refused
+	edited := *saved
+	edited.Tables = slices.Clone(saved.Tables)
+	edited.Tables[0].SourceQuery = `COPY (SELECT * FROM "public"."users") TO STDOUT`
+	err = engine.Apply(ctx, &edited, nil)
+	assert.ErrorContains(t, err, "plan was modified since it was made")
+}
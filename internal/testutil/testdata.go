@@ -8,7 +8,8 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/rs/zerolog/log"
+
+	"pgcopy/internal/log"
 )
 
 // RunSqlScript loads the test DDL and data into a PostgreSQL container
@@ -33,7 +34,7 @@ func RunSqlScript(ctx context.Context, connStr string, scriptFile string) error
 		return fmt.Errorf("failed to execute test data SQL: %w", err)
 	}
 
-	log.Info().Msg(fmt.Sprintf("Script %s executed successfully in connection %s", scriptFile, connStr))
+	log.Info().Msg(fmt.Sprintf("Script %s executed successfully in connection %s", scriptFile, log.MaskConnectionString(connStr)))
 	return nil
 }
 
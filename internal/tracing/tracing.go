@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// tracerName is the instrumentation scope used for all pgcopy spans
+	tracerName = "pgcopy"
+
+	// serviceName is reported as service.name on every exported span
+	serviceName = "pgcopy"
+)
+
+// Attribute keys shared by the instrumented packages
+const (
+	AttrSchema     = attribute.Key("pgcopy.schema")
+	AttrTable      = attribute.Key("pgcopy.table")
+	AttrRowsCopied = attribute.Key("pgcopy.rows_copied")
+	AttrColumns    = attribute.Key("pgcopy.columns")
+	AttrTables     = attribute.Key("pgcopy.tables")
+	AttrErrors     = attribute.Key("pgcopy.errors")
+)
+
+// endpointEnvVars are the standard OTLP variables that enable exporting
+var endpointEnvVars = []string{
+	"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT",
+	"OTEL_EXPORTER_OTLP_ENDPOINT",
+}
+
+// ShutdownFunc flushes pending spans and releases exporter resources
+type ShutdownFunc func(ctx context.Context) error
+
+// Setup installs an OTLP/HTTP trace exporter when an OTLP endpoint is configured
+// through the environment. Without an endpoint the global no-op provider is kept,
+// so instrumentation costs nothing.
+func Setup(ctx context.Context) (ShutdownFunc, error) {
+	noop := func(context.Context) error { return nil }
+
+	if !endpointConfigured() {
+		return noop, nil
+	}
+
+	// The exporter reads endpoint, headers and TLS settings from OTEL_EXPORTER_OTLP_* variables
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return noop, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", serviceName)),
+	)
+	if err != nil {
+		return noop, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer used across pgcopy
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// RecordError records err on the span and marks it as failed
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// endpointConfigured reports whether any OTLP endpoint variable is set
+func endpointConfigured() bool {
+	for _, name := range endpointEnvVars {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetup_NoEndpoint(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+
+	shutdown, err := Setup(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, shutdown)
+
+	// The no-op provider must not record anything
+	_, span := Tracer().Start(context.Background(), "noop")
+	assert.False(t, span.IsRecording())
+	span.End()
+
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestSetup_ExportsToCollector(t *testing.T) {
+	// A local HTTP server stands in for an OTLP collector
+	var requests atomic.Int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/traces" {
+			requests.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	original := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(original)
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+
+	shutdown, err := Setup(context.Background())
+	require.NoError(t, err)
+
+	_, span := Tracer().Start(context.Background(), "copy.table")
+	span.SetAttributes(AttrSchema.String("public"), AttrTable.String("users"))
+	assert.True(t, span.IsRecording())
+	span.End()
+
+	require.NoError(t, shutdown(context.Background()))
+	assert.Greater(t, requests.Load(), int32(0))
+}
+
+func TestRecordError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	_, span := provider.Tracer("test").Start(context.Background(), "failing")
+	RecordError(span, errors.New("boom"))
+	span.End()
+
+	_, okSpan := provider.Tracer("test").Start(context.Background(), "succeeding")
+	RecordError(okSpan, nil)
+	okSpan.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "boom", spans[0].Status().Description)
+	assert.Len(t, spans[0].Events(), 1)
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+}
@@ -5,17 +5,18 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-
-	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
+	"time"
 
 	"pgcopy/cmd"
+	"pgcopy/internal/log"
+	"pgcopy/internal/tracing"
 )
 
 func main() {
-	// Setup logging
-	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	// Setup default logging until the command flags are parsed
+	if err := log.Setup(log.Options{}); err != nil {
+		panic(err)
+	}
 
 	// Create root command
 	rootCmd := cmd.NewRootCmd()
@@ -33,9 +34,26 @@ func main() {
 		cancel()
 	}()
 
+	// Setup tracing (no-op unless an OTLP endpoint is configured)
+	shutdownTracing, err := tracing.Setup(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Tracing disabled")
+	}
+
 	// Execute command
-	if err := rootCmd.ExecuteContext(ctx); err != nil {
+	err = rootCmd.ExecuteContext(ctx)
+
+	// Flush spans even when the run was interrupted
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if shutdownErr := shutdownTracing(flushCtx); shutdownErr != nil {
+		log.Warn().Err(shutdownErr).Msg("Failed to flush traces")
+	}
+	flushCancel()
+
+	if err != nil {
 		log.Error().Err(err).Msg("Command execution failed")
+		log.Close()
 		os.Exit(1)
 	}
+	log.Close()
 }